@@ -2,221 +2,374 @@ package cmd
 
 import (
 	"crypto"
-	"crypto/ecdsa"
-	"crypto/ed25519"
-	"crypto/elliptic"
-	"crypto/rand"
-	"crypto/rsa"
-	"crypto/tls"
 	"crypto/x509"
 	"crypto/x509/pkix"
-	"encoding/pem"
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"log"
 	"os"
 	"strings"
 
+	"github.com/deitch/ssl-tools/pkg/ca"
 	"github.com/spf13/cobra"
+	"golang.org/x/term"
 )
 
 var (
 	caKeyPath, caCertPath, saNames string
+	subjectEncoding, sanFile       string
+	keyPassphrase, caKeyPassphrase string
+	keyKDFName                     string
+	keyInPath, keyInPassphrase     string
+	keepKey                        bool
+	curveName, sigAlgName          string
+	keyOptions                     ca.KeyOptions
+	sigAlg                         x509.SignatureAlgorithm
 )
 
-type KeyType int
-
 const (
-	RSA KeyType = iota
-	Ed25519
-	ECDSA
+	subjectHelp         = "distinguished name subject for the certificate in RFC 4514 format, most significant last, e.g. 'CN=server.myorg.com,O=My Org,ST=NY,C=US', or in OpenSSL format, most significant first, if starting with '/', e.g. '/C=US/ST=NY/O=My Org/CN=server.myorg.com'; supports multi-valued RDNs with '+', escaping with '\\', hex values with '#' and attributes by dotted OID"
+	subjectEncodingHelp = "string encoding of the subject, one of: default (PrintableString where possible, else UTF8String), utf8, printable"
+	sanHelp             = "subject alternative names (SAN) to use, comma-separated, each optionally typed as DNS:, IP:, email:, URI: or UPN:, e.g. '127.0.0.1,www.foo.com,email:me@foo.com,URI:spiffe://foo.com/web'; untyped names are IP addresses or DNS names"
+	sanFileHelp         = "file of subject alternative names, one per line in the same format as --san; blank lines and lines starting with '#' are ignored"
+	secretHelp          = "pass:<secret>, env:<variable>, file:<path>, fd:<number>, stdin, or prompt to prompt without echo"
+	keyPassphraseHelp   = "source of the passphrase with which to encrypt the generated key, as PKCS#8 with PBES2 and AES-256, one of: " + secretHelp + "; unencrypted if not set"
+	keyKDFHelp          = "key derivation function for --key-passphrase, one of: pbkdf2, scrypt"
+	keyInHelp           = "path to an existing private key to use rather than generating one"
+	keyInPassphraseHelp = "source of the passphrase of the existing key of --key-in or --keep-key, if it is encrypted, one of: " + secretHelp + "; prompted for if not set"
+	keepKeyHelp         = "if the key file of --key already exists, use the key in it rather than generating a new one"
+	keyTypeHelp         = "key type to use, one of: rsa, ecdsa, ed25519"
+	keySizeHelp         = "key size to use, in bits: for rsa one of 2048, 3072, 4096, 8192; for ecdsa that of the curve, overriding --curve"
+	curveHelp           = "curve of an ecdsa key, one of: P-256, P-384, P-521"
+	caKeyPassphraseHelp = "source of the passphrase of the CA key, if it is encrypted, one of: " + secretHelp + "; prompted for if not set"
 )
 
-func generateKeyPair(keyType KeyType, size int, keyfile string) (crypto.PrivateKey, crypto.PublicKey, error) {
-	var (
-		privateKey, publicKey interface{}
-		err                   error
-	)
-	reader := rand.Reader
-	switch keyType {
-	case RSA:
-		rsaPrivateKey, perr := rsa.GenerateKey(reader, size)
-		privateKey = rsaPrivateKey
-		err = perr
-		publicKey = rsaPrivateKey.Public()
-	case Ed25519:
-		publicKey, privateKey, err = ed25519.GenerateKey(reader)
-	case ECDSA:
-		curve := elliptic.P256()
-		ecdsaPrivateKey, perr := ecdsa.GenerateKey(curve, reader)
-		privateKey = ecdsaPrivateKey
-		err = perr
-		publicKey = ecdsaPrivateKey.Public()
-	default:
-		return nil, nil, fmt.Errorf("unknown key type: %v", keyType)
-	}
-
+func generateKeyPair(opts ca.KeyOptions, keyfile string) (crypto.PrivateKey, crypto.PublicKey, error) {
+	privateKey, err := ca.GenerateKey(opts)
 	if err != nil {
 		return nil, nil, err
 	}
-	err = privateKeyToPEMFile(privateKey, keyfile)
-	if err != nil {
+	if err := privateKeyToPEMFile(privateKey, keyfile); err != nil {
 		return nil, nil, err
 	}
-	return privateKey, publicKey, nil
+	return privateKey, privateKey.Public(), nil
 }
 
-func privateKeyToPEMFile(privateKey interface{}, keyfile string) error {
-	b, err := x509.MarshalPKCS8PrivateKey(privateKey)
-	if err != nil {
-		return err
+// loadOrGenerateKey returns the existing private key of --key-in, also saving it to keyfile if set, or that
+// already at keyfile with --keep-key. Otherwise it generates a new key and saves it to keyfile.
+func loadOrGenerateKey(opts ca.KeyOptions, keyfile string) (crypto.Signer, error) {
+	path := keyInPath
+	if path == "" && keepKey {
+		if _, err := os.Stat(keyfile); err == nil {
+			path = keyfile
+		}
 	}
-	privateKeyPem := &pem.Block{
-		Type:  "PRIVATE KEY",
-		Bytes: b,
+	if path == "" {
+		privateKey, _, err := generateKeyPair(opts, keyfile)
+		if err != nil {
+			return nil, err
+		}
+		return privateKey.(crypto.Signer), nil
 	}
-	f, err := os.Create(keyfile)
+	signer, encrypted, err := readExistingKey(path)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer f.Close()
+	if keyInPath != "" && keyfile != "" && keyfile != keyInPath {
+		if err := checkKeyCopy(path, keyfile, encrypted); err != nil {
+			return nil, err
+		}
+		if err := privateKeyToPEMFile(signer, keyfile); err != nil {
+			return nil, err
+		}
+	}
+	return signer, nil
+}
 
-	return pem.Encode(f, privateKeyPem)
+// readExistingKey reads the private key at path, asking for its passphrase with --key-in-passphrase,
+// and reports whether it was encrypted
+func readExistingKey(path string) (crypto.Signer, bool, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read key file %s: %v", path, err)
+	}
+	// the passphrase is only asked for if the key is encrypted
+	encrypted := false
+	password := secretFrom(keyInPassphrase, "passphrase for "+path)
+	privateKey, err := ca.ParsePrivateKeyPEMWithPassword(b, func(prompt string) (string, error) {
+		encrypted = true
+		return password(prompt)
+	})
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to parse private key from %s: %v", path, err)
+	}
+	signer, ok := privateKey.(crypto.Signer)
+	if !ok {
+		return nil, false, fmt.Errorf("unsupported private key in %s", path)
+	}
+	return signer, encrypted, nil
 }
 
-func certificateToPEMFile(b []byte, certfile string) error {
-	return certificatesToPEMFile([][]byte{b}, certfile)
+// checkKeyCopy refuses to save a copy of the encrypted key at path to dest unless --key-passphrase is
+// set, so that it is never saved decrypted
+func checkKeyCopy(path, dest string, encrypted bool) error {
+	if encrypted && keyPassphrase == "" {
+		return fmt.Errorf("the key in %s is encrypted, and would be saved decrypted to %s; set --key-passphrase to encrypt the copy", path, dest)
+	}
+	return nil
 }
 
-func certificatesToPEMFile(bs [][]byte, certfile string) error {
-	f, err := os.Create(certfile)
+// privateKeyToPEMFile saves the private key, encrypted if --key-passphrase is set
+func privateKeyToPEMFile(privateKey crypto.PrivateKey, keyfile string) error {
+	enc, err := keyEncryption()
 	if err != nil {
-		return fmt.Errorf("failed to create certificate file %s: %v", certfile, err)
+		return err
+	}
+	f, err := os.OpenFile(keyfile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
 	}
 	defer f.Close()
-	for _, b := range bs {
-		certPem := &pem.Block{Type: "CERTIFICATE", Bytes: b}
-		err := pem.Encode(f, certPem)
-		if err != nil {
-			return err
-		}
+
+	if enc != nil {
+		return ca.WriteEncryptedPrivateKey(f, privateKey, *enc)
 	}
-	return nil
+	return ca.WritePrivateKey(f, privateKey)
 }
 
-func signCert(template, parent *x509.Certificate, pub crypto.PublicKey, priv crypto.PrivateKey, certfile string) error {
-	b, err := x509.CreateCertificate(rand.Reader, template, parent, pub, priv)
+// keyEncryption returns how to encrypt the keys written, from --key-passphrase and --key-kdf, or nil
+// if they are not to be encrypted
+func keyEncryption() (*ca.KeyEncryption, error) {
+	if keyPassphrase == "" {
+		return nil, nil
+	}
+	passphrase, err := newSecret(keyPassphrase, "passphrase for the new key")
 	if err != nil {
-		return fmt.Errorf("Failed to create certificate: %s", err)
+		return nil, err
+	}
+	enc := &ca.KeyEncryption{Passphrase: []byte(passphrase)}
+	if keyKDFName != "" {
+		kdf, err := ca.ParseKDF(keyKDFName)
+		if err != nil {
+			return nil, err
+		}
+		enc.KDF = kdf
 	}
-	return certificateToPEMFile(b, certfile)
+	return enc, nil
 }
 
-// unfortunately, the golang library does not make it easy to parse DN
-func parseSubject(subject string) (*pkix.Name, error) {
+// secretFrom returns a PasswordFunc that reads the secret from source, or prompts for it, described by
+// name, if source is empty or prompt. The secret is read at most once, as sources like fd: cannot be
+// read again.
+func secretFrom(source, name string) ca.PasswordFunc {
 	var (
-		err  error
-		name pkix.Name
+		secret string
+		err    error
+		read   bool
 	)
-	// the separator character could be escaped, so we cannot just blindly split on it
-	separator := ','
-	if len(subject) > 0 && subject[0] == '/' {
-		separator = '/'
-		subject = subject[1:]
-	}
-	// hold the current string
-	current := make([]rune, 0)
-	for _, c := range subject {
-		if c != separator || (len(current) > 0 && current[len(current)-1] == '\\') {
-			current = append(current, c)
-			continue
+	return func(string) (string, error) {
+		if !read {
+			read = true
+			if source == "" || source == ca.SecretSourcePrompt {
+				secret, err = promptPassword(fmt.Sprintf("Enter %s: ", name))
+			} else {
+				secret, err = readSecret(source)
+			}
 		}
-		// we are at a separator
-		if err = populateName(&name, current); err != nil {
-			return nil, err
-		}
-		// reset our current
-		current = make([]rune, 0)
+		return secret, err
 	}
-	// do not miss anything at the end
-	if len(current) > 0 {
-		if err = populateName(&name, current); err != nil {
-			return nil, err
-		}
-	}
-	return &name, nil
-}
-
-func populateName(name *pkix.Name, rdn []rune) error {
-	// split on the first =
-	parts := strings.SplitN(string(rdn), "=", 2)
-	switch parts[0] {
-	case "C":
-		name.Country = []string{parts[1]}
-	case "O":
-		name.Organization = []string{parts[1]}
-	case "OU":
-		name.OrganizationalUnit = []string{parts[1]}
-	case "ST":
-		name.Province = []string{parts[1]}
-	case "L":
-		name.Locality = []string{parts[1]}
-	case "CN":
-		name.CommonName = parts[1]
-	default:
-		return fmt.Errorf("unknown RDN: %s", string(rdn))
+}
+
+// readSecret reads a secret from source, refusing stdin once the input file has been read from it
+func readSecret(source string) (string, error) {
+	if source == "stdin" && stdinIsInput {
+		return "", errors.New("stdin is the input file, so cannot also be a secret source; use fd:, file: or env: instead")
 	}
-	return nil
+	return ca.ReadSecret(source)
 }
 
-func loadAndSignCert(caCertPath, caKeyPath string, template *x509.Certificate, publicKey crypto.PublicKey, outCert string) error {
-	// read the CA key and certificate
-	caCert, err := tls.LoadX509KeyPair(caCertPath, caKeyPath)
+// newSecret reads a secret with which to protect something new from source. If source is prompt, it
+// is asked for twice, to confirm it.
+func newSecret(source, name string) (string, error) {
+	if source != ca.SecretSourcePrompt {
+		return readSecret(source)
+	}
+	secret, err := promptPassword(fmt.Sprintf("Enter %s: ", name))
+	if err != nil {
+		return "", err
+	}
+	confirm, err := promptPassword(fmt.Sprintf("Verify %s: ", name))
 	if err != nil {
-		return fmt.Errorf("failed to read CA cert/key: %v", err)
+		return "", err
 	}
-	if len(caCert.Certificate) < 1 {
-		return fmt.Errorf("unvalid CA certificate missing bytes")
+	if secret != confirm {
+		return "", fmt.Errorf("%s does not match", name)
 	}
-	caCertParsed, err := x509.ParseCertificate(caCert.Certificate[0])
+	return secret, nil
+}
+
+func certificatesToPEMFile(certs []*x509.Certificate, certfile string) error {
+	f, err := os.Create(certfile)
 	if err != nil {
-		return fmt.Errorf("failed to parse CA cert: %v", err)
+		return fmt.Errorf("failed to create certificate file %s: %v", certfile, err)
 	}
+	defer f.Close()
+	return ca.WriteCertificates(f, certs...)
+}
 
-	err = signCert(template, caCertParsed, publicKey, caCert.PrivateKey, outCert)
+func csrToPEMFile(csr *x509.CertificateRequest, filePath string) error {
+	f, err := os.Create(filePath)
 	if err != nil {
-		return fmt.Errorf("Failed to create certificate: %s", err)
+		return err
 	}
-	return nil
+	defer f.Close()
+	return ca.WriteCSR(f, csr)
+}
+
+// certSigner signs certificate templates, either a plain CA or a CA store
+type certSigner interface {
+	Sign(template *x509.Certificate, pub crypto.PublicKey) (*x509.Certificate, error)
+}
+
+// loadSigner opens the CA store in caDir if set, or else loads the CA from caCertPath and caKeyPath
+func loadSigner(caDir, caCertPath, caKeyPath string) (certSigner, *ca.CA, error) {
+	if caDir != "" {
+		store, err := ca.OpenStore(caDir, secretFrom(caKeyPassphrase, "passphrase for CA key"))
+		if err != nil {
+			return nil, nil, err
+		}
+		return store, store.CA, nil
+	}
+	authority, err := ca.LoadCA(caCertPath, caKeyPath, secretFrom(caKeyPassphrase, "passphrase for CA key"))
+	return authority, authority, err
 }
 
-func saveCSR(csr *x509.CertificateRequest, key crypto.PrivateKey, filePath string) error {
-	b, err := x509.CreateCertificateRequest(rand.Reader, csr, key)
+// loadAndSignCert signs template with the CA store in caDir if set, or else with the CA in
+// caCertPath and caKeyPath
+func loadAndSignCert(caDir, caCertPath, caKeyPath string, template *x509.Certificate, publicKey crypto.PublicKey, outCert string) error {
+	return loadAndSign(caDir, caCertPath, caKeyPath, template, publicKey, outCert, false)
+}
+
+// loadAndSign is loadAndSignCert, optionally saving the full chain of issuers after the certificate
+func loadAndSign(caDir, caCertPath, caKeyPath string, template *x509.Certificate, publicKey crypto.PublicKey, outCert string, withChain bool) error {
+	signer, authority, err := loadSigner(caDir, caCertPath, caKeyPath)
 	if err != nil {
 		return err
 	}
-	f, err := os.Create(filePath)
+	cert, err := signer.Sign(template, publicKey)
 	if err != nil {
 		return err
 	}
-	defer f.Close()
+	certs := []*x509.Certificate{cert}
+	if withChain {
+		certs = authority.ChainFor(cert)
+	}
+	return certificatesToPEMFile(certs, outCert)
+}
 
-	pemFormat := &pem.Block{Type: "CERTIFICATE REQUEST", Bytes: b}
-	err = pem.Encode(f, pemFormat)
+// parseSubject parses a distinguished name, returning it both as a pkix.Name and DER-encoded with
+// --subject-encoding, which keeps its order and multi-valued RDNs
+func parseSubject(subject string) (*pkix.Name, []byte, error) {
+	enc, err := ca.ParseStringEncoding(subjectEncoding)
 	if err != nil {
-		return err
+		return nil, nil, err
+	}
+	rdns, err := ca.ParseDN(subject)
+	if err != nil {
+		return nil, nil, err
+	}
+	raw, err := ca.MarshalDN(rdns, enc)
+	if err != nil {
+		return nil, nil, err
+	}
+	name := ca.RDNsToName(rdns)
+	return &name, raw, nil
+}
+
+// sigAlgHelp is the help of --sig-alg, for signing what, by signer
+func sigAlgHelp(what, signer string) string {
+	return fmt.Sprintf("signature algorithm with which to sign the %s, one of: %s; RSA-PSS with the RSAPSS ones; defaults to that of the %s", what, strings.Join(ca.SignatureAlgorithmNames(), ", "), signer)
+}
+
+// validateKeyOptions sets the key to generate from --key-type, --key-size and --curve, and the signature
+// algorithm from --sig-alg
+func validateKeyOptions(cmd *cobra.Command, args []string) {
+	keyType, err := ca.ParseKeyType(keyTypeName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	keyOptions = ca.KeyOptions{Type: keyType, Size: keySize}
+	if keyType == ca.ECDSA && !cmd.Flags().Changed("key-size") {
+		if keyOptions.Size, err = ca.ParseCurve(curveName); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if err := keyOptions.Validate(); err != nil {
+		log.Fatal(err)
+	}
+	sigAlg = x509.UnknownSignatureAlgorithm
+	if sigAlgName != "" {
+		if sigAlg, err = ca.ParseSignatureAlgorithm(sigAlgName); err != nil {
+			log.Fatal(err)
+		}
 	}
-	return nil
 }
 
-func validateKeyType(cmd *cobra.Command, args []string) {
-	switch keyTypeName {
-	case "rsa":
-		keyType = RSA
-	case "ecdsa":
-		keyType = ECDSA
-	case "ed25519":
-		keyType = Ed25519
-	default:
-		fmt.Fprintf(os.Stderr, "unknown key type: %s", keyTypeName)
-		os.Exit(1)
+// parseSANs parses the subject alternative names from --san and --san-file
+func parseSANs() (*ca.SANs, error) {
+	var names []string
+	if saNames != "" {
+		names = strings.Split(saNames, ",")
+	}
+	if sanFile != "" {
+		b, err := ioutil.ReadFile(sanFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read SAN file %s: %v", sanFile, err)
+		}
+		for _, line := range strings.Split(string(b), "\n") {
+			if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+				names = append(names, line)
+			}
+		}
+	}
+	return ca.ParseSANs(names)
+}
+
+// stdinIsInput is set once stdin has been read as the input file
+var stdinIsInput bool
+
+// readFileOrStdin reads the file at path, or stdin if path is "-"
+func readFileOrStdin(path string) ([]byte, error) {
+	if path == "-" {
+		stdinIsInput = true
+		return ioutil.ReadAll(os.Stdin)
+	}
+	return ioutil.ReadFile(path)
+}
+
+// promptPassword asks for a password on the terminal, without echoing it. It uses the controlling
+// terminal rather than stdin, which may be the file being read, or else stdin if it is a terminal, as
+// on Windows, which has no /dev/tty.
+func promptPassword(prompt string) (string, error) {
+	var (
+		b   []byte
+		err error
+	)
+	if tty, ttyErr := os.OpenFile("/dev/tty", os.O_RDWR, 0); ttyErr == nil {
+		defer tty.Close()
+		fmt.Fprint(tty, prompt)
+		b, err = term.ReadPassword(int(tty.Fd()))
+		fmt.Fprintln(tty)
+	} else if !stdinIsInput && term.IsTerminal(int(os.Stdin.Fd())) {
+		fmt.Fprint(os.Stderr, prompt)
+		b, err = term.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Fprintln(os.Stderr)
+	} else {
+		return "", fmt.Errorf("no terminal to prompt for a password: %v", ttyErr)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read password: %v", err)
 	}
+	return string(b), nil
 }
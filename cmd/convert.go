@@ -1,20 +1,30 @@
 package cmd
 
 import (
+	"bytes"
 	"crypto"
 	"crypto/rand"
 	"crypto/x509"
 	"encoding/pem"
+	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
 	"strings"
 
+	"github.com/deitch/ssl-tools/pkg/ca"
 	"github.com/spf13/cobra"
 	pkcs12 "software.sslmate.com/src/go-pkcs12"
 )
 
-var password string
+var (
+	password                  string
+	convertOutPath            string
+	convertKeyTo, convertForm string
+	pkcs7ChainPath, pkcs7Form string
+	jksKeyPassword, jksAlias  string
+	jksCAAlias                string
+)
 
 var convertCmd = &cobra.Command{
 	Use:   "convert",
@@ -22,6 +32,85 @@ var convertCmd = &cobra.Command{
 	Long:  `Convert between formats, such as pkcs12 and pem`,
 }
 
+var convertPemCmd = &cobra.Command{
+	Use:   "pem <der file>",
+	Short: "convert a der file to pem",
+	Long: `Convert a DER-encoded certificate, CSR, private or public key, CRL or PKCS#7 bundle, or '-' for stdin, to
+PEM, with the PEM type of its format, e.g. RSA PRIVATE KEY for a PKCS#1 key.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		b, err := readFileOrStdin(args[0])
+		if err != nil {
+			log.Fatalf("failed to read file %s: %v", args[0], err)
+		}
+		out, err := ca.DERToPEM(b)
+		if err != nil {
+			log.Fatalf("failed to convert %s: %v", args[0], err)
+		}
+		writeConverted(out, bytes.Contains(out, []byte("PRIVATE KEY-----")))
+	},
+}
+
+var convertDerCmd = &cobra.Command{
+	Use:   "der <pem file>",
+	Short: "convert a pem file to der",
+	Long: `Convert a PEM file, or '-' for stdin, holding a single certificate, CSR, private or public key, CRL or
+PKCS#7 bundle, to DER.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		b, err := readFileOrStdin(args[0])
+		if err != nil {
+			log.Fatalf("failed to read file %s: %v", args[0], err)
+		}
+		out, err := ca.PEMToDER(b)
+		if err != nil {
+			log.Fatalf("failed to convert %s: %v", args[0], err)
+		}
+		writeConverted(out, bytes.Contains(b, []byte("PRIVATE KEY-----")))
+	},
+}
+
+var convertKeyCmd = &cobra.Command{
+	Use:   "key <key file>",
+	Short: "convert a private key between pkcs1, pkcs8 and sec1",
+	Long: `Convert a private key, PEM or DER, or '-' for stdin, to PKCS#1 (RSA PRIVATE KEY, RSA only), PKCS#8 (PRIVATE
+KEY) or SEC 1 (EC PRIVATE KEY, ECDSA only). An encrypted key is decrypted; the converted key is not encrypted.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		format, err := ca.ParseKeyFormat(convertKeyTo)
+		if err != nil {
+			log.Fatal(err)
+		}
+		b, err := readFileOrStdin(args[0])
+		if err != nil {
+			log.Fatalf("failed to read file %s: %v", args[0], err)
+		}
+		objects, err := ca.ReadObjects(b, secretFrom(keyPassphrase, "passphrase for "+args[0]))
+		if err != nil {
+			log.Fatalf("the file %s is not in a known format: %v", args[0], err)
+		}
+		obj := objects[0]
+		if obj.Err != nil {
+			log.Fatalf("failed to parse %s in %s: %v", obj.Kind, args[0], obj.Err)
+		}
+		if obj.Kind != ca.KindPrivateKey && obj.Kind != ca.KindSSHPrivateKey {
+			log.Fatalf("%s holds a %s, not a private key", args[0], obj.Kind)
+		}
+		block, err := ca.MarshalPrivateKey(obj.PrivateKey, format)
+		if err != nil {
+			log.Fatal(err)
+		}
+		switch convertForm {
+		case "pem":
+			writeConverted(pem.EncodeToMemory(block), true)
+		case "der":
+			writeConverted(block.Bytes, true)
+		default:
+			log.Fatalf("unknown output format %s, must be one of: pem, der", convertForm)
+		}
+	},
+}
+
 var convertPkcs12Cmd = &cobra.Command{
 	Use:   "pkcs12",
 	Short: "read and write pkcs12 file formats",
@@ -41,28 +130,23 @@ var convertPkcs12ReadCmd = &cobra.Command{
 			log.Fatalf("failed to read file %s: %v", pkcsFile, err)
 		}
 
-		// read the pkcs12 file
-		key, cert, chain, err := pkcs12.DecodeChain(b, password)
+		// read the pkcs12 file, trying an empty password first
+		key, chain, err := ca.ParsePKCS12(b, secretFrom(password, "password for "+pkcsFile))
 		if err != nil {
 			log.Fatalf("failed to decode file %s: %v", pkcsFile, err)
 		}
-		// write the outputs
+		// write the outputs; without a key, it is a trust store of CA certificates
 		if key != nil {
 			if err := privateKeyToPEMFile(key, keyPath); err != nil {
 				log.Fatalf("failed to write key file at %s: %v", keyPath, err)
 			}
-		}
-		if cert != nil {
-			if err := certificateToPEMFile(cert.Raw, certPath); err != nil {
+			if err := certificatesToPEMFile(chain[:1], certPath); err != nil {
 				log.Fatalf("failed to write cert file at %s: %v", certPath, err)
 			}
+			chain = chain[1:]
 		}
 		if len(chain) > 0 {
-			bs := [][]byte{}
-			for _, cert := range chain {
-				bs = append(bs, cert.Raw)
-			}
-			if err := certificatesToPEMFile(bs, caCertPath); err != nil {
+			if err := certificatesToPEMFile(chain, caCertPath); err != nil {
 				log.Fatalf("failed to write CA chain file at %s: %v", caCertPath, err)
 			}
 		}
@@ -89,14 +173,7 @@ var convertPkcs12WriteCmd = &cobra.Command{
 			if err != nil {
 				log.Fatalf("failed to read key file %s: %v", keyPath, err)
 			}
-			der, _ := pem.Decode(b)
-			if der == nil {
-				log.Fatalf("no valid PEM in key file %s: %v", keyPath, err)
-			}
-			if !(der.Type == "PRIVATE KEY" || strings.HasSuffix(der.Type, " PRIVATE KEY")) {
-				log.Fatalf("key file %s does not contain private key", keyPath)
-			}
-			key, err = parsePrivateKey(der.Bytes)
+			key, err = ca.ParsePrivateKeyPEMWithPassword(b, secretFrom(keyPassphrase, "passphrase for "+keyPath))
 			if err != nil {
 				log.Fatalf("failed to parse private key from %s: %v", keyPath, err)
 			}
@@ -106,14 +183,7 @@ var convertPkcs12WriteCmd = &cobra.Command{
 			if err != nil {
 				log.Fatalf("failed to read cert file %s: %v", certPath, err)
 			}
-			der, _ := pem.Decode(b)
-			if der == nil {
-				log.Fatalf("no valid PEM in cert file %s: %v", certPath, err)
-			}
-			if der.Type != "CERTIFICATE" {
-				log.Fatalf("cert file %s does not contain certificate", certPath)
-			}
-			cert, err = x509.ParseCertificate(der.Bytes)
+			cert, err = ca.ParseCertificatePEM(b)
 			if err != nil {
 				log.Fatalf("failed to parse certificate from %s: %v", certPath, err)
 			}
@@ -124,27 +194,31 @@ var convertPkcs12WriteCmd = &cobra.Command{
 			if err != nil {
 				log.Fatalf("failed to read CA cert chain file %s: %v", caCertPath, err)
 			}
-			der, _ := pem.Decode(b)
-			if der == nil {
-				log.Fatalf("no valid PEM in cert file %s: %v", certPath, err)
+			chain, err = ca.ParseCertificatesPEM(b)
+			if err != nil {
+				log.Fatalf("failed to parse CA certificates from %s: %v", caCertPath, err)
 			}
-			if der.Type != "CERTIFICATE" {
-				log.Fatalf("CA cert file %s does not contain certificate", certPath)
+		}
+		// refuse to bundle a key with a certificate it does not belong to, or a broken chain
+		if cert != nil {
+			if err := ca.MatchError(ca.CheckMatch(ca.MatchOptions{Key: key, Cert: cert, Chain: chain})); err != nil {
+				log.Fatalf("key, cert and chain do not match: %v", err)
 			}
-			cert, err := x509.ParseCertificate(der.Bytes)
-			if err != nil {
-				log.Fatalf("failed to parse CA certificate from %s: %v", certPath, err)
+		}
+		var pkcs12Password string
+		if password != "" {
+			if pkcs12Password, err = newSecret(password, "password for "+pkcsFile); err != nil {
+				log.Fatal(err)
 			}
-			chain = append(chain, cert)
 		}
 		// now write the pkcs12 file
 		if key != nil {
-			pkcs12Bytes, err = pkcs12.Encode(rand.Reader, key, cert, chain, password)
+			pkcs12Bytes, err = pkcs12.Encode(rand.Reader, key, cert, chain, pkcs12Password)
 			if err != nil {
 				log.Fatalf("failed to pkcs12 encode key, cert and chain: %v", err)
 			}
 		} else {
-			pkcs12Bytes, err = pkcs12.EncodeTrustStore(rand.Reader, chain, password)
+			pkcs12Bytes, err = pkcs12.EncodeTrustStore(rand.Reader, chain, pkcs12Password)
 			if err != nil {
 				log.Fatalf("failed to pkcs12 encode chain: %v", err)
 			}
@@ -155,9 +229,310 @@ var convertPkcs12WriteCmd = &cobra.Command{
 	},
 }
 
+var convertPkcs7Cmd = &cobra.Command{
+	Use:   "pkcs7",
+	Short: "read and write pkcs7 certificate bundles",
+	Long:  `Read and write PKCS#7 certificate bundles, certs-only SignedData, as in .p7b files`,
+}
+
+var convertPkcs7ReadCmd = &cobra.Command{
+	Use:   "read <pkcs7 file>",
+	Short: "read a pkcs7 bundle and output its certificates as pem",
+	Long: `Read a PKCS#7 bundle, PEM or DER, or '-' for stdin, and output its certificates as PEM, ordered as a chain
+from the leaf when they form one.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		b, err := readFileOrStdin(args[0])
+		if err != nil {
+			log.Fatalf("failed to read file %s: %v", args[0], err)
+		}
+		objects, err := ca.ReadObjects(b, nil)
+		if err != nil {
+			log.Fatalf("the file %s is not in a known format: %v", args[0], err)
+		}
+		var certs []*x509.Certificate
+		for _, obj := range objects {
+			if obj.Kind != ca.KindPKCS7 {
+				continue
+			}
+			if obj.Err != nil {
+				log.Fatalf("failed to parse pkcs7 bundle in %s: %v", args[0], obj.Err)
+			}
+			certs = append(certs, obj.Certificates...)
+		}
+		if len(certs) == 0 {
+			log.Fatalf("no certificates in a pkcs7 bundle in %s", args[0])
+		}
+		certs = ca.OrderChain(certs)
+		if convertOutPath == "" {
+			if err := ca.WriteCertificates(os.Stdout, certs...); err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
+		if err := certificatesToPEMFile(certs, convertOutPath); err != nil {
+			log.Fatalf("failed to write cert file at %s: %v", convertOutPath, err)
+		}
+	},
+}
+
+var convertPkcs7WriteCmd = &cobra.Command{
+	Use:   "write <pkcs7 file>",
+	Short: "write a pkcs7 bundle from pem certificates",
+	Long:  `Write a PKCS#7 bundle, DER or PEM, of a leaf certificate, its intermediates and CA certificates.`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		var certs []*x509.Certificate
+		for _, p := range []string{certPath, pkcs7ChainPath, caCertPath} {
+			if p == "" {
+				continue
+			}
+			c, err := readCertificates(p)
+			if err != nil {
+				log.Fatal(err)
+			}
+			certs = append(certs, c...)
+		}
+		if len(certs) == 0 {
+			log.Fatal("must specify at least one of --cert, --chain or --ca")
+		}
+		der, err := ca.EncodePKCS7(certs)
+		if err != nil {
+			log.Fatalf("failed to pkcs7 encode certificates: %v", err)
+		}
+		switch pkcs7Form {
+		case "der":
+		case "pem":
+			der = pem.EncodeToMemory(&pem.Block{Type: "PKCS7", Bytes: der})
+		default:
+			log.Fatalf("unknown output format %s, must be one of: der, pem", pkcs7Form)
+		}
+		if err := os.WriteFile(args[0], der, 0644); err != nil {
+			log.Fatalf("failed to write pkcs7 file %s: %v", args[0], err)
+		}
+	},
+}
+
+var convertJksCmd = &cobra.Command{
+	Use:   "jks",
+	Short: "read and write java keystores",
+	Long:  `Read Java keystores in JKS or JCEKS format, and write them in JKS format`,
+}
+
+var convertJksReadCmd = &cobra.Command{
+	Use:   "read <jks file>",
+	Short: "read a java keystore and output its entries as pem",
+	Long: `Read a JKS or JCEKS keystore, listing its entries, and output a private key entry as pem: its key to --key,
+its certificate to --cert and the rest of its chain to --ca, followed by the trusted certificate entries. With more
+than one private key entry, choose one with --alias. JCEKS secret key entries are not supported.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		jksFile := args[0]
+		b, err := ioutil.ReadFile(jksFile)
+		if err != nil {
+			log.Fatalf("failed to read file %s: %v", jksFile, err)
+		}
+		var keyPassword ca.PasswordFunc
+		if jksKeyPassword != "" {
+			keyPassword = secretFrom(jksKeyPassword, "key password for "+jksFile)
+		}
+		// read the keystore, trying an empty password first
+		entries, err := ca.ParseJKS(b, secretFrom(password, "password for "+jksFile), keyPassword)
+		if err != nil {
+			log.Fatalf("failed to decode file %s: %v", jksFile, err)
+		}
+		var (
+			keyEntry *ca.JKSEntry
+			trusted  []*x509.Certificate
+		)
+		for i, entry := range entries {
+			if entry.PrivateKey == nil {
+				fmt.Printf("%s\ttrusted certificate\t%s\n", entry.Alias, entry.Certificates[0].Subject)
+				trusted = append(trusted, entry.Certificates...)
+				continue
+			}
+			if len(entry.Certificates) == 0 {
+				fmt.Printf("%s\tprivate key\twithout certificate\n", entry.Alias)
+			} else {
+				fmt.Printf("%s\tprivate key\t%s\n", entry.Alias, entry.Certificates[0].Subject)
+			}
+			// JKS aliases are lowercase, as keytool stores them
+			if jksAlias == "" || strings.EqualFold(jksAlias, entry.Alias) {
+				if keyEntry != nil && jksAlias == "" {
+					log.Fatalf("%s has more than one private key entry, choose one with --alias", jksFile)
+				}
+				keyEntry = &entries[i]
+			}
+		}
+		if jksAlias != "" && keyEntry == nil {
+			log.Fatalf("%s has no private key entry %s", jksFile, jksAlias)
+		}
+		// write the outputs; without a key entry, it is a trust store of CA certificates
+		var chain []*x509.Certificate
+		if keyEntry != nil {
+			if err := privateKeyToPEMFile(keyEntry.PrivateKey, keyPath); err != nil {
+				log.Fatalf("failed to write key file at %s: %v", keyPath, err)
+			}
+			if len(keyEntry.Certificates) > 0 {
+				if err := certificatesToPEMFile(keyEntry.Certificates[:1], certPath); err != nil {
+					log.Fatalf("failed to write cert file at %s: %v", certPath, err)
+				}
+				chain = keyEntry.Certificates[1:]
+			}
+		}
+		if chain = append(chain, trusted...); len(chain) > 0 {
+			if err := certificatesToPEMFile(chain, caCertPath); err != nil {
+				log.Fatalf("failed to write CA chain file at %s: %v", caCertPath, err)
+			}
+		}
+	},
+}
+
+var convertJksWriteCmd = &cobra.Command{
+	Use:   "write <jks file>",
+	Short: "write a java keystore from pem inputs",
+	Long: `Write a JKS keystore with a private key entry of --key, with --cert and its chain, and a trusted certificate
+entry for each certificate in --ca. With only --ca, writes a trust store.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		jksFile := args[0]
+		var entries []ca.JKSEntry
+		if keyPath != "" {
+			if certPath == "" {
+				log.Fatal("must specify --cert with --key")
+			}
+			b, err := ioutil.ReadFile(keyPath)
+			if err != nil {
+				log.Fatalf("failed to read key file %s: %v", keyPath, err)
+			}
+			key, err := ca.ParsePrivateKeyPEMWithPassword(b, secretFrom(keyPassphrase, "passphrase for "+keyPath))
+			if err != nil {
+				log.Fatalf("failed to parse private key from %s: %v", keyPath, err)
+			}
+			chain, err := readCertificates(certPath)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if pkcs7ChainPath != "" {
+				more, err := readCertificates(pkcs7ChainPath)
+				if err != nil {
+					log.Fatal(err)
+				}
+				chain = append(chain, more...)
+			}
+			// refuse to store a key with a certificate it does not belong to, or a broken chain
+			if err := ca.MatchError(ca.CheckMatch(ca.MatchOptions{Key: key, Cert: chain[0], Chain: chain[1:]})); err != nil {
+				log.Fatalf("key, cert and chain do not match: %v", err)
+			}
+			alias := jksAlias
+			if alias == "" {
+				alias = "mykey"
+			}
+			entries = append(entries, ca.JKSEntry{Alias: alias, PrivateKey: key, Certificates: chain})
+		}
+		if caCertPath != "" {
+			trusted, err := readCertificates(caCertPath)
+			if err != nil {
+				log.Fatal(err)
+			}
+			for i, cert := range trusted {
+				alias := jksCAAlias
+				if len(trusted) > 1 {
+					alias = fmt.Sprintf("%s-%d", jksCAAlias, i+1)
+				}
+				entries = append(entries, ca.JKSEntry{Alias: alias, Certificates: []*x509.Certificate{cert}})
+			}
+		}
+		if len(entries) == 0 {
+			log.Fatal("must specify --key and --cert, or --ca")
+		}
+		var storePassword string
+		if password != "" {
+			var err error
+			if storePassword, err = newSecret(password, "password for "+jksFile); err != nil {
+				log.Fatal(err)
+			}
+		}
+		keyPassword := storePassword
+		if jksKeyPassword != "" {
+			var err error
+			if keyPassword, err = newSecret(jksKeyPassword, "key password for "+jksFile); err != nil {
+				log.Fatal(err)
+			}
+		}
+		b, err := ca.EncodeJKS(entries, storePassword, keyPassword)
+		if err != nil {
+			log.Fatalf("failed to encode keystore: %v", err)
+		}
+		if err := os.WriteFile(jksFile, b, 0600); err != nil {
+			log.Fatalf("failed to write jks file %s: %v", jksFile, err)
+		}
+	},
+}
+
 func convertInit() {
 	convertCmd.AddCommand(convertPkcs12Cmd)
 	convertPkcs12Init()
+	convertCmd.AddCommand(convertPemCmd)
+	convertCmd.AddCommand(convertDerCmd)
+	convertCmd.AddCommand(convertKeyCmd)
+	convertCmd.AddCommand(convertPkcs7Cmd)
+	convertPkcs7Init()
+	convertCmd.AddCommand(convertJksCmd)
+	convertJksInit()
+	for _, cmd := range []*cobra.Command{convertPemCmd, convertDerCmd, convertKeyCmd} {
+		cmd.Flags().StringVar(&convertOutPath, "out", "", "path to save the converted file; defaults to stdout")
+	}
+	convertKeyCmd.Flags().StringVar(&convertKeyTo, "to", "", "format to convert the key to, one of: pkcs1, pkcs8, sec1")
+	_ = convertKeyCmd.MarkFlagRequired("to")
+	convertKeyCmd.Flags().StringVar(&convertForm, "format", "pem", "encoding of the converted key, one of: pem, der")
+	convertKeyCmd.Flags().StringVar(&keyPassphrase, "key-passphrase", "", "source of the passphrase of the key, if it is encrypted, one of: "+secretHelp+"; prompted for if not set")
+}
+
+func convertPkcs7Init() {
+	convertPkcs7Cmd.AddCommand(convertPkcs7ReadCmd)
+	convertPkcs7Cmd.AddCommand(convertPkcs7WriteCmd)
+	convertPkcs7ReadCmd.Flags().StringVar(&convertOutPath, "out", "", "path to save the certificates, PEM-encoded; defaults to stdout")
+	convertPkcs7WriteCmd.Flags().StringVar(&certPath, "cert", "", "path to the leaf certificate pem file")
+	convertPkcs7WriteCmd.Flags().StringVar(&pkcs7ChainPath, "chain", "", "path to the intermediate certificates pem file")
+	convertPkcs7WriteCmd.Flags().StringVar(&caCertPath, "ca", "", "path to the CA certificates pem file")
+	convertPkcs7WriteCmd.Flags().StringVar(&pkcs7Form, "format", "der", "encoding of the pkcs7 file, one of: der, pem")
+}
+
+func convertJksInit() {
+	convertJksCmd.AddCommand(convertJksReadCmd)
+	convertJksCmd.AddCommand(convertJksWriteCmd)
+	convertJksCmd.PersistentFlags().StringVar(&caCertPath, "ca", "", "path to CA pem file")
+	convertJksCmd.PersistentFlags().StringVar(&certPath, "cert", "", "path to cert pem file")
+	convertJksCmd.PersistentFlags().StringVar(&keyPath, "key", "", "path to key pem file")
+	convertJksCmd.PersistentFlags().StringVar(&keyPassphrase, "key-passphrase", "", "source of the passphrase of the key pem file, one of: "+secretHelp+"; when reading a keystore, the key is encrypted with it, if set, and when writing one, it decrypts the key, prompted for if not set")
+	convertJksCmd.PersistentFlags().StringVar(&jksAlias, "alias", "", "alias of the private key entry, not case sensitive; when reading, needed only if there are several, and when writing, mykey if not set")
+
+	convertJksReadCmd.Flags().StringVar(&keyKDFName, "key-kdf", string(ca.KDFPBKDF2), keyKDFHelp)
+	convertJksReadCmd.Flags().StringVar(&password, "password", "", "source of the password of the keystore, one of: "+secretHelp+"; if not set, an empty password is tried, then prompted for")
+	convertJksReadCmd.Flags().StringVar(&jksKeyPassword, "key-password", "", "source of the password of the private key entries, one of: "+secretHelp+"; that of the keystore if not set")
+
+	convertJksWriteCmd.Flags().StringVar(&password, "password", "", "source of the password to protect the keystore, one of: "+secretHelp+"; empty if not set")
+	convertJksWriteCmd.Flags().StringVar(&jksKeyPassword, "key-password", "", "source of the password to encrypt the private key entry, one of: "+secretHelp+"; that of the keystore if not set")
+	convertJksWriteCmd.Flags().StringVar(&pkcs7ChainPath, "chain", "", "path to the intermediate certificates pem file, added to the chain of the private key entry")
+	convertJksWriteCmd.Flags().StringVar(&jksCAAlias, "ca-alias", "ca", "alias of the trusted certificate entry of --ca, numbered from 1 if it has several certificates")
+}
+
+// writeConverted writes b to --out, readable only by the owner if it is private, or else to stdout
+func writeConverted(b []byte, private bool) {
+	if convertOutPath == "" {
+		if _, err := os.Stdout.Write(b); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	perm := os.FileMode(0644)
+	if private {
+		perm = 0600
+	}
+	if err := os.WriteFile(convertOutPath, b, perm); err != nil {
+		log.Fatalf("failed to write %s: %v", convertOutPath, err)
+	}
 }
 func convertPkcs12Init() {
 	convertPkcs12Cmd.AddCommand(convertPkcs12ReadCmd)
@@ -165,15 +540,17 @@ func convertPkcs12Init() {
 	convertPkcs12Cmd.PersistentFlags().StringVar(&caCertPath, "ca", "", "path to CA pem file")
 	convertPkcs12Cmd.PersistentFlags().StringVar(&certPath, "cert", "", "path to cert pem file")
 	convertPkcs12Cmd.PersistentFlags().StringVar(&keyPath, "key", "", "path to key pem file")
+	convertPkcs12Cmd.PersistentFlags().StringVar(&keyPassphrase, "key-passphrase", "", "source of the passphrase of the key pem file, one of: "+secretHelp+"; when reading a pkcs12 file, the key is encrypted with it, if set, and when writing one, it decrypts the key, prompted for if not set")
 
 	convertPkcs12ReadInit()
 	convertPkcs12WriteInit()
 }
 func convertPkcs12ReadInit() {
-	convertPkcs12ReadCmd.Flags().StringVar(&password, "password", "", "password to read pkcs12 file")
+	convertPkcs12ReadCmd.Flags().StringVar(&keyKDFName, "key-kdf", string(ca.KDFPBKDF2), keyKDFHelp)
+	convertPkcs12ReadCmd.Flags().StringVar(&password, "password", "", "source of the password of the pkcs12 file, one of: "+secretHelp+"; if not set, an empty password is tried, then prompted for")
 }
 func convertPkcs12WriteInit() {
-	convertPkcs12WriteCmd.Flags().StringVar(&password, "password", "", "password to encrypt pkcs12 file, optional")
+	convertPkcs12WriteCmd.Flags().StringVar(&password, "password", "", "source of the password to encrypt the pkcs12 file, one of: "+secretHelp+"; empty if not set")
 }
 
 /*
@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"time"
+
+	"github.com/deitch/ssl-tools/pkg/ca"
+	"github.com/spf13/cobra"
+)
+
+var (
+	crlPath, crlFormat string
+	crlDays            int
+)
+
+var crlCmd = &cobra.Command{
+	Use:   "crl",
+	Short: "Generate a certificate revocation list",
+	Long: `Generate a certificate revocation list (CRL) signed by the CA, listing every certificate
+revoked with 'ca revoke'. Each CRL gets a new, higher CRL number.`,
+	PreRun: func(cmd *cobra.Command, args []string) {
+		if caDir == "" && (caKeyPath == "" || caCertPath == "" || indexPath == "") {
+			log.Fatal("must specify either --ca-dir or all of --ca-key, --ca-cert and --index")
+		}
+		if crlFormat != "pem" && crlFormat != "der" {
+			log.Fatalf("unknown CRL format: %s", crlFormat)
+		}
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		var (
+			authority *ca.CA
+			index     = ca.Index{Path: indexPath}
+		)
+		if caDir != "" {
+			store, err := ca.OpenStore(caDir, secretFrom(caKeyPassphrase, "passphrase for CA key"))
+			if err != nil {
+				log.Fatalf("failed to open CA directory %s: %v", caDir, err)
+			}
+			authority, index = store.CA, store.Index()
+		} else {
+			var err error
+			if authority, err = ca.LoadCA(caCertPath, caKeyPath, secretFrom(caKeyPassphrase, "passphrase for CA key")); err != nil {
+				log.Fatal(err)
+			}
+		}
+		entries, err := index.Entries()
+		if err != nil {
+			log.Fatal(err)
+		}
+		number, err := index.NextCRLNumber()
+		if err != nil {
+			log.Fatal(err)
+		}
+		now := time.Now()
+		der, err := authority.CreateCRL(entries, ca.CRLOptions{
+			Number:     number,
+			ThisUpdate: now,
+			NextUpdate: now.Add(time.Hour * 24 * time.Duration(crlDays)),
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+		out := der
+		if crlFormat == "pem" {
+			var buf bytes.Buffer
+			if err := ca.WriteCRL(&buf, der); err != nil {
+				log.Fatal(err)
+			}
+			out = buf.Bytes()
+		}
+		if err := os.WriteFile(crlPath, out, 0644); err != nil {
+			log.Fatalf("failed to write CRL file %s: %v", crlPath, err)
+		}
+	},
+}
+
+func crlInit() {
+	crlCmd.Flags().StringVar(&caDir, "ca-dir", "", "path to a CA store created with 'ca init --dir'; must specify --ca-dir or all of --ca-key, --ca-cert and --index")
+	crlCmd.Flags().StringVar(&caKeyPath, "ca-key", "", "path to the CA key to sign the CRL")
+	crlCmd.Flags().StringVar(&caCertPath, "ca-cert", "", "path to the CA certificate to sign the CRL")
+	crlCmd.Flags().StringVar(&caKeyPassphrase, "ca-key-passphrase", "", caKeyPassphraseHelp)
+	crlCmd.Flags().StringVar(&indexPath, "index", "", "path to the index of issued certificates; the CRL number is kept in the file crlnumber next to it")
+	crlCmd.Flags().StringVar(&crlPath, "out", "", "path to save the CRL")
+	_ = crlCmd.MarkFlagRequired("out")
+	crlCmd.Flags().StringVar(&crlFormat, "format", "pem", "output format of the CRL, one of: pem, der")
+	crlCmd.Flags().IntVar(&crlDays, "days", 7, "days until the next CRL update")
+}
@@ -1,62 +1,70 @@
 package cmd
 
 import (
-	"crypto/x509"
 	"log"
-	"net"
-	"strings"
 
+	"github.com/deitch/ssl-tools/pkg/ca"
 	"github.com/spf13/cobra"
 )
 
 var csrCmd = &cobra.Command{
 	Use:   "csr",
 	Short: "Generate a private key, generate a CSR",
-	Long:  `Generate a private key, generate a CSR.`,
+	Long: `Generate a private key, generate a CSR. With --key-in, or --keep-key when the key file already exists,
+creates the CSR for an existing key instead.`,
+	PreRun: func(cmd *cobra.Command, args []string) {
+		validateKeyOptions(cmd, args)
+		if keyPath == "" && keyInPath == "" {
+			log.Fatal("must specify --key or --key-in")
+		}
+	},
 	Run: func(cmd *cobra.Command, args []string) {
-		var (
-			template x509.CertificateRequest
-		)
-		key, _, err := generateKeyPair(keyType, keySize, keyPath)
+		// parse everything before the key is generated, so that a mistake leaves no key behind
+		name, rawSubject, err := parseSubject(subject)
 		if err != nil {
-			log.Fatalf("error generating private key: %v", err)
+			log.Fatalf("error parsing the subject: %v", err)
 		}
-		name, err := parseSubject(subject)
+		sans, err := parseSANs()
 		if err != nil {
-			log.Fatalf("error parsing the subject: %v", err)
+			log.Fatalf("invalid subject alternative names: %v", err)
 		}
-		template = x509.CertificateRequest{
-			Subject: *name,
+		key, err := loadOrGenerateKey(keyOptions, keyPath)
+		if err != nil {
+			log.Fatalf("error getting private key: %v", err)
 		}
-		if saNames != "" {
-			sans := strings.Split(saNames, ",")
-			sansDNS := make([]string, 0)
-			sansIps := make([]net.IP, 0)
-			for _, s := range sans {
-				ip := net.ParseIP(s)
-				if ip == nil {
-					sansDNS = append(sansDNS, s)
-				} else {
-					sansIps = append(sansIps, ip)
-				}
-			}
-			template.DNSNames = sansDNS
-			template.IPAddresses = sansIps
+		opts := ca.CSROptions{
+			Subject:            *name,
+			RawSubject:         rawSubject,
+			SANs:               *sans,
+			SignatureAlgorithm: sigAlg,
 		}
 
-		// load and sign
-		if err := saveCSR(&template, key, csrPath); err != nil {
+		csr, err := ca.CreateCSR(opts, key)
+		if err != nil {
+			log.Fatalf("failed to create CSR: %v", err)
+		}
+		if err := csrToPEMFile(csr, csrPath); err != nil {
 			log.Fatalf("failed to save CSR: %v", err)
 		}
 	},
 }
 
 func csrInit() {
-	csrCmd.Flags().StringVar(&keyPath, "key", "", "path to the save the generated key")
-	_ = csrCmd.MarkFlagRequired("key")
+	csrCmd.Flags().StringVar(&keyPath, "key", "", "path to the save the generated key, or a copy of that of --key-in; must specify --key or --key-in")
+	csrCmd.Flags().StringVar(&keyPassphrase, "key-passphrase", "", keyPassphraseHelp)
+	csrCmd.Flags().StringVar(&keyKDFName, "key-kdf", string(ca.KDFPBKDF2), keyKDFHelp)
+	csrCmd.Flags().StringVar(&keyInPath, "key-in", "", keyInHelp)
+	csrCmd.Flags().StringVar(&keyInPassphrase, "key-in-passphrase", "", keyInPassphraseHelp)
+	csrCmd.Flags().BoolVar(&keepKey, "keep-key", false, keepKeyHelp)
+	csrCmd.Flags().IntVar(&keySize, "key-size", 4096, keySizeHelp)
+	csrCmd.Flags().StringVar(&keyTypeName, "key-type", "rsa", keyTypeHelp)
+	csrCmd.Flags().StringVar(&curveName, "curve", "P-256", curveHelp)
+	csrCmd.Flags().StringVar(&sigAlgName, "sig-alg", "", sigAlgHelp("CSR", "key"))
 	csrCmd.Flags().StringVar(&csrPath, "csr", "", "path to the save the generated CSR")
 	_ = csrCmd.MarkFlagRequired("csr")
-	csrCmd.Flags().StringVar(&subject, "subject", "", "distinguished name subject for the certificate in the format 'C=US,ST=NY,O=My Org,CN=server.myorg.com', also supports '/C=US/ST=NY/...' if starting with '/'")
+	csrCmd.Flags().StringVar(&subject, "subject", "", subjectHelp)
+	csrCmd.Flags().StringVar(&subjectEncoding, "subject-encoding", "default", subjectEncodingHelp)
 	_ = csrCmd.MarkFlagRequired("subject")
-	csrCmd.Flags().StringVar(&saNames, "san", "", "subject alternative names (SAN) to use, comma-separated, e.g. '127.0.0.1,www.foo.com'")
+	csrCmd.Flags().StringVar(&saNames, "san", "", sanHelp)
+	csrCmd.Flags().StringVar(&sanFile, "san-file", "", sanFileHelp)
 }
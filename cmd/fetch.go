@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/deitch/ssl-tools/pkg/ca"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ocsp"
+)
+
+var (
+	fetchServerName, fetchStartTLS string
+	fetchOutPath, fetchRootsPath   string
+	fetchTimeout                   time.Duration
+)
+
+var fetchCmd = &cobra.Command{
+	Use:   "fetch <host:port>",
+	Short: "Fetch the certificate chain from a TLS server",
+	Long: `Connect to a TLS server, optionally negotiating TLS with StartTLS, and print the certificate chain it
+presents, the negotiated TLS version and cipher suite, and any stapled OCSP response. Optionally save the
+chain to a PEM file, and verify it against trusted roots. If the port is omitted, it is that of the
+StartTLS protocol, or 443.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		result, err := ca.Fetch(args[0], ca.FetchOptions{ServerName: fetchServerName, StartTLS: fetchStartTLS, Timeout: fetchTimeout})
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(result.Certificates) == 0 {
+			log.Fatalf("%s presented no certificates", args[0])
+		}
+		fmt.Printf("Version: %s\n", ca.TLSVersionName(result.Version))
+		fmt.Printf("Cipher suite: %s\n", tls.CipherSuiteName(result.CipherSuite))
+		if result.ServerName != "" {
+			fmt.Printf("Server name: %s\n", result.ServerName)
+		}
+		for i, cert := range result.Certificates {
+			fmt.Printf("[%d] ", i+1)
+			printCert(cert)
+		}
+		printStapledOCSP(result)
+
+		if fetchOutPath != "" {
+			if err := certificatesToPEMFile(result.Certificates, fetchOutPath); err != nil {
+				log.Fatal(err)
+			}
+			fmt.Printf("Saved %d certificates to %s\n", len(result.Certificates), fetchOutPath)
+		}
+		if fetchRootsPath != "" {
+			roots, err := readCertificates(fetchRootsPath)
+			if err != nil {
+				log.Fatal(err)
+			}
+			host := result.ServerName
+			if host == "" {
+				host = result.Host
+			}
+			opts := ca.VerifyOptions{Roots: roots, Intermediates: result.Certificates[1:], Host: host}
+			if opts.Purpose, err = ca.ParsePurpose("server"); err != nil {
+				log.Fatal(err)
+			}
+			if _, err := ca.Verify(result.Certificates[0], opts); err != nil {
+				log.Fatalf("verification failed: %s", ca.ExplainVerifyError(err, opts))
+			}
+			fmt.Println("Verification: OK")
+		}
+	},
+}
+
+func fetchInit() {
+	fetchCmd.Flags().StringVar(&fetchServerName, "servername", "", "server name to send with SNI and verify the certificate for; defaults to the host, unless it is an IP address")
+	fetchCmd.Flags().StringVar(&fetchStartTLS, "starttls", "", "negotiate TLS with StartTLS, one of: "+strings.Join(ca.StartTLSProtocols(), ", "))
+	fetchCmd.Flags().StringVar(&fetchOutPath, "out", "", "path to save the presented chain, PEM-encoded")
+	fetchCmd.Flags().StringVar(&fetchRootsPath, "ca", "", "path to trusted root certificates with which to verify the chain as a server certificate for the server name")
+	fetchCmd.Flags().DurationVar(&fetchTimeout, "timeout", 10*time.Second, "timeout for connecting and the handshake")
+}
+
+// printStapledOCSP prints the OCSP response stapled to the handshake, if any
+func printStapledOCSP(result *ca.FetchResult) {
+	if len(result.OCSPResponse) == 0 {
+		fmt.Printf("Stapled OCSP: none\n")
+		return
+	}
+	var (
+		resp *ocsp.Response
+		err  error
+	)
+	// the signature can only be checked with the issuer
+	if len(result.Certificates) > 1 {
+		resp, err = ocsp.ParseResponseForCert(result.OCSPResponse, result.Certificates[0], result.Certificates[1])
+	} else {
+		resp, err = ocsp.ParseResponse(result.OCSPResponse, nil)
+	}
+	if err != nil {
+		fmt.Printf("Stapled OCSP: invalid: %v\n", err)
+		return
+	}
+	status := "unknown"
+	switch resp.Status {
+	case ocsp.Good:
+		status = "good"
+	case ocsp.Revoked:
+		status = fmt.Sprintf("revoked at %s, reason %s", resp.RevokedAt, ca.RevocationReason(resp.RevocationReason))
+	}
+	fmt.Printf("Stapled OCSP:\n")
+	fmt.Printf("\tStatus: %s\n", status)
+	fmt.Printf("\tProduced at: %s\n", resp.ProducedAt)
+	fmt.Printf("\tThis update: %s\n", resp.ThisUpdate)
+	if !resp.NextUpdate.IsZero() {
+		fmt.Printf("\tNext update: %s\n", resp.NextUpdate)
+	}
+}
@@ -1,59 +1,108 @@
 package cmd
 
 import (
+	"crypto"
 	"crypto/x509"
 	"log"
-	"math/big"
-	"time"
 
+	"github.com/deitch/ssl-tools/pkg/ca"
 	"github.com/spf13/cobra"
 )
 
 var (
 	keySize, certDays int
 	subject           string
+	caDir             string
+	serialPolicyName  string
 )
 
 var initCmd = &cobra.Command{
-	Use:    "init",
-	Short:  "Initialize a CA",
-	Long:   `Initialize a CA with a key and self-signed certificate`,
-	PreRun: validateKeyType,
+	Use:   "init",
+	Short: "Initialize a CA",
+	Long: `Initialize a CA with a key and self-signed certificate. With --dir, creates a CA directory
+that holds the key, certificate, configuration, serial number counter and an index of every
+certificate issued, for use with 'ca sign --ca-dir'. With --key-in, or --keep-key when the key file already
+exists, the CA uses an existing key.`,
+	PreRun: func(cmd *cobra.Command, args []string) {
+		validateKeyOptions(cmd, args)
+		if caDir == "" && ((caKeyPath == "" && keyInPath == "") || caCertPath == "") {
+			log.Fatal("must specify either --dir or --ca-cert and one of --ca-key or --key-in")
+		}
+		if caDir != "" && (caKeyPath != "" || caCertPath != "") {
+			log.Fatal("--dir cannot be combined with --ca-key or --ca-cert")
+		}
+	},
 	Run: func(cmd *cobra.Command, args []string) {
-		privateKey, publicKey, err := generateKeyPair(keyType, keySize, caKeyPath)
+		name, rawSubject, err := parseSubject(subject)
 		if err != nil {
-			log.Fatalf("error generating private key: %v", err)
+			log.Fatalf("error parsing the subject: %v", err)
+		}
+		// with --dir, the store saves the key itself
+		var privateKey crypto.Signer
+		switch {
+		case caDir != "" && keyInPath == "":
+			privateKey, err = ca.GenerateKey(keyOptions)
+		case caDir != "":
+			var encrypted bool
+			if privateKey, encrypted, err = readExistingKey(keyInPath); err == nil {
+				err = checkKeyCopy(keyInPath, caDir, encrypted)
+			}
+		default:
+			privateKey, err = loadOrGenerateKey(keyOptions, caKeyPath)
 		}
-		name, err := parseSubject(subject)
 		if err != nil {
-			log.Fatalf("error parsing the subject: %v", err)
+			log.Fatalf("error getting private key: %v", err)
 		}
-		template := x509.Certificate{
-			SerialNumber: big.NewInt(1),
-			Subject:      *name,
-			NotBefore:    time.Now(),
-			NotAfter:     time.Now().Add(time.Hour * 24 * time.Duration(certDays)),
+		template := ca.CertificateOptions{
+			Subject:            *name,
+			RawSubject:         rawSubject,
+			Days:               certDays,
+			KeyUsage:           ca.RootCAProfile.KeyUsageFor(privateKey.Public()),
+			IsCA:               true,
+			SignatureAlgorithm: sigAlg,
+		}.Template()
 
-			KeyUsage:              x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
-			BasicConstraintsValid: true,
-			IsCA:                  true,
+		if caDir != "" {
+			policy, err := ca.ParseSerialPolicy(serialPolicyName)
+			if err != nil {
+				log.Fatal(err)
+			}
+			enc, err := keyEncryption()
+			if err != nil {
+				log.Fatal(err)
+			}
+			if _, err := ca.InitStore(caDir, ca.StoreConfig{SerialPolicy: policy}, template, privateKey, enc); err != nil {
+				log.Fatalf("Failed to create CA directory: %v", err)
+			}
+			return
 		}
 
-		err = signCert(&template, &template, publicKey, privateKey, caCertPath)
+		cert, err := ca.SelfSign(template, privateKey)
 		if err != nil {
 			log.Fatalf("Failed to create certificate: %s", err)
 		}
+		if err := certificatesToPEMFile([]*x509.Certificate{cert}, caCertPath); err != nil {
+			log.Fatalf("Failed to save certificate: %s", err)
+		}
 	},
 }
 
 func initInit() {
-	initCmd.Flags().StringVar(&caKeyPath, "ca-key", "", "path to save the CA key")
-	_ = initCmd.MarkFlagRequired("ca-key")
-	initCmd.Flags().StringVar(&caCertPath, "ca-cert", "", "path to save the CA certificate")
-	_ = initCmd.MarkFlagRequired("ca-cert")
-	initCmd.Flags().StringVar(&subject, "subject", "", "distinguished name subject for the certificate in the format 'C=US,ST=NY,O=My Org,CN=server.myorg.com', also supports '/C=US/ST=NY/...' if starting with '/'; must specify one of --csr or --subject")
+	initCmd.Flags().StringVar(&caKeyPath, "ca-key", "", "path to save the CA key, or a copy of that of --key-in; must specify --dir or --ca-cert and one of --ca-key or --key-in")
+	initCmd.Flags().StringVar(&caCertPath, "ca-cert", "", "path to save the CA certificate; must specify --dir or --ca-cert and one of --ca-key or --key-in")
+	initCmd.Flags().StringVar(&caDir, "dir", "", "directory in which to create a CA store, holding the key, certificate, config, serial counter and index of issued certificates")
+	initCmd.Flags().StringVar(&serialPolicyName, "serial-policy", string(ca.SerialSequential), "how the CA store in --dir assigns serial numbers, one of: sequential, random")
+	initCmd.Flags().StringVar(&subject, "subject", "", subjectHelp)
+	initCmd.Flags().StringVar(&subjectEncoding, "subject-encoding", "default", subjectEncodingHelp)
 	_ = initCmd.MarkFlagRequired("subject")
-	initCmd.Flags().IntVar(&keySize, "key-size", 4096, "key size to use")
-	initCmd.Flags().StringVar(&keyTypeName, "key-type", "rsa", "key type to use, one of: rsa, ecdsa, ed25519")
+	initCmd.Flags().IntVar(&keySize, "key-size", 4096, keySizeHelp)
+	initCmd.Flags().StringVar(&keyTypeName, "key-type", "rsa", keyTypeHelp)
+	initCmd.Flags().StringVar(&curveName, "curve", "P-256", curveHelp)
+	initCmd.Flags().StringVar(&sigAlgName, "sig-alg", "", sigAlgHelp("self-signed certificate", "CA key"))
+	initCmd.Flags().StringVar(&keyPassphrase, "key-passphrase", "", "source of the passphrase with which to encrypt the CA key, as PKCS#8 with PBES2 and AES-256, one of: "+secretHelp+"; unencrypted if not set")
+	initCmd.Flags().StringVar(&keyKDFName, "key-kdf", string(ca.KDFPBKDF2), keyKDFHelp)
+	initCmd.Flags().StringVar(&keyInPath, "key-in", "", keyInHelp+" for the CA")
+	initCmd.Flags().StringVar(&keyInPassphrase, "key-in-passphrase", "", keyInPassphraseHelp)
+	initCmd.Flags().BoolVar(&keepKey, "keep-key", false, "if the key file of --ca-key already exists, use the key in it rather than generating a new one")
 	initCmd.Flags().IntVar(&certDays, "days", 365, "days for certificate validity")
 }
@@ -0,0 +1,178 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/deitch/ssl-tools/pkg/ca"
+	"github.com/spf13/cobra"
+)
+
+var keyPubPath, keyOutPath, keyFormat string
+
+var keyCmd = &cobra.Command{
+	Use:   "key",
+	Short: "Generate and inspect keys",
+	Long:  `Generate private keys, extract their public keys, compute fingerprints and pins, and check them.`,
+}
+
+var keyGenCmd = &cobra.Command{
+	Use:   "gen <key file>",
+	Short: "Generate a private key",
+	Long:  `Generate a private key, optionally encrypted, and optionally save its public key.`,
+	Args:  cobra.ExactArgs(1),
+	PreRun: func(cmd *cobra.Command, args []string) {
+		validateKeyOptions(cmd, args)
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		_, publicKey, err := generateKeyPair(keyOptions, args[0])
+		if err != nil {
+			log.Fatalf("error generating private key: %v", err)
+		}
+		if keyPubPath != "" {
+			f, err := os.Create(keyPubPath)
+			if err != nil {
+				log.Fatalf("failed to create public key file %s: %v", keyPubPath, err)
+			}
+			defer f.Close()
+			if err := ca.WritePublicKey(f, publicKey); err != nil {
+				log.Fatalf("failed to save public key: %v", err)
+			}
+		}
+	},
+}
+
+var keyPubCmd = &cobra.Command{
+	Use:   "pub <file>",
+	Short: "Extract a public key",
+	Long: `Extract the public key of the first private key, certificate, CSR or public key in a file, or '-' for
+stdin, as PEM or in OpenSSH authorized_keys format.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		var (
+			w   io.Writer = os.Stdout
+			err error
+		)
+		objects := readKeyObjects(args[0])
+		if keyOutPath != "" {
+			f, err := os.Create(keyOutPath)
+			if err != nil {
+				log.Fatalf("failed to create public key file %s: %v", keyOutPath, err)
+			}
+			defer f.Close()
+			w = f
+		}
+		switch keyFormat {
+		case "pem":
+			err = ca.WritePublicKey(w, objects[0].Public())
+		case "ssh":
+			err = ca.WriteSSHPublicKey(w, objects[0].Public(), objects[0].SSHComment)
+		default:
+			log.Fatalf("unknown format %s, must be one of: pem, ssh", keyFormat)
+		}
+		if err != nil {
+			log.Fatalf("failed to write public key: %v", err)
+		}
+	},
+}
+
+var keyFingerprintCmd = &cobra.Command{
+	Use:   "fingerprint <file>",
+	Short: "Print the fingerprint and pin of public keys",
+	Long: `Print the SHA-256 fingerprint of the SubjectPublicKeyInfo of each private key, certificate, CSR or public
+key in a file, or '-' for stdin, and its base64 pin, as used for certificate pinning by HPKP, OkHttp and Envoy.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		objects := readKeyObjects(args[0])
+		for i, obj := range objects {
+			pub := obj.Public()
+			pin, err := ca.SPKIPin(pub)
+			if err != nil {
+				log.Fatalf("failed to hash public key: %v", err)
+			}
+			if len(objects) > 1 {
+				fmt.Printf("[%d] %s\n", i+1, obj.Kind)
+			}
+			fmt.Printf("SHA256: %s\n", ca.DescribePublicKey(pub).Fingerprint)
+			fmt.Printf("Pin: sha256/%s\n", pin)
+		}
+	},
+}
+
+var keyCheckCmd = &cobra.Command{
+	Use:   "check <file>",
+	Short: "Check that keys are valid",
+	Long: `Check each private or public key in a file, or '-' for stdin: that RSA keys are consistent, and that ECDSA
+points are on their curve and those of the private scalar. Prints the result of each check, and exits non-zero if
+any failed.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		var checks []ca.MatchCheck
+		for _, obj := range readKeyObjects(args[0]) {
+			if obj.PrivateKey != nil {
+				checks = append(checks, ca.CheckKey(obj.PrivateKey)...)
+			} else {
+				checks = append(checks, ca.CheckPublicKey(obj.Public())...)
+			}
+		}
+		for _, c := range checks {
+			if c.OK {
+				fmt.Printf("OK\t%s\n", c.Name)
+			} else {
+				fmt.Printf("FAIL\t%s: %s\n", c.Name, c.Detail)
+			}
+		}
+		if err := ca.MatchError(checks); err != nil {
+			log.Fatalf("invalid key: %v", err)
+		}
+		fmt.Println("OK")
+	},
+}
+
+func keyInit() {
+	keyCmd.AddCommand(keyGenCmd)
+	keyGenCmd.Flags().StringVar(&keyTypeName, "key-type", "rsa", keyTypeHelp)
+	keyGenCmd.Flags().IntVar(&keySize, "key-size", 4096, keySizeHelp)
+	keyGenCmd.Flags().StringVar(&curveName, "curve", "P-256", curveHelp)
+	keyGenCmd.Flags().StringVar(&keyPassphrase, "key-passphrase", "", keyPassphraseHelp)
+	keyGenCmd.Flags().StringVar(&keyKDFName, "key-kdf", string(ca.KDFPBKDF2), keyKDFHelp)
+	keyGenCmd.Flags().StringVar(&keyPubPath, "pub", "", "path to save the public key, PEM-encoded, optional")
+
+	keyCmd.AddCommand(keyPubCmd)
+	keyPubCmd.Flags().StringVar(&keyOutPath, "out", "", "path to save the public key; defaults to stdout")
+	keyPubCmd.Flags().StringVar(&keyFormat, "format", "pem", "format of the public key, one of: pem, ssh")
+
+	keyCmd.AddCommand(keyFingerprintCmd)
+	keyCmd.AddCommand(keyCheckCmd)
+	for _, cmd := range []*cobra.Command{keyPubCmd, keyFingerprintCmd, keyCheckCmd} {
+		cmd.Flags().StringVar(&keyPassphrase, "key-passphrase", "", "source of the passphrase of the private key, if it is encrypted, one of: "+secretHelp+"; prompted for if not set")
+	}
+}
+
+// readKeyObjects reads the objects with a public key from the file at path, or stdin if path is "-",
+// exiting if there are none
+func readKeyObjects(path string) []ca.Object {
+	b, err := readFileOrStdin(path)
+	if err != nil {
+		log.Fatalf("failed to read file %s: %v", path, err)
+	}
+	objects, err := ca.ReadObjects(b, secretFrom(keyPassphrase, "passphrase for "+path))
+	if err != nil {
+		log.Fatalf("the file %s is not in a known format: %v", path, err)
+	}
+	var keys []ca.Object
+	for _, obj := range objects {
+		if obj.Err != nil {
+			log.Fatalf("failed to parse %s in %s: %v", obj.Kind, path, obj.Err)
+		}
+		if obj.Public() != nil {
+			keys = append(keys, obj)
+		}
+	}
+	if len(keys) == 0 {
+		log.Fatalf("no keys, certificates or CSRs in %s", path)
+	}
+	return keys
+}
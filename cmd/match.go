@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+
+	"github.com/deitch/ssl-tools/pkg/ca"
+	"github.com/spf13/cobra"
+)
+
+var matchChainPath string
+
+var matchCmd = &cobra.Command{
+	Use:   "match",
+	Short: "Check that a key, certificate, CSR and chain belong together",
+	Long: `Check that a private key is the key of a certificate and, optionally, of a CSR, that the CSR is for the
+certificate, and that each certificate in the chain is signed by the next. Prints the result of each check, and
+exits non-zero if any failed.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		b, err := ioutil.ReadFile(keyPath)
+		if err != nil {
+			log.Fatalf("failed to read key file %s: %v", keyPath, err)
+		}
+		opts := ca.MatchOptions{}
+		if opts.Key, err = ca.ParsePrivateKeyPEMWithPassword(b, secretFrom(keyPassphrase, "passphrase for "+keyPath)); err != nil {
+			log.Fatalf("failed to parse private key from %s: %v", keyPath, err)
+		}
+		certs, err := readCertificates(certPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		// any certificates following the first are taken to be its chain
+		opts.Cert, opts.Chain = certs[0], certs[1:]
+		if matchChainPath != "" {
+			chain, err := readCertificates(matchChainPath)
+			if err != nil {
+				log.Fatal(err)
+			}
+			opts.Chain = append(opts.Chain, chain...)
+		}
+		if csrPath != "" {
+			b, err := ioutil.ReadFile(csrPath)
+			if err != nil {
+				log.Fatalf("failed to read CSR file %s: %v", csrPath, err)
+			}
+			if opts.CSR, err = ca.ParseCSRPEM(b); err != nil {
+				log.Fatalf("failed to parse CSR from %s: %v", csrPath, err)
+			}
+		}
+
+		checks := ca.CheckMatch(opts)
+		for _, c := range checks {
+			if c.OK {
+				fmt.Printf("OK\t%s\n", c.Name)
+			} else {
+				fmt.Printf("FAIL\t%s: %s\n", c.Name, c.Detail)
+			}
+		}
+		if err := ca.MatchError(checks); err != nil {
+			log.Fatalf("mismatch: %v", err)
+		}
+		fmt.Println("OK")
+	},
+}
+
+func matchInit() {
+	matchCmd.Flags().StringVar(&keyPath, "key", "", "path to the private key")
+	_ = matchCmd.MarkFlagRequired("key")
+	matchCmd.Flags().StringVar(&keyPassphrase, "key-passphrase", "", "source of the passphrase of the private key, if it is encrypted, one of: "+secretHelp+"; prompted for if not set")
+	matchCmd.Flags().StringVar(&certPath, "cert", "", "path to the certificate, optionally followed by its chain")
+	_ = matchCmd.MarkFlagRequired("cert")
+	matchCmd.Flags().StringVar(&csrPath, "csr", "", "path to the CSR for the certificate, optional")
+	matchCmd.Flags().StringVar(&matchChainPath, "chain", "", "path to the chain of issuers of the certificate, each followed by its own issuer, optional")
+}
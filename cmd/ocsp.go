@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/deitch/ssl-tools/pkg/ca"
+	"github.com/spf13/cobra"
+)
+
+var (
+	responderCertPath, responderKeyPath, ocspListen string
+	responderKeyPassphrase                          string
+	ocspValidity                                    time.Duration
+)
+
+var ocspCmd = &cobra.Command{
+	Use:   "ocsp",
+	Short: "OCSP responder",
+	Long:  `Answer OCSP requests about the status of certificates issued by a CA`,
+}
+
+var ocspServeCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Run an OCSP responder over HTTP",
+	Long: `Run an RFC 6960 OCSP responder over HTTP, supporting GET and POST requests, answering from the
+CA's index of issued and revoked certificates. Responses are signed by the CA key, or by a delegated
+responder certificate with the OCSPSigning extended key usage, issued by the CA.`,
+	PreRun: func(cmd *cobra.Command, args []string) {
+		if caDir == "" && (caKeyPath == "" || caCertPath == "" || indexPath == "") {
+			log.Fatal("must specify either --ca-dir or all of --ca-key, --ca-cert and --index")
+		}
+		if (responderCertPath == "") != (responderKeyPath == "") {
+			log.Fatal("must specify both or neither of --responder-cert and --responder-key")
+		}
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		var (
+			authority *ca.CA
+			index     = ca.Index{Path: indexPath}
+			err       error
+		)
+		if caDir != "" {
+			store, err := ca.OpenStore(caDir, secretFrom(caKeyPassphrase, "passphrase for CA key"))
+			if err != nil {
+				log.Fatalf("failed to open CA directory %s: %v", caDir, err)
+			}
+			authority, index = store.CA, store.Index()
+		} else if authority, err = ca.LoadCA(caCertPath, caKeyPath, secretFrom(caKeyPassphrase, "passphrase for CA key")); err != nil {
+			log.Fatal(err)
+		}
+
+		// the responder certificate and key are loaded just like a CA's
+		signer := authority
+		if responderCertPath != "" {
+			if signer, err = ca.LoadCA(responderCertPath, responderKeyPath, secretFrom(responderKeyPassphrase, "passphrase for OCSP responder key")); err != nil {
+				log.Fatalf("failed to load OCSP responder cert/key: %v", err)
+			}
+		}
+		responder, err := ca.NewOCSPResponder(authority.Certificate, index, signer.Certificate, signer.Key)
+		if err != nil {
+			log.Fatal(err)
+		}
+		responder.Validity = ocspValidity
+
+		log.Printf("OCSP responder for %s listening on %s", authority.Certificate.Subject, ocspListen)
+		log.Fatal(http.ListenAndServe(ocspListen, responder))
+	},
+}
+
+func ocspInit() {
+	ocspCmd.AddCommand(ocspServeCmd)
+	ocspServeCmd.Flags().StringVar(&caDir, "ca-dir", "", "path to a CA store created with 'ca init --dir'; must specify --ca-dir or all of --ca-key, --ca-cert and --index")
+	ocspServeCmd.Flags().StringVar(&caKeyPath, "ca-key", "", "path to the CA key")
+	ocspServeCmd.Flags().StringVar(&caCertPath, "ca-cert", "", "path to the CA certificate")
+	ocspServeCmd.Flags().StringVar(&caKeyPassphrase, "ca-key-passphrase", "", caKeyPassphraseHelp)
+	ocspServeCmd.Flags().StringVar(&indexPath, "index", "", "path to the index of issued certificates")
+	ocspServeCmd.Flags().StringVar(&responderCertPath, "responder-cert", "", "path to a delegated OCSP responder certificate with the OCSPSigning extended key usage, optional")
+	ocspServeCmd.Flags().StringVar(&responderKeyPath, "responder-key", "", "path to the key of the delegated OCSP responder certificate")
+	ocspServeCmd.Flags().StringVar(&responderKeyPassphrase, "responder-key-passphrase", "", "source of the passphrase of the responder key, if it is encrypted, one of: "+secretHelp+"; prompted for if not set")
+	ocspServeCmd.Flags().StringVar(&ocspListen, "listen", ":8080", "address on which to listen for OCSP requests")
+	ocspServeCmd.Flags().DurationVar(&ocspValidity, "validity", time.Hour*24, "how long each OCSP response is valid")
+}
@@ -6,70 +6,166 @@ import (
 	"crypto/ed25519"
 	"crypto/rsa"
 	"crypto/x509"
-	"encoding/pem"
-	"errors"
+	"encoding/json"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"log"
+	"os"
+	"sort"
 	"strings"
 
+	"github.com/deitch/ssl-tools/pkg/ca"
 	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+	"gopkg.in/yaml.v3"
 )
 
 var readCmd = &cobra.Command{
 	Use:   "read <file>",
-	Short: "Read a certificate, CSR or key",
-	Long:  `Read a certificate, CSR or key`,
-	Args:  cobra.MinimumNArgs(1),
+	Short: "Read certificates, CSRs, keys, CRLs and bundles",
+	Long: `Read every object in a file, or '-' for stdin, printing a numbered summary of each, and which
+private keys match which certificates. Reads certificates, CSRs, private and public keys, CRLs,
+PKCS#7 bundles and PKCS#12 files, PEM or DER, and OpenSSH keys and certificates. Prompts for the
+password of an encrypted PKCS#12 file or private key, unless given with --password.`,
+	Args: cobra.MinimumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
 		readPath := args[0]
 		// open and read the file
-		b, err := ioutil.ReadFile(readPath)
+		b, err := readFileOrStdin(readPath)
 		if err != nil {
 			log.Fatalf("failed to read file %s: %v", readPath, err)
 		}
-		der, _ := pem.Decode(b)
-		if der == nil {
-			log.Fatalf("no valid PEM in file %s: %v", readPath, err)
+		password := ca.PasswordFunc(promptPassword)
+		if readPassword != "" {
+			password = secretFrom(readPassword, "password")
 		}
-		switch {
-		case der.Type == "CERTIFICATE":
-			cert, err := x509.ParseCertificate(der.Bytes)
-			if err != nil {
-				log.Fatalf("failed to parse certificate: %v", err)
-			}
-			printCert(cert)
-		case der.Type == "PRIVATE KEY" || strings.HasSuffix(der.Type, " PRIVATE KEY"):
-			key, err := parsePrivateKey(der.Bytes)
-			if err != nil {
-				log.Fatalf("failed to parse private key: %v", err)
-			}
-			printKey(key)
-		case der.Type == "CERTIFICATE REQUEST":
-			csr, err := x509.ParseCertificateRequest(der.Bytes)
-			if err != nil {
-				log.Fatalf("unable to parse certificate signing request: %v", err)
-			}
-			printCsr(csr)
+		objects, err := ca.ReadObjects(b, password)
+		if err != nil {
+			log.Fatalf("the file %s is not in a known format: %v", readPath, err)
+		}
+		var failed int
+		switch readOutput {
+		case "json", "yaml":
+			failed = writeObjectInfo(os.Stdout, readPath, objects, readOutput)
+		case "text":
+			failed = printObjects(objects)
 		default:
-			// failed, error
-			log.Fatalf("the file %s is not a key, certificate or signing request", readPath)
+			log.Fatalf("unknown output format %s, must be one of: text, json, yaml", readOutput)
+		}
+		if failed > 0 {
+			log.Fatalf("failed to parse %d of %d objects in %s", failed, len(objects), readPath)
 		}
 	},
 }
 
-func parsePrivateKey(der []byte) (crypto.PrivateKey, error) {
-	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
-		return key, nil
+// readDocument is the structured output of ca read
+type readDocument struct {
+	File    string          `json:"file" yaml:"file"`
+	Objects []ca.ObjectInfo `json:"objects" yaml:"objects"`
+}
+
+// writeObjectInfo writes the objects in format json or yaml, returning how many failed to parse
+func writeObjectInfo(w io.Writer, file string, objects []ca.Object, format string) int {
+	doc := readDocument{File: file, Objects: ca.DescribeObjects(objects)}
+	var err error
+	if format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(doc)
+	} else {
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		err = enc.Encode(doc)
 	}
-	if key, err := x509.ParsePKCS8PrivateKey(der); err == nil {
-		return key, nil
+	if err != nil {
+		log.Fatalf("failed to write %s: %v", format, err)
+	}
+	var failed int
+	for _, obj := range objects {
+		if obj.Err != nil {
+			failed++
+		}
+	}
+	return failed
+}
+
+// printObjects prints a numbered summary of the objects, returning how many failed to parse
+func printObjects(objects []ca.Object) int {
+	var failed int
+	for i, obj := range objects {
+		fmt.Printf("[%d] ", i+1)
+		switch {
+		case obj.Err != nil:
+			failed++
+			fmt.Printf("%s\n\tfailed to parse: %v\n", objectType(obj), obj.Err)
+		case obj.Kind == ca.KindCertificate && readDetail:
+			printCertDetail(obj.Certificate)
+		case obj.Kind == ca.KindCertificate:
+			printCert(obj.Certificate)
+		case obj.Kind == ca.KindPrivateKey && readDetail:
+			printKeyDetail(obj.PrivateKey)
+		case obj.Kind == ca.KindPrivateKey:
+			printKey(obj.PrivateKey)
+		case obj.Kind == ca.KindCSR && readDetail:
+			printCsrDetail(obj.CSR)
+		case obj.Kind == ca.KindCSR:
+			printCsr(obj.CSR)
+		case obj.Kind == ca.KindPublicKey:
+			fmt.Printf("PUBLIC KEY\n")
+			printPublicKeyDetail(obj.PublicKey)
+		case obj.Kind == ca.KindCRL:
+			printCRL(obj.CRL)
+		case obj.Kind == ca.KindPKCS7 || obj.Kind == ca.KindPKCS12:
+			printBundle(i+1, obj)
+		case obj.Kind == ca.KindSSHPublicKey:
+			fmt.Printf("SSH PUBLIC KEY\n")
+			printSSHPublicKey(obj.SSHPublicKey, obj.SSHComment)
+		case obj.Kind == ca.KindSSHCertificate:
+			printSSHCertificate(obj.SSHCertificate, obj.SSHComment)
+		case obj.Kind == ca.KindSSHPrivateKey:
+			printSSHPrivateKey(obj.PrivateKey)
+		}
 	}
-	if key, err := x509.ParseECPrivateKey(der); err == nil {
-		return key, nil
+	printKeyMatches(objects)
+	return failed
+}
+
+// objectType names the type of an object, as in its PEM block if it has one
+func objectType(obj ca.Object) string {
+	if obj.PEMType != "" {
+		return obj.PEMType
 	}
+	return strings.ToUpper(string(obj.Kind))
+}
 
-	return nil, errors.New("tls: failed to parse private key")
+// printKeyMatches prints which certificate, if any, each private key matches
+func printKeyMatches(objects []ca.Object) {
+	var keys, certs []int
+	for i, obj := range objects {
+		switch {
+		case obj.Err != nil:
+		case obj.Kind == ca.KindPrivateKey || obj.Kind == ca.KindSSHPrivateKey:
+			keys = append(keys, i)
+		case obj.Kind == ca.KindCertificate:
+			certs = append(certs, i)
+		}
+	}
+	if len(keys) == 0 || len(certs) == 0 {
+		return
+	}
+	fmt.Printf("KEY MATCHES\n")
+	for _, k := range keys {
+		var matched bool
+		for _, c := range certs {
+			if ca.KeyMatches(objects[k].PrivateKey, objects[c].Certificate.PublicKey) {
+				fmt.Printf("\tprivate key [%d] matches certificate [%d] %s\n", k+1, c+1, objects[c].Certificate.Subject)
+				matched = true
+			}
+		}
+		if !matched {
+			fmt.Printf("\tprivate key [%d] matches no certificate\n", k+1)
+		}
+	}
 }
 
 func printCert(cert *x509.Certificate) {
@@ -78,10 +174,10 @@ func printCert(cert *x509.Certificate) {
 	fmt.Printf("\tIssuer: %s\n", cert.Issuer.String())
 	fmt.Printf("\tValid from: %s\n", cert.NotBefore)
 	fmt.Printf("\tValid until: %s\n", cert.NotAfter)
-	fmt.Printf("\tKey Usage: %s\n", strings.Join(parseKeyUsage(cert.KeyUsage), ","))
-	fmt.Printf("\tExtended Key Usage: %s\n", strings.Join(parseExtKeyUsage(cert.ExtKeyUsage), ","))
+	fmt.Printf("\tKey Usage: %s\n", strings.Join(ca.KeyUsageStrings(cert.KeyUsage), ","))
+	fmt.Printf("\tExtended Key Usage: %s\n", strings.Join(ca.ExtKeyUsageStrings(cert.ExtKeyUsage, cert.UnknownExtKeyUsage), ","))
 	fmt.Printf("\tCA: %v\n", cert.IsCA)
-	fmt.Printf("\tSAN: %v %v\n", cert.DNSNames, cert.IPAddresses)
+	printSANs(ca.SANsFromCertificate(cert))
 }
 func printKey(rawKey crypto.PrivateKey) {
 	switch rawKey.(type) {
@@ -99,79 +195,127 @@ func printKey(rawKey crypto.PrivateKey) {
 func printCsr(csr *x509.CertificateRequest) {
 	fmt.Printf("CERTIFICATE REQUEST\n")
 	fmt.Printf("\tSubject: %s\n", csr.Subject.String())
-	fmt.Printf("\tSAN: %v %v\n", csr.DNSNames, csr.IPAddresses)
-}
-
-func parseKeyUsage(u x509.KeyUsage) []string {
-	ret := make([]string, 0)
-	if u&x509.KeyUsageDigitalSignature == x509.KeyUsageDigitalSignature {
-		ret = append(ret, "DigitalSignature")
-	}
-	if u&x509.KeyUsageContentCommitment == x509.KeyUsageContentCommitment {
-		ret = append(ret, "ContentCommitment")
-	}
-	if u&x509.KeyUsageKeyEncipherment == x509.KeyUsageKeyEncipherment {
-		ret = append(ret, "KeyEncipherment")
-	}
-	if u&x509.KeyUsageDataEncipherment == x509.KeyUsageDataEncipherment {
-		ret = append(ret, "DataEncipherment")
-	}
-	if u&x509.KeyUsageKeyAgreement == x509.KeyUsageKeyAgreement {
-		ret = append(ret, "KeyAgreement")
-	}
-	if u&x509.KeyUsageCertSign == x509.KeyUsageCertSign {
-		ret = append(ret, "CertSign")
-	}
-	if u&x509.KeyUsageCRLSign == x509.KeyUsageCRLSign {
-		ret = append(ret, "CRLSign")
-	}
-	if u&x509.KeyUsageEncipherOnly == x509.KeyUsageEncipherOnly {
-		ret = append(ret, "EncipherOnly")
-	}
-	if u&x509.KeyUsageDecipherOnly == x509.KeyUsageDecipherOnly {
-		ret = append(ret, "DecipherOnly")
-	}
-	return ret
-}
-
-func parseExtKeyUsage(usages []x509.ExtKeyUsage) []string {
-	ret := make([]string, 0)
-
-	for _, u := range usages {
-		switch u {
-		case x509.ExtKeyUsageAny:
-			ret = append(ret, "Any")
-		case x509.ExtKeyUsageServerAuth:
-			ret = append(ret, "ServerAuth")
-		case x509.ExtKeyUsageClientAuth:
-			ret = append(ret, "ClientAuth")
-		case x509.ExtKeyUsageCodeSigning:
-			ret = append(ret, "CodeSigning")
-		case x509.ExtKeyUsageEmailProtection:
-			ret = append(ret, "EmailProtection")
-		case x509.ExtKeyUsageIPSECEndSystem:
-			ret = append(ret, "IPSECEndSystem")
-		case x509.ExtKeyUsageIPSECTunnel:
-			ret = append(ret, "IPSECTunnel")
-		case x509.ExtKeyUsageIPSECUser:
-			ret = append(ret, "IPSECUser")
-		case x509.ExtKeyUsageTimeStamping:
-			ret = append(ret, "TimeStamping")
-		case x509.ExtKeyUsageOCSPSigning:
-			ret = append(ret, "OCSPSigning")
-		case x509.ExtKeyUsageMicrosoftServerGatedCrypto:
-			ret = append(ret, "MicrosoftServerGatedCrypto")
-		case x509.ExtKeyUsageNetscapeServerGatedCrypto:
-			ret = append(ret, "NetscapeServerGatedCrypto")
-		case x509.ExtKeyUsageMicrosoftCommercialCodeSigning:
-			ret = append(ret, "MicrosoftCommercialCodeSigning")
-		case x509.ExtKeyUsageMicrosoftKernelCodeSigning:
-			ret = append(ret, "MicrosoftKernelCodeSigning")
+	printSANs(ca.SANsFromCSR(csr))
+}
+
+func printCRL(crl *ca.CRL) {
+	fmt.Printf("CRL\n")
+	fmt.Printf("\tIssuer: %s\n", crl.Issuer.String())
+	if crl.Number != nil {
+		fmt.Printf("\tNumber: %s\n", crl.Number)
+	}
+	fmt.Printf("\tThis update: %s\n", crl.ThisUpdate)
+	if !crl.NextUpdate.IsZero() {
+		fmt.Printf("\tNext update: %s\n", crl.NextUpdate)
+	}
+	fmt.Printf("\tRevoked: %d\n", len(crl.Revoked))
+	for _, rc := range crl.Revoked {
+		fmt.Printf("\t\t%s revoked at %s, reason %s\n", ca.SerialString(rc.SerialNumber), rc.RevokedAt, rc.Reason)
+	}
+}
+
+// printBundle prints the key and certificates in a PKCS#7 or PKCS#12 file, numbered within the object
+func printBundle(index int, obj ca.Object) {
+	fmt.Printf("%s, %d certificates\n", objectType(obj), len(obj.Certificates))
+	n := 1
+	if obj.PrivateKey != nil {
+		fmt.Printf("[%d.%d] ", index, n)
+		if readDetail {
+			printKeyDetail(obj.PrivateKey)
+		} else {
+			printKey(obj.PrivateKey)
+		}
+		if len(obj.Certificates) > 0 && ca.KeyMatches(obj.PrivateKey, obj.Certificates[0].PublicKey) {
+			fmt.Printf("\tmatches certificate [%d.%d]\n", index, n+1)
 		}
+		n++
 	}
+	for _, cert := range obj.Certificates {
+		fmt.Printf("[%d.%d] ", index, n)
+		if readDetail {
+			printCertDetail(cert)
+		} else {
+			printCert(cert)
+		}
+		n++
+	}
+}
 
-	return ret
+func printSSHPublicKey(pub ssh.PublicKey, comment string) {
+	info := ca.DescribeSSHPublicKey(pub, comment)
+	fmt.Printf("\tType: %s\n", info.Type)
+	if info.PublicKey.Size > 0 {
+		fmt.Printf("\tSize: %d bits\n", info.PublicKey.Size)
+	}
+	fmt.Printf("\tFingerprint: %s\n", info.Fingerprint)
+	if comment != "" {
+		fmt.Printf("\tComment: %s\n", comment)
+	}
+}
+
+func printSSHCertificate(cert *ssh.Certificate, comment string) {
+	info := ca.DescribeSSHCertificate(cert, comment).Certificate
+	fmt.Printf("SSH CERTIFICATE\n")
+	fmt.Printf("\tCertificate type: %s\n", info.CertType)
+	fmt.Printf("\tKey ID: %s\n", info.KeyID)
+	fmt.Printf("\tSerial: %d\n", info.Serial)
+	fmt.Printf("\tPrincipals: %s\n", strings.Join(info.Principals, ","))
+	fmt.Printf("\tValid from: %s\n", info.ValidAfter)
+	if info.ValidBefore != nil {
+		fmt.Printf("\tValid until: %s\n", *info.ValidBefore)
+	} else {
+		fmt.Printf("\tValid until: forever\n")
+	}
+	fmt.Printf("\tSigning CA: %s %s\n", cert.SignatureKey.Type(), info.CAFingerprint)
+	printSSHOptions("Critical option", info.CriticalOptions)
+	printSSHOptions("Extension", info.Extensions)
+	fmt.Printf("\tCertified key:\n")
+	printSSHPublicKey(cert.Key, comment)
 }
 
+// printSSHOptions prints SSH certificate options or extensions, sorted by name
+func printSSHOptions(label string, options map[string]string) {
+	names := make([]string, 0, len(options))
+	for name := range options {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if options[name] == "" {
+			fmt.Printf("\t%s: %s\n", label, name)
+		} else {
+			fmt.Printf("\t%s: %s %s\n", label, name, options[name])
+		}
+	}
+}
+
+func printSSHPrivateKey(key crypto.PrivateKey) {
+	fmt.Printf("OPENSSH ")
+	printKey(key)
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return
+	}
+	if pub, err := ssh.NewPublicKey(signer.Public()); err == nil {
+		printSSHPublicKey(pub, "")
+	}
+}
+
+func printSANs(sans *ca.SANs, err error) {
+	if err != nil {
+		fmt.Printf("\tSAN: invalid: %v\n", err)
+		return
+	}
+	fmt.Printf("\tSAN: %s\n", strings.Join(sans.Strings(), ","))
+}
+
+var (
+	readOutput, readPassword string
+	readDetail               bool
+)
+
 func readInit() {
+	readCmd.Flags().StringVarP(&readOutput, "output", "o", "text", "output format, one of: text, json, yaml")
+	readCmd.Flags().StringVar(&readPassword, "password", "", "source of the password of PKCS#12 files and passphrase of encrypted private keys, one of: "+secretHelp+"; prompted for if not set")
+	readCmd.Flags().BoolVar(&readDetail, "detail", false, "print every detail of each object, comparable to 'openssl x509 -text', with text output")
 }
@@ -0,0 +1,213 @@
+package cmd
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/deitch/ssl-tools/pkg/ca"
+)
+
+// extensions shown by printCertDetail in their own fields, by their ca.ExtensionName, rather than as
+// unknown extensions
+var detailedExtensions = map[string]bool{
+	"subjectKeyIdentifier":   true,
+	"keyUsage":               true,
+	"subjectAltName":         true,
+	"basicConstraints":       true,
+	"nameConstraints":        true,
+	"cRLDistributionPoints":  true,
+	"certificatePolicies":    true,
+	"authorityKeyIdentifier": true,
+	"extKeyUsage":            true,
+	"authorityInfoAccess":    true,
+}
+
+// extensions shown by printCsrDetail in their own fields
+var detailedRequestExtensions = map[string]bool{
+	"keyUsage":         true,
+	"subjectAltName":   true,
+	"basicConstraints": true,
+	"extKeyUsage":      true,
+}
+
+func printCertDetail(cert *x509.Certificate) {
+	fmt.Printf("CERTIFICATE\n")
+	fmt.Printf("\tVersion: %d\n", cert.Version)
+	fmt.Printf("\tSerial: %s\n", ca.ColonHex(cert.SerialNumber.Bytes()))
+	fmt.Printf("\tSignature Algorithm: %s\n", cert.SignatureAlgorithm)
+	fmt.Printf("\tSubject: %s\n", cert.Subject.String())
+	fmt.Printf("\tIssuer: %s\n", cert.Issuer.String())
+	fmt.Printf("\tValid from: %s\n", cert.NotBefore)
+	fmt.Printf("\tValid until: %s\n", cert.NotAfter)
+	printPublicKeyDetail(cert.PublicKey)
+	fmt.Printf("\tKey Usage%s: %s\n", critical(cert.Extensions, "keyUsage"), strings.Join(ca.KeyUsageStrings(cert.KeyUsage), ","))
+	fmt.Printf("\tExtended Key Usage%s: %s\n", critical(cert.Extensions, "extKeyUsage"), strings.Join(ca.ExtKeyUsageStrings(cert.ExtKeyUsage, cert.UnknownExtKeyUsage), ","))
+	if cert.BasicConstraintsValid {
+		pathLen := "unlimited"
+		if cert.MaxPathLen > 0 || cert.MaxPathLenZero {
+			pathLen = fmt.Sprint(cert.MaxPathLen)
+		}
+		if cert.IsCA {
+			fmt.Printf("\tCA%s: true, path length: %s\n", critical(cert.Extensions, "basicConstraints"), pathLen)
+		} else {
+			fmt.Printf("\tCA%s: false\n", critical(cert.Extensions, "basicConstraints"))
+		}
+	}
+	printSANs(ca.SANsFromCertificate(cert))
+	if len(cert.SubjectKeyId) > 0 {
+		fmt.Printf("\tSubject Key Identifier: %s\n", ca.ColonHex(cert.SubjectKeyId))
+	}
+	if len(cert.AuthorityKeyId) > 0 {
+		fmt.Printf("\tAuthority Key Identifier: %s\n", ca.ColonHex(cert.AuthorityKeyId))
+	}
+	printList("CRL Distribution Points", cert.CRLDistributionPoints)
+	printList("OCSP", cert.OCSPServer)
+	printList("CA Issuers", cert.IssuingCertificateURL)
+	var policies []string
+	for _, p := range cert.PolicyIdentifiers {
+		policies = append(policies, p.String())
+	}
+	printList("Certificate Policies", policies)
+	printNameConstraints(cert)
+	printUnknownExtensions(cert.Extensions, detailedExtensions)
+	fmt.Printf("\tFingerprint SHA-1: %s\n", ca.Fingerprint(sha1.New(), cert.Raw))
+	fmt.Printf("\tFingerprint SHA-256: %s\n", ca.Fingerprint(sha256.New(), cert.Raw))
+}
+
+func printCsrDetail(csr *x509.CertificateRequest) {
+	fmt.Printf("CERTIFICATE REQUEST\n")
+	fmt.Printf("\tSubject: %s\n", csr.Subject.String())
+	fmt.Printf("\tSignature Algorithm: %s\n", csr.SignatureAlgorithm)
+	if err := csr.CheckSignature(); err != nil {
+		fmt.Printf("\tSignature: INVALID: %v\n", err)
+	} else {
+		fmt.Printf("\tSignature: valid\n")
+	}
+	printPublicKeyDetail(csr.PublicKey)
+	printSANs(ca.SANsFromCSR(csr))
+	if requested, err := ca.ParseRequestedExtensions(csr); err != nil {
+		fmt.Printf("\tRequested extensions: invalid: %v\n", err)
+	} else {
+		if requested.KeyUsage != 0 {
+			fmt.Printf("\tRequested Key Usage: %s\n", strings.Join(ca.KeyUsageStrings(requested.KeyUsage), ","))
+		}
+		if len(requested.ExtKeyUsage)+len(requested.UnknownExtKeyUsage) > 0 {
+			fmt.Printf("\tRequested Extended Key Usage: %s\n", strings.Join(ca.ExtKeyUsageStrings(requested.ExtKeyUsage, requested.UnknownExtKeyUsage), ","))
+		}
+		if requested.BasicConstraints {
+			fmt.Printf("\tRequested CA: %v\n", requested.IsCA)
+		}
+	}
+	printUnknownExtensions(csr.Extensions, detailedRequestExtensions)
+	attributes, err := ca.CSRAttributes(csr)
+	if err != nil {
+		fmt.Printf("\tAttributes: invalid: %v\n", err)
+		return
+	}
+	for _, attr := range attributes {
+		// extension requests are shown above
+		if attr.Name() == "extensionRequest" {
+			continue
+		}
+		fmt.Printf("\tAttribute %s: %s\n", attr.Name(), strings.Join(attr.Values, ", "))
+	}
+}
+
+func printKeyDetail(key crypto.PrivateKey) {
+	printKey(key)
+	if signer, ok := key.(crypto.Signer); ok {
+		printPublicKeyDetail(signer.Public())
+	}
+}
+
+func printPublicKeyDetail(pub crypto.PublicKey) {
+	info := ca.DescribePublicKey(pub)
+	desc := fmt.Sprintf("%s %d bits", info.Algorithm, info.Size)
+	if info.Curve != "" {
+		desc += ", curve " + info.Curve
+	}
+	if rsaKey, ok := pub.(*rsa.PublicKey); ok {
+		desc += fmt.Sprintf(", exponent %d", rsaKey.E)
+	}
+	fmt.Printf("\tPublic Key: %s\n", desc)
+	fmt.Printf("\tPublic Key Fingerprint SHA-256: %s\n", info.Fingerprint)
+}
+
+func printNameConstraints(cert *x509.Certificate) {
+	var permitted, excluded []string
+	permitted = append(permitted, prefixed("DNS:", cert.PermittedDNSDomains)...)
+	permitted = append(permitted, prefixed("IP:", ipNetStrings(cert.PermittedIPRanges))...)
+	permitted = append(permitted, prefixed("email:", cert.PermittedEmailAddresses)...)
+	permitted = append(permitted, prefixed("URI:", cert.PermittedURIDomains)...)
+	excluded = append(excluded, prefixed("DNS:", cert.ExcludedDNSDomains)...)
+	excluded = append(excluded, prefixed("IP:", ipNetStrings(cert.ExcludedIPRanges))...)
+	excluded = append(excluded, prefixed("email:", cert.ExcludedEmailAddresses)...)
+	excluded = append(excluded, prefixed("URI:", cert.ExcludedURIDomains)...)
+	if len(permitted)+len(excluded) == 0 {
+		return
+	}
+	fmt.Printf("\tName Constraints%s:\n", critical(cert.Extensions, "nameConstraints"))
+	printList("\tPermitted", permitted)
+	printList("\tExcluded", excluded)
+}
+
+// printUnknownExtensions prints the extensions whose names are not in known, with their values in hex
+func printUnknownExtensions(extensions []pkix.Extension, known map[string]bool) {
+	for _, ext := range extensions {
+		n := ca.ExtensionName(ext.Id)
+		if known[n] {
+			continue
+		}
+		name := ext.Id.String()
+		if n != "" {
+			name = fmt.Sprintf("%s (%s)", n, name)
+		}
+		fmt.Printf("\tExtension %s%s: %s\n", name, criticalSuffix(ext.Critical), ca.ColonHex(ext.Value))
+	}
+}
+
+func printList(name string, values []string) {
+	if len(values) > 0 {
+		fmt.Printf("\t%s: %s\n", name, strings.Join(values, ", "))
+	}
+}
+
+// critical returns " (critical)" if the extension with the ca.ExtensionName name is critical
+func critical(extensions []pkix.Extension, name string) string {
+	for _, ext := range extensions {
+		if ca.ExtensionName(ext.Id) == name {
+			return criticalSuffix(ext.Critical)
+		}
+	}
+	return ""
+}
+
+func criticalSuffix(c bool) string {
+	if c {
+		return " (critical)"
+	}
+	return ""
+}
+
+func prefixed(prefix string, values []string) []string {
+	ret := make([]string, 0, len(values))
+	for _, v := range values {
+		ret = append(ret, prefix+v)
+	}
+	return ret
+}
+
+func ipNetStrings(nets []*net.IPNet) []string {
+	ret := make([]string, 0, len(nets))
+	for _, n := range nets {
+		ret = append(ret, n.String())
+	}
+	return ret
+}
@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"crypto/x509"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/deitch/ssl-tools/pkg/ca"
+	"github.com/spf13/cobra"
+)
+
+var (
+	indexPath, revokeSerial, revokeReason string
+)
+
+var revokeCmd = &cobra.Command{
+	Use:   "revoke",
+	Short: "Revoke a certificate",
+	Long: `Revoke a certificate issued by a CA, marking it revoked in the CA's index, so that it is
+included in the next CRL generated by 'ca crl'. The certificate is identified either by its
+serial number in hex, or by the certificate file itself.`,
+	PreRun: func(cmd *cobra.Command, args []string) {
+		if caDir == "" && indexPath == "" {
+			log.Fatal("must specify one of --ca-dir or --index")
+		}
+		if (revokeSerial == "") == (certPath == "") {
+			log.Fatal("must specify exactly one of --serial or --cert")
+		}
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		reason, err := ca.ParseRevocationReason(revokeReason)
+		if err != nil {
+			log.Fatal(err)
+		}
+		index := ca.Index{Path: indexPath}
+		var store *ca.Store
+		if caDir != "" {
+			if store, err = ca.OpenStore(caDir, secretFrom(caKeyPassphrase, "passphrase for CA key")); err != nil {
+				log.Fatalf("failed to open CA directory %s: %v", caDir, err)
+			}
+			index = store.Index()
+		}
+
+		var serial *big.Int
+		if certPath != "" {
+			b, err := ioutil.ReadFile(certPath)
+			if err != nil {
+				log.Fatalf("failed to read cert file %s: %v", certPath, err)
+			}
+			cert, err := ca.ParseCertificatePEM(b)
+			if err != nil {
+				log.Fatalf("failed to parse certificate from %s: %v", certPath, err)
+			}
+			serial = cert.SerialNumber
+			if store != nil {
+				if err := recordIfMissing(store, cert); err != nil {
+					log.Fatalf("failed to add certificate %s to index: %v", certPath, err)
+				}
+			}
+		} else {
+			var ok bool
+			if serial, ok = new(big.Int).SetString(strings.TrimPrefix(strings.ReplaceAll(revokeSerial, ":", ""), "0x"), 16); !ok {
+				log.Fatalf("invalid serial number %s, must be hex", revokeSerial)
+			}
+		}
+
+		entry, err := index.Revoke(serial, reason, time.Now())
+		if err != nil {
+			log.Fatalf("failed to revoke: %v", err)
+		}
+		log.Printf("revoked certificate %s %s: %s", entry.Serial, entry.Subject, entry.RevocationReason)
+	},
+}
+
+// recordIfMissing adds a certificate signed by the store's CA to its index, if it is not already there,
+// so that certificates issued outside of the store can be revoked
+func recordIfMissing(store *ca.Store, cert *x509.Certificate) error {
+	existing, err := store.Index().Lookup(cert.SerialNumber)
+	if err != nil || existing != nil {
+		return err
+	}
+	if err := cert.CheckSignatureFrom(store.CA.Certificate); err != nil {
+		return err
+	}
+	return store.Record(cert)
+}
+
+func revokeInit() {
+	revokeCmd.Flags().StringVar(&caDir, "ca-dir", "", "path to a CA store created with 'ca init --dir'; must specify one of --ca-dir or --index")
+	revokeCmd.Flags().StringVar(&caKeyPassphrase, "ca-key-passphrase", "", caKeyPassphraseHelp)
+	revokeCmd.Flags().StringVar(&indexPath, "index", "", "path to the index of issued certificates; must specify one of --ca-dir or --index")
+	revokeCmd.Flags().StringVar(&revokeSerial, "serial", "", "serial number in hex of the certificate to revoke; must specify one of --serial or --cert")
+	revokeCmd.Flags().StringVar(&certPath, "cert", "", "path to the certificate to revoke; must specify one of --serial or --cert")
+	revokeCmd.Flags().StringVar(&revokeReason, "reason", "unspecified", "RFC 5280 revocation reason, one of: "+strings.Join(ca.RevocationReasonNames(), ", "))
+}
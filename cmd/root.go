@@ -20,6 +20,20 @@ func init() {
 	csrInit()
 	rootCmd.AddCommand(convertCmd)
 	convertInit()
+	rootCmd.AddCommand(revokeCmd)
+	revokeInit()
+	rootCmd.AddCommand(crlCmd)
+	crlInit()
+	rootCmd.AddCommand(ocspCmd)
+	ocspInit()
+	rootCmd.AddCommand(verifyCmd)
+	verifyInit()
+	rootCmd.AddCommand(fetchCmd)
+	fetchInit()
+	rootCmd.AddCommand(matchCmd)
+	matchInit()
+	rootCmd.AddCommand(keyCmd)
+	keyInit()
 	rootCmd.PersistentFlags().BoolVar(&verbose, "verbose", false, "print lots of output to stderr")
 }
 
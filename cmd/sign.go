@@ -1,34 +1,87 @@
 package cmd
 
 import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"strings"
+
+	"github.com/deitch/ssl-tools/pkg/ca"
 	"github.com/spf13/cobra"
 )
 
 var (
 	keyPath, certPath string
 	keyTypeName       string
-	keyType           KeyType
+	profileName       string
+	profilesPath      string
 )
 
 var signCmd = &cobra.Command{
-	Use:              "sign",
-	Short:            "Sign a CSR or generate and sign it",
-	Long:             `Sign an existing CSR, or generate a key and CSR and sign it.`,
-	PersistentPreRun: validateKeyType,
+	Use:   "sign",
+	Short: "Sign a CSR or generate and sign it",
+	Long:  `Sign an existing CSR, or generate a key and CSR and sign it, or certify a public key.`,
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		validateKeyOptions(cmd, args)
+		if caDir == "" && (caKeyPath == "" || caCertPath == "") {
+			log.Fatal("must specify either --ca-dir or both --ca-key and --ca-cert")
+		}
+	},
 	Run: func(cmd *cobra.Command, args []string) {
 	},
 }
 
 func signInit() {
-	signCmd.PersistentFlags().StringVar(&caKeyPath, "ca-key", "", "path to the CA key to use to sign the output certificate")
-	_ = signCmd.MarkFlagRequired("ca-key")
-	signCmd.PersistentFlags().StringVar(&caCertPath, "ca-cert", "", "path to the CA certificate to use to sign the output certificate")
-	_ = signCmd.MarkFlagRequired("ca-cert")
+	signCmd.PersistentFlags().StringVar(&caKeyPath, "ca-key", "", "path to the CA key to use to sign the output certificate; must specify --ca-dir or both --ca-key and --ca-cert")
+	signCmd.PersistentFlags().StringVar(&caKeyPassphrase, "ca-key-passphrase", "", caKeyPassphraseHelp)
+	signCmd.PersistentFlags().StringVar(&caCertPath, "ca-cert", "", "path to the CA certificate to use to sign the output certificate; must specify --ca-dir or both --ca-key and --ca-cert")
+	signCmd.PersistentFlags().StringVar(&caDir, "ca-dir", "", "path to a CA store created with 'ca init --dir', which assigns unique serial numbers and records each certificate issued")
 
-	signCmd.PersistentFlags().IntVar(&keySize, "key-size", 4096, "key size to use")
-	signCmd.PersistentFlags().StringVar(&keyTypeName, "key-type", "rsa", "key type to use, one of: rsa, ecdsa, ed25519")
+	signCmd.PersistentFlags().StringVar(&subjectEncoding, "subject-encoding", "default", subjectEncodingHelp)
+	signCmd.PersistentFlags().StringVar(&profileName, "profile", "", "certificate profile, determining key usage, extended key usage, basic constraints and default validity; one of the built-in server, client, peer, code-signing, email, ocsp-signing, timestamping, intermediate-ca, or one defined in --profile-file")
+	signCmd.PersistentFlags().StringVar(&profilesPath, "profile-file", "", "path to a YAML file defining additional certificate profiles")
+	signCmd.PersistentFlags().IntVar(&certDays, "days", 365, "days for certificate validity; defaults to the validity of the profile")
+	signCmd.PersistentFlags().IntVar(&keySize, "key-size", 4096, keySizeHelp)
+	signCmd.PersistentFlags().StringVar(&keyTypeName, "key-type", "rsa", keyTypeHelp)
+	signCmd.PersistentFlags().StringVar(&curveName, "curve", "P-256", curveHelp)
+	signCmd.PersistentFlags().StringVar(&sigAlgName, "sig-alg", "", sigAlgHelp("certificate", "CA key"))
 	signCmd.AddCommand(signCsrCmd)
 	signCsrInit()
 	signCmd.AddCommand(signSubjectCmd)
 	signSubjectInit()
+	signCmd.AddCommand(signPubKeyCmd)
+	signPubKeyInit()
+	signCmd.AddCommand(signIntermediateCmd)
+	signIntermediateInit()
+}
+
+// loadProfile returns the profile named by --profile, or defaultName if it is not set
+func loadProfile(defaultName string) (ca.Profile, error) {
+	profiles := ca.BuiltinProfiles()
+	if profilesPath != "" {
+		b, err := ioutil.ReadFile(profilesPath)
+		if err != nil {
+			return ca.Profile{}, fmt.Errorf("failed to read profile file %s: %v", profilesPath, err)
+		}
+		if profiles, err = ca.ParseProfiles(b); err != nil {
+			return ca.Profile{}, err
+		}
+	}
+	name := profileName
+	if name == "" {
+		name = defaultName
+	}
+	profile, ok := profiles[name]
+	if !ok {
+		return ca.Profile{}, fmt.Errorf("unknown profile %s, must be one of: %s", name, strings.Join(ca.ProfileNames(profiles), ", "))
+	}
+	return profile, nil
+}
+
+// profileDays returns the validity set with --days, or 0 to use the profile's default
+func profileDays(cmd *cobra.Command) int {
+	if cmd.Flags().Changed("days") {
+		return certDays
+	}
+	return 0
 }
@@ -2,67 +2,100 @@ package cmd
 
 import (
 	"bufio"
-	"crypto"
 	"crypto/x509"
-	"encoding/pem"
 	"fmt"
 	"io/ioutil"
 	"log"
-	"math/big"
 	"os"
-	"time"
+	"strings"
 
+	"github.com/deitch/ssl-tools/pkg/ca"
 	"github.com/spf13/cobra"
 )
 
 var (
-	csrPath string
-	approve bool
+	csrPath             string
+	approve             bool
+	replaceSANs         bool
+	csrExtensionsPolicy string
+	policyPath          string
 )
 
 var signCsrCmd = &cobra.Command{
-	Use:   "sign",
+	Use:   "csr",
 	Short: "Sign a CSR",
-	Long:  `Sign an existing CSR`,
+	Long: `Sign an existing CSR, certifying its public key for its subject and subject alternative names.
+Key usage, extended key usage and basic constraints come from the profile; use --extensions to copy, filter
+or reject those requested in the CSR.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		var (
-			publicKey crypto.PublicKey
-			template  x509.Certificate
-		)
+		extensionPolicy, err := ca.ParseExtensionPolicy(csrExtensionsPolicy)
+		if err != nil {
+			log.Fatal(err)
+		}
+		profile, err := loadProfile("server")
+		if err != nil {
+			log.Fatal(err)
+		}
+		var policy *ca.Policy
+		if policyPath != "" {
+			b, err := ioutil.ReadFile(policyPath)
+			if err != nil {
+				log.Fatalf("unable to read policy file %s: %v", policyPath, err)
+			}
+			if policy, err = ca.ParsePolicy(b); err != nil {
+				log.Fatal(err)
+			}
+		}
+		flagSANs, err := parseSANs()
+		if err != nil {
+			log.Fatalf("invalid subject alternative names: %v", err)
+		}
 		// get the CSR from the file
 		csrBytes, err := ioutil.ReadFile(csrPath)
 		if err != nil {
 			log.Fatalf("unable to read CSR file %s: %v", csrPath, err)
 		}
-		block, _ := pem.Decode(csrBytes)
-		csr, err := x509.ParseCertificateRequest(block.Bytes)
+		csr, err := ca.ParseCSRPEM(csrBytes)
 		if err != nil {
 			log.Fatalf("unable to parse CSR file %s: %v", csrPath, err)
 		}
-		template = x509.Certificate{
-			SerialNumber: big.NewInt(1),
-			Subject:      csr.Subject,
-			NotBefore:    time.Now(),
-			NotAfter:     time.Now().Add(time.Hour * 24 * time.Duration(certDays)),
+		if err := csr.CheckSignature(); err != nil {
+			log.Fatalf("invalid CSR signature in %s: %v", csrPath, err)
+		}
+		sans, err := ca.SANsFromCSR(csr)
+		if err != nil {
+			log.Fatalf("unable to read CSR subject alternative names: %v", err)
+		}
+		if replaceSANs {
+			sans = flagSANs
+		} else {
+			sans.Merge(*flagSANs)
+		}
+		requested, err := ca.ParseRequestedExtensions(csr)
+		if err != nil {
+			log.Fatalf("unable to read CSR extensions: %v", err)
+		}
 
-			KeyUsage:              x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
-			ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
-			BasicConstraintsValid: true,
-			IsCA:                  false,
-			DNSNames:              csr.DNSNames,
-			IPAddresses:           csr.IPAddresses,
+		opts := ca.CertificateOptions{
+			Subject:            csr.Subject,
+			RawSubject:         csr.RawSubject,
+			Days:               profileDays(cmd),
+			SANs:               *sans,
+			SignatureAlgorithm: sigAlg,
 		}
-		if !approve {
-			reader := bufio.NewReader(os.Stdin)
-			fmt.Printf("Approve certificate for %#v (y/n)? ", csr.Subject)
-			text, _ := reader.ReadString('\n')
-			if text != "Y" && text != "y" {
-				log.Fatal("Not approved!")
-			}
+		profile.Apply(&opts, csr.PublicKey)
+		if err := extensionPolicy.Apply(&opts, requested); err != nil {
+			log.Fatal(err)
+		}
+		switch {
+		case policy != nil:
+			checkPolicy(policy, csr, opts)
+		case !approve:
+			approveCSR(csr, sans)
 		}
 
 		// load and sign
-		if err = loadAndSignCert(caCertPath, caKeyPath, &template, publicKey, certPath); err != nil {
+		if err = loadAndSignCert(caDir, caCertPath, caKeyPath, opts.Template(), csr.PublicKey, certPath); err != nil {
 			log.Fatalf("failed to sign cert: %v", err)
 		}
 	},
@@ -71,7 +104,40 @@ var signCsrCmd = &cobra.Command{
 func signCsrInit() {
 	signCsrCmd.Flags().StringVar(&certPath, "cert", "", "path to save the signed certificate")
 	_ = signCsrCmd.MarkFlagRequired("cert")
-	signCsrCmd.Flags().StringVar(&csrPath, "csr", "", "path to the CSR to sign; must specify one of --csr or --subject")
+	signCsrCmd.Flags().StringVar(&csrPath, "csr", "", "path to the CSR to sign")
 	_ = signCsrCmd.MarkFlagRequired("csr")
 	signCsrCmd.Flags().BoolVar(&approve, "approve", false, "auto-approve signing without checking, used only for CSR")
+	signCsrCmd.Flags().StringVar(&policyPath, "policy", "", "path to a YAML signing policy; the CSR is signed without prompting if it meets every rule, and rejected with a report of each rule it fails otherwise")
+	signCsrCmd.Flags().StringVar(&saNames, "san", "", sanHelp+"; added to those requested in the CSR")
+	signCsrCmd.Flags().StringVar(&sanFile, "san-file", "", sanFileHelp)
+	signCsrCmd.Flags().BoolVar(&replaceSANs, "replace-san", false, "replace the subject alternative names requested in the CSR with those of --san and --san-file, rather than adding to them")
+	signCsrCmd.Flags().StringVar(&csrExtensionsPolicy, "extensions", "ignore", "how to treat the key usage, extended key usage and basic constraints requested in the CSR, one of: ignore (use the profile), copy (use those requested in place of the profile), filter (use those requested that the profile allows), reject (use the profile, failing if the CSR requests anything it does not allow)")
+}
+
+// checkPolicy prints a report of the policy rules the CSR fails, and exits if it fails any
+func checkPolicy(policy *ca.Policy, csr *x509.CertificateRequest, opts ca.CertificateOptions) {
+	violations := policy.Check(csr, opts)
+	if len(violations) == 0 {
+		fmt.Printf("CSR %s meets policy %s\n", csr.Subject.String(), policyPath)
+		return
+	}
+	fmt.Printf("CSR %s rejected by policy %s:\n", csr.Subject.String(), policyPath)
+	for _, v := range violations {
+		fmt.Printf("\t%s\n", v)
+	}
+	log.Fatalf("%d policy rule(s) failed", len(violations))
+}
+
+// approveCSR asks the user whether to sign the CSR for sans, and exits if not approved
+func approveCSR(csr *x509.CertificateRequest, sans *ca.SANs) {
+	reader := bufio.NewReader(os.Stdin)
+	fmt.Printf("Subject: %s\n", csr.Subject.String())
+	if names := sans.Strings(); len(names) > 0 {
+		fmt.Printf("SAN: %s\n", strings.Join(names, ","))
+	}
+	fmt.Printf("Approve certificate (y/n)? ")
+	text, _ := reader.ReadString('\n')
+	if text = strings.TrimSpace(text); text != "Y" && text != "y" {
+		log.Fatal("Not approved!")
+	}
 }
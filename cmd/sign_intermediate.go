@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"crypto"
+	"crypto/x509/pkix"
+	"io/ioutil"
+	"log"
+
+	"github.com/deitch/ssl-tools/pkg/ca"
+	"github.com/spf13/cobra"
+)
+
+var (
+	pathLen                       int
+	permittedNames, excludedNames []string
+	constraintsCritical           bool
+)
+
+var signIntermediateCmd = &cobra.Command{
+	Use:   "intermediate",
+	Short: "Issue an intermediate CA certificate",
+	Long: `Issue an intermediate CA certificate, either generating a new key for the given subject, or for an
+existing CSR. The saved certificate is followed by the full chain up to the root.`,
+	PreRun: func(cmd *cobra.Command, args []string) {
+		if (subject == "") == (csrPath == "") {
+			log.Fatal("must specify exactly one of --subject or --csr")
+		}
+		if subject != "" && keyPath == "" {
+			log.Fatal("must specify --key to save the generated key with --subject")
+		}
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		var (
+			publicKey  crypto.PublicKey
+			name       pkix.Name
+			rawSubject []byte
+		)
+		profile, err := loadProfile("intermediate-ca")
+		if err != nil {
+			log.Fatal(err)
+		}
+		if !profile.IsCA {
+			log.Fatalf("profile %s is not for a CA", profileName)
+		}
+		constraints, err := ca.ParseNameConstraints(permittedNames, excludedNames)
+		if err != nil {
+			log.Fatalf("invalid name constraints: %v", err)
+		}
+		constraints.Critical = constraintsCritical
+		if csrPath != "" {
+			csrBytes, err := ioutil.ReadFile(csrPath)
+			if err != nil {
+				log.Fatalf("unable to read CSR file %s: %v", csrPath, err)
+			}
+			csr, err := ca.ParseCSRPEM(csrBytes)
+			if err != nil {
+				log.Fatalf("unable to parse CSR file %s: %v", csrPath, err)
+			}
+			if err := csr.CheckSignature(); err != nil {
+				log.Fatalf("invalid CSR signature in %s: %v", csrPath, err)
+			}
+			sans, err := ca.SANsFromCSR(csr)
+			if err != nil {
+				log.Fatalf("unable to read CSR subject alternative names: %v", err)
+			}
+			if !approve {
+				approveCSR(csr, sans)
+			}
+			name, rawSubject, publicKey = csr.Subject, csr.RawSubject, csr.PublicKey
+		} else {
+			// parse everything before the key is generated, so that a mistake leaves no key behind
+			parsed, raw, err := parseSubject(subject)
+			if err != nil {
+				log.Fatalf("error parsing the subject: %v", err)
+			}
+			name, rawSubject = *parsed, raw
+			if _, publicKey, err = generateKeyPair(keyOptions, keyPath); err != nil {
+				log.Fatalf("error generating private key: %v", err)
+			}
+		}
+
+		opts := ca.CertificateOptions{
+			Subject:            name,
+			RawSubject:         rawSubject,
+			Days:               profileDays(cmd),
+			NameConstraints:    constraints,
+			SignatureAlgorithm: sigAlg,
+		}
+		profile.Apply(&opts, publicKey)
+		if cmd.Flags().Changed("path-len") {
+			opts.MaxPathLen, opts.MaxPathLenZero = pathLen, pathLen == 0
+		}
+
+		// load and sign, saving the chain along with it
+		if err = loadAndSign(caDir, caCertPath, caKeyPath, opts.Template(), publicKey, certPath, true); err != nil {
+			log.Fatalf("failed to sign cert: %v", err)
+		}
+	},
+}
+
+func signIntermediateInit() {
+	signIntermediateCmd.Flags().StringVar(&subject, "subject", "", subjectHelp)
+	signIntermediateCmd.Flags().StringVar(&keyPath, "key", "", "path to the save the generated key, when using --subject")
+	signIntermediateCmd.Flags().StringVar(&keyPassphrase, "key-passphrase", "", keyPassphraseHelp)
+	signIntermediateCmd.Flags().StringVar(&keyKDFName, "key-kdf", string(ca.KDFPBKDF2), keyKDFHelp)
+	signIntermediateCmd.Flags().StringVar(&csrPath, "csr", "", "path to the CSR to sign; must specify one of --csr or --subject")
+	signIntermediateCmd.Flags().BoolVar(&approve, "approve", false, "auto-approve signing without checking, used only for CSR")
+	signIntermediateCmd.Flags().StringVar(&certPath, "cert", "", "path to save the signed certificate, followed by the chain up to the root")
+	_ = signIntermediateCmd.MarkFlagRequired("cert")
+	signIntermediateCmd.Flags().IntVar(&pathLen, "path-len", 0, "maximum number of intermediate CAs that may follow this one; 0 means it can issue only end-entity certificates, -1 for no limit; defaults to that of the profile")
+	signIntermediateCmd.Flags().StringSliceVar(&permittedNames, "permit", nil, "permitted name constraints, comma-separated, each one of DNS:<domain>, IP:<cidr> or email:<address or domain>, e.g. 'DNS:.example.com,IP:10.0.0.0/8'")
+	signIntermediateCmd.Flags().StringSliceVar(&excludedNames, "exclude", nil, "excluded name constraints, in the same format as --permit")
+	signIntermediateCmd.Flags().BoolVar(&constraintsCritical, "critical-constraints", false, "mark the name constraints extension critical")
+}
@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"log"
+
+	"github.com/deitch/ssl-tools/pkg/ca"
+	"github.com/spf13/cobra"
+)
+
+var pubKeyPath string
+
+var signPubKeyCmd = &cobra.Command{
+	Use:   "pubkey",
+	Short: "Issue a certificate for a public key",
+	Long: `Issue a certificate for a bare public key, without a CSR, for the given subject, e.g. for a key held in
+an HSM that cannot sign a CSR.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		profile, err := loadProfile("peer")
+		if err != nil {
+			log.Fatal(err)
+		}
+		sans, err := parseSANs()
+		if err != nil {
+			log.Fatalf("invalid subject alternative names: %v", err)
+		}
+		b, err := ioutil.ReadFile(pubKeyPath)
+		if err != nil {
+			log.Fatalf("unable to read public key file %s: %v", pubKeyPath, err)
+		}
+		publicKey, err := ca.ParsePublicKeyPEM(b)
+		if err != nil {
+			log.Fatalf("unable to parse public key file %s: %v", pubKeyPath, err)
+		}
+		name, rawSubject, err := parseSubject(subject)
+		if err != nil {
+			log.Fatalf("error parsing the subject: %v", err)
+		}
+		opts := ca.CertificateOptions{
+			Subject:            *name,
+			RawSubject:         rawSubject,
+			Days:               profileDays(cmd),
+			SANs:               *sans,
+			SignatureAlgorithm: sigAlg,
+		}
+		profile.Apply(&opts, publicKey)
+
+		// load and sign
+		if err = loadAndSignCert(caDir, caCertPath, caKeyPath, opts.Template(), publicKey, certPath); err != nil {
+			log.Fatalf("failed to sign cert: %v", err)
+		}
+	},
+}
+
+func signPubKeyInit() {
+	signPubKeyCmd.Flags().StringVar(&pubKeyPath, "pub", "", "path to the PEM-encoded public key to certify")
+	_ = signPubKeyCmd.MarkFlagRequired("pub")
+	signPubKeyCmd.Flags().StringVar(&certPath, "cert", "", "path to save the signed certificate")
+	_ = signPubKeyCmd.MarkFlagRequired("cert")
+	signPubKeyCmd.Flags().StringVar(&subject, "subject", "", subjectHelp)
+	_ = signPubKeyCmd.MarkFlagRequired("subject")
+	signPubKeyCmd.Flags().StringVar(&saNames, "san", "", sanHelp)
+	signPubKeyCmd.Flags().StringVar(&sanFile, "san-file", "", sanFileHelp)
+}
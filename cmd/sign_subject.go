@@ -1,74 +1,68 @@
 package cmd
 
 import (
-	"crypto"
-	"crypto/x509"
 	"log"
-	"math/big"
-	"net"
-	"strings"
-	"time"
 
+	"github.com/deitch/ssl-tools/pkg/ca"
 	"github.com/spf13/cobra"
 )
 
 var signSubjectCmd = &cobra.Command{
 	Use:   "subject",
 	Short: "Generate a private key, generate a CSR and sign it",
-	Long:  `Generate a private key, generate a CSR and sign it.`,
+	Long: `Generate a private key, generate a CSR and sign it. With --key-in, or --keep-key when the key file
+already exists, certifies an existing key instead, e.g. to renew a certificate with a pinned key.`,
+	PreRun: func(cmd *cobra.Command, args []string) {
+		if keyPath == "" && keyInPath == "" {
+			log.Fatal("must specify --key or --key-in")
+		}
+	},
 	Run: func(cmd *cobra.Command, args []string) {
-		var (
-			publicKey crypto.PublicKey
-			template  x509.Certificate
-		)
-		_, publicKey, err := generateKeyPair(keyType, keySize, keyPath)
+		profile, err := loadProfile("peer")
 		if err != nil {
-			log.Fatalf("error generating private key: %v", err)
+			log.Fatal(err)
 		}
-		name, err := parseSubject(subject)
+		// parse everything before the key is generated, so that a mistake leaves no key behind
+		name, rawSubject, err := parseSubject(subject)
 		if err != nil {
 			log.Fatalf("error parsing the subject: %v", err)
 		}
-		template = x509.Certificate{
-			SerialNumber: big.NewInt(1),
-			Subject:      *name,
-			NotBefore:    time.Now(),
-			NotAfter:     time.Now().Add(time.Hour * 24 * time.Duration(certDays)),
-
-			KeyUsage:              x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
-			ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
-			BasicConstraintsValid: true,
-			IsCA:                  false,
+		sans, err := parseSANs()
+		if err != nil {
+			log.Fatalf("invalid subject alternative names: %v", err)
+		}
+		key, err := loadOrGenerateKey(keyOptions, keyPath)
+		if err != nil {
+			log.Fatalf("error getting private key: %v", err)
 		}
-		if saNames != "" {
-			sans := strings.Split(saNames, ",")
-			sansDNS := make([]string, 0)
-			sansIps := make([]net.IP, 0)
-			for _, s := range sans {
-				ip := net.ParseIP(s)
-				if ip == nil {
-					sansDNS = append(sansDNS, s)
-				} else {
-					sansIps = append(sansIps, ip)
-				}
-			}
-			template.DNSNames = sansDNS
-			template.IPAddresses = sansIps
+		publicKey := key.Public()
+		opts := ca.CertificateOptions{
+			Subject:            *name,
+			RawSubject:         rawSubject,
+			Days:               profileDays(cmd),
+			SANs:               *sans,
+			SignatureAlgorithm: sigAlg,
 		}
+		profile.Apply(&opts, publicKey)
 
 		// load and sign
-		if err = loadAndSignCert(caCertPath, caKeyPath, &template, publicKey, certPath); err != nil {
+		if err = loadAndSignCert(caDir, caCertPath, caKeyPath, opts.Template(), publicKey, certPath); err != nil {
 			log.Fatalf("failed to sign cert: %v", err)
 		}
 	},
 }
 
 func signSubjectInit() {
-	signSubjectCmd.Flags().StringVar(&keyPath, "key", "", "path to the save the generated key")
-	_ = signSubjectCmd.MarkFlagRequired("key")
+	signSubjectCmd.Flags().StringVar(&keyPath, "key", "", "path to the save the generated key, or a copy of that of --key-in; must specify --key or --key-in")
+	signSubjectCmd.Flags().StringVar(&keyPassphrase, "key-passphrase", "", keyPassphraseHelp)
+	signSubjectCmd.Flags().StringVar(&keyKDFName, "key-kdf", string(ca.KDFPBKDF2), keyKDFHelp)
+	signSubjectCmd.Flags().StringVar(&keyInPath, "key-in", "", keyInHelp)
+	signSubjectCmd.Flags().StringVar(&keyInPassphrase, "key-in-passphrase", "", keyInPassphraseHelp)
+	signSubjectCmd.Flags().BoolVar(&keepKey, "keep-key", false, keepKeyHelp)
 	signSubjectCmd.Flags().StringVar(&certPath, "cert", "", "path to save the signed certificate")
 	_ = signSubjectCmd.MarkFlagRequired("cert")
-	signSubjectCmd.Flags().StringVar(&subject, "subject", "", "distinguished name subject for the certificate in the format 'C=US,ST=NY,O=My Org,CN=server.myorg.com', also supports '/C=US/ST=NY/...' if starting with '/'")
+	signSubjectCmd.Flags().StringVar(&subject, "subject", "", subjectHelp)
 	_ = signSubjectCmd.MarkFlagRequired("subject")
-	signSubjectCmd.Flags().StringVar(&saNames, "san", "", "subject alternative names (SAN) to use, comma-separated, e.g. '127.0.0.1,www.foo.com'")
+	signSubjectCmd.Flags().StringVar(&saNames, "san", "", sanHelp)
+	signSubjectCmd.Flags().StringVar(&sanFile, "san-file", "", sanFileHelp)
 }
@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/deitch/ssl-tools/pkg/ca"
+	"github.com/spf13/cobra"
+)
+
+var (
+	verifyCertPath      string
+	verifyRootsPath     string
+	verifyIntermediates []string
+	verifyHost          string
+	verifyPurpose       string
+	verifyAt            string
+)
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Verify a certificate chain",
+	Long: `Build and validate the chains from a certificate to the trusted roots, checking validity, hostname,
+purpose and key usage, and print each chain found. If none is valid, explain why.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		purpose, err := ca.ParsePurpose(verifyPurpose)
+		if err != nil {
+			log.Fatal(err)
+		}
+		opts := ca.VerifyOptions{Host: verifyHost, Purpose: purpose}
+		if verifyAt != "" {
+			if opts.At, err = parseTime(verifyAt); err != nil {
+				log.Fatal(err)
+			}
+		}
+		certs, err := readCertificates(verifyCertPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		// any certificates following the leaf are taken to be intermediates
+		leaf := certs[0]
+		opts.Intermediates = certs[1:]
+		for _, p := range verifyIntermediates {
+			intermediates, err := readCertificates(p)
+			if err != nil {
+				log.Fatal(err)
+			}
+			opts.Intermediates = append(opts.Intermediates, intermediates...)
+		}
+		if verifyRootsPath != "" {
+			if opts.Roots, err = readCertificates(verifyRootsPath); err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		chains, err := ca.Verify(leaf, opts)
+		if err != nil {
+			log.Fatalf("verification failed: %s", ca.ExplainVerifyError(err, opts))
+		}
+		for i, chain := range chains {
+			fmt.Printf("Chain %d:\n", i+1)
+			for j, c := range chain {
+				fmt.Printf("\t%d: %s (valid until %s)\n", j, c.Subject, c.NotAfter)
+			}
+		}
+		fmt.Println("OK")
+	},
+}
+
+func verifyInit() {
+	verifyCmd.Flags().StringVar(&verifyCertPath, "cert", "", "path to the certificate to verify, optionally followed by intermediates")
+	_ = verifyCmd.MarkFlagRequired("cert")
+	verifyCmd.Flags().StringVar(&verifyRootsPath, "ca", "", "path to the trusted root certificates; defaults to the system roots")
+	verifyCmd.Flags().StringSliceVar(&verifyIntermediates, "intermediates", nil, "paths to intermediate certificates, comma-separated or repeated")
+	verifyCmd.Flags().StringVar(&verifyHost, "host", "", "DNS name or IP address the certificate must be valid for")
+	verifyCmd.Flags().StringVar(&verifyPurpose, "purpose", "any", "purpose the certificate must be valid for, one of: "+strings.Join(ca.PurposeNames(), ", "))
+	verifyCmd.Flags().StringVar(&verifyAt, "at", "", "time to verify at, RFC 3339 e.g. 2030-01-02T15:04:05Z, or a date e.g. 2030-01-02; defaults to now")
+}
+
+// readCertificates reads all of the PEM-encoded certificates in a file
+func readCertificates(p string) ([]*x509.Certificate, error) {
+	b, err := ioutil.ReadFile(p)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read certificate file %s: %v", p, err)
+	}
+	certs, err := ca.ParseCertificatesPEM(b)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse certificate file %s: %v", p, err)
+	}
+	return certs, nil
+}
+
+// parseTime parses a time in RFC 3339 format, or a date
+func parseTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		return t, fmt.Errorf("invalid time %s, must be RFC 3339 or a date", s)
+	}
+	return t, nil
+}
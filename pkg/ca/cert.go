@@ -0,0 +1,265 @@
+package ca
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"time"
+)
+
+// CertificateOptions describe a certificate to be signed
+type CertificateOptions struct {
+	Subject pkix.Name
+	// RawSubject is the DER-encoded subject, e.g. from MarshalDN; if set, it is used instead of Subject
+	RawSubject []byte
+	// SerialNumber is the serial of the certificate; if nil, it is assigned when signing
+	SerialNumber *big.Int
+	// Days is how long the certificate is valid, starting now
+	Days int
+	SANs
+	KeyUsage    x509.KeyUsage
+	ExtKeyUsage []x509.ExtKeyUsage
+	// UnknownExtKeyUsage are extended key usages x509 has no constant for, e.g. copied from a CSR
+	UnknownExtKeyUsage []asn1.ObjectIdentifier
+	IsCA               bool
+	// MaxPathLen and MaxPathLenZero limit how many intermediate CAs may follow a CA certificate,
+	// just as in x509.Certificate: MaxPathLen -1, or 0 without MaxPathLenZero, means no limit
+	MaxPathLen     int
+	MaxPathLenZero bool
+	// NameConstraints restrict the names a CA certificate may issue for, optional
+	NameConstraints *NameConstraints
+	// SignatureAlgorithm is the algorithm with which the issuer signs the certificate; if unknown, the
+	// default for the issuer's key
+	SignatureAlgorithm x509.SignatureAlgorithm
+}
+
+// Template returns the x509 certificate template for the options
+func (o CertificateOptions) Template() *x509.Certificate {
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: o.SerialNumber,
+		Subject:      o.Subject,
+		RawSubject:   o.RawSubject,
+		NotBefore:    now,
+		NotAfter:     now.Add(time.Hour * 24 * time.Duration(o.Days)),
+
+		KeyUsage:              o.KeyUsage,
+		ExtKeyUsage:           o.ExtKeyUsage,
+		UnknownExtKeyUsage:    o.UnknownExtKeyUsage,
+		BasicConstraintsValid: true,
+		IsCA:                  o.IsCA,
+		MaxPathLen:            o.MaxPathLen,
+		MaxPathLenZero:        o.MaxPathLenZero,
+		SignatureAlgorithm:    o.SignatureAlgorithm,
+	}
+	o.SANs.apply(&template.DNSNames, &template.IPAddresses, &template.EmailAddresses, &template.URIs, &template.ExtraExtensions, isEmptySubject(o.Subject, o.RawSubject))
+	if o.NameConstraints != nil {
+		o.NameConstraints.apply(template)
+	}
+	return template
+}
+
+// SignCertificate signs template with the parent certificate and its private key, certifying pub. The
+// template's signature algorithm, if set, must suit the private key.
+func SignCertificate(template, parent *x509.Certificate, pub crypto.PublicKey, priv crypto.PrivateKey) (*x509.Certificate, error) {
+	if signer, ok := priv.(crypto.Signer); ok {
+		if err := CheckSignatureAlgorithm(template.SignatureAlgorithm, signer.Public()); err != nil {
+			return nil, fmt.Errorf("issuer key cannot sign: %v", err)
+		}
+	}
+	b, err := x509.CreateCertificate(rand.Reader, template, parent, pub, priv)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create certificate: %v", err)
+	}
+	return x509.ParseCertificate(b)
+}
+
+// SelfSign creates a self-signed certificate from template with key. If the template
+// has no serial number, a random one is used.
+func SelfSign(template *x509.Certificate, key crypto.Signer) (*x509.Certificate, error) {
+	if err := ensureSerial(template); err != nil {
+		return nil, err
+	}
+	return SignCertificate(template, template, key.Public(), key)
+}
+
+// WriteCertificates writes each certificate to w, PEM-encoded
+func WriteCertificates(w io.Writer, certs ...*x509.Certificate) error {
+	for _, cert := range certs {
+		if err := pem.Encode(w, &pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CA is a certificate authority, its certificate and the private key used to sign
+type CA struct {
+	Certificate *x509.Certificate
+	Key         crypto.Signer
+	// Chain is the chain of issuers above Certificate, if it is an intermediate CA
+	Chain []*x509.Certificate
+}
+
+// ParseCA creates a CA from a PEM-encoded certificate, optionally followed by its chain, and private
+// key. If the key is encrypted, the passphrase is asked of password, which may be nil otherwise.
+func ParseCA(certPEM, keyPEM []byte, password PasswordFunc) (*CA, error) {
+	certs, err := ParseCertificatesPEM(certPEM)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CA cert: %v", err)
+	}
+	privateKey, err := ParsePrivateKeyPEMWithPassword(keyPEM, password)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CA key: %v", err)
+	}
+	key, ok := privateKey.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("CA key of type %T cannot sign", privateKey)
+	}
+	if !KeyMatches(key, certs[0].PublicKey) {
+		return nil, errors.New("failed to read CA cert/key: private key does not match public key")
+	}
+	return &CA{Certificate: certs[0], Key: key, Chain: certs[1:]}, nil
+}
+
+// LoadCA reads a CA from a PEM-encoded certificate file and private key file. If the key is encrypted,
+// the passphrase is asked of password, which may be nil otherwise.
+func LoadCA(certPath, keyPath string, password PasswordFunc) (*CA, error) {
+	certPEM, err := os.ReadFile(certPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA cert: %v", err)
+	}
+	keyPEM, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA key: %v", err)
+	}
+	return ParseCA(certPEM, keyPEM, password)
+}
+
+// ChainFor returns cert followed by the full chain of its issuers: the CA certificate and the CA's own chain
+func (c *CA) ChainFor(cert *x509.Certificate) []*x509.Certificate {
+	return append([]*x509.Certificate{cert, c.Certificate}, c.Chain...)
+}
+
+// Sign signs the template with the CA, certifying the public key pub. If the template
+// has no serial number, a random one is used.
+func (c *CA) Sign(template *x509.Certificate, pub crypto.PublicKey) (*x509.Certificate, error) {
+	if err := ensureSerial(template); err != nil {
+		return nil, err
+	}
+	if template.IsCA {
+		if err := c.checkPathLen(template); err != nil {
+			return nil, err
+		}
+	}
+	return SignCertificate(template, c.Certificate, pub, c.Key)
+}
+
+// ParseCertificatePEM parses the first PEM-encoded certificate in b
+func ParseCertificatePEM(b []byte) (*x509.Certificate, error) {
+	der, _ := pem.Decode(b)
+	if der == nil {
+		return nil, errors.New("no valid PEM")
+	}
+	if der.Type != "CERTIFICATE" {
+		return nil, errors.New("does not contain certificate")
+	}
+	return x509.ParseCertificate(der.Bytes)
+}
+
+// ParseCertificatesPEM parses all of the PEM-encoded certificates in b, ignoring other blocks
+func ParseCertificatesPEM(b []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		if block, b = pem.Decode(b); block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("does not contain certificate")
+	}
+	return certs, nil
+}
+
+func ensureSerial(template *x509.Certificate) error {
+	if template.SerialNumber != nil {
+		return nil
+	}
+	serial, err := RandomSerial()
+	if err != nil {
+		return fmt.Errorf("failed to generate serial number: %v", err)
+	}
+	template.SerialNumber = serial
+	return nil
+}
+
+// checkPathLen makes sure the CA is permitted to issue the intermediate CA in template
+func (c *CA) checkPathLen(template *x509.Certificate) error {
+	issuer := c.Certificate
+	if !issuer.BasicConstraintsValid || (issuer.MaxPathLen < 0 || (issuer.MaxPathLen == 0 && !issuer.MaxPathLenZero)) {
+		return nil
+	}
+	if issuer.MaxPathLen == 0 {
+		return errors.New("CA has path length 0, so it cannot issue intermediate CAs")
+	}
+	unlimited := template.MaxPathLen < 0 || (template.MaxPathLen == 0 && !template.MaxPathLenZero)
+	if unlimited || template.MaxPathLen >= issuer.MaxPathLen {
+		return fmt.Errorf("CA has path length %d, so intermediate CAs must have a path length of at most %d", issuer.MaxPathLen, issuer.MaxPathLen-1)
+	}
+	return nil
+}
+
+// OrderChain returns the certificates ordered as a chain, each followed by its issuer, starting with the
+// one that issued none of the others, e.g. from a PKCS#7 bundle, which has no order. If they do not form
+// a single chain, they are returned as they are.
+func OrderChain(certs []*x509.Certificate) []*x509.Certificate {
+	issuerOf := func(cert *x509.Certificate) *x509.Certificate {
+		for _, c := range certs {
+			if c != cert && bytes.Equal(c.RawSubject, cert.RawIssuer) && cert.CheckSignatureFrom(c) == nil {
+				return c
+			}
+		}
+		return nil
+	}
+	var leaves []*x509.Certificate
+	for _, cert := range certs {
+		issued := false
+		for _, c := range certs {
+			if c != cert && issuerOf(c) == cert {
+				issued = true
+			}
+		}
+		if !issued {
+			leaves = append(leaves, cert)
+		}
+	}
+	if len(leaves) != 1 {
+		return certs
+	}
+	ordered := []*x509.Certificate{leaves[0]}
+	for issuer := issuerOf(leaves[0]); issuer != nil && len(ordered) < len(certs); issuer = issuerOf(issuer) {
+		ordered = append(ordered, issuer)
+	}
+	if len(ordered) != len(certs) {
+		return certs
+	}
+	return ordered
+}
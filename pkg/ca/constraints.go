@@ -0,0 +1,70 @@
+package ca
+
+import (
+	"crypto/x509"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// NameConstraints restrict the names for which a CA certificate may issue certificates
+type NameConstraints struct {
+	// Critical marks the extension critical, so clients that do not understand it reject the certificate
+	Critical                bool
+	PermittedDNSDomains     []string
+	ExcludedDNSDomains      []string
+	PermittedIPRanges       []*net.IPNet
+	ExcludedIPRanges        []*net.IPNet
+	PermittedEmailAddresses []string
+	ExcludedEmailAddresses  []string
+}
+
+// ParseNameConstraints builds name constraints from lists of permitted and excluded names, each typed as
+// DNS:<domain>, IP:<cidr> or email:<address, domain or .domain>, e.g. 'DNS:.example.com' or 'IP:10.0.0.0/8'
+func ParseNameConstraints(permitted, excluded []string) (*NameConstraints, error) {
+	var nc NameConstraints
+	for _, p := range permitted {
+		if err := nc.add(p, &nc.PermittedDNSDomains, &nc.PermittedIPRanges, &nc.PermittedEmailAddresses); err != nil {
+			return nil, err
+		}
+	}
+	for _, e := range excluded {
+		if err := nc.add(e, &nc.ExcludedDNSDomains, &nc.ExcludedIPRanges, &nc.ExcludedEmailAddresses); err != nil {
+			return nil, err
+		}
+	}
+	return &nc, nil
+}
+
+func (nc *NameConstraints) add(constraint string, dns *[]string, ips *[]*net.IPNet, emails *[]string) error {
+	parts := strings.SplitN(constraint, ":", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return fmt.Errorf("invalid name constraint %s, must be DNS:<domain>, IP:<cidr> or email:<address>", constraint)
+	}
+	switch strings.ToLower(parts[0]) {
+	case "dns":
+		*dns = append(*dns, parts[1])
+	case "ip":
+		_, ipNet, err := net.ParseCIDR(parts[1])
+		if err != nil {
+			return fmt.Errorf("invalid IP range in name constraint %s: %v", constraint, err)
+		}
+		*ips = append(*ips, ipNet)
+	case "email":
+		*emails = append(*emails, parts[1])
+	default:
+		return fmt.Errorf("unknown name constraint type %s, must be one of DNS, IP or email", parts[0])
+	}
+	return nil
+}
+
+// apply sets the name constraints on a certificate template
+func (nc *NameConstraints) apply(template *x509.Certificate) {
+	template.PermittedDNSDomainsCritical = nc.Critical
+	template.PermittedDNSDomains = nc.PermittedDNSDomains
+	template.ExcludedDNSDomains = nc.ExcludedDNSDomains
+	template.PermittedIPRanges = nc.PermittedIPRanges
+	template.ExcludedIPRanges = nc.ExcludedIPRanges
+	template.PermittedEmailAddresses = nc.PermittedEmailAddresses
+	template.ExcludedEmailAddresses = nc.ExcludedEmailAddresses
+}
@@ -0,0 +1,154 @@
+package ca
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	oidPKCS5     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5}
+	oidPKCS12PBE = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 1}
+)
+
+// KeyFormat is the encoding of a private key
+type KeyFormat string
+
+const (
+	// KeyFormatPKCS1 is PKCS#1, RSA PRIVATE KEY, for RSA keys only
+	KeyFormatPKCS1 KeyFormat = "pkcs1"
+	// KeyFormatPKCS8 is PKCS#8, PRIVATE KEY, for any key
+	KeyFormatPKCS8 KeyFormat = "pkcs8"
+	// KeyFormatSEC1 is SEC 1, EC PRIVATE KEY, for ECDSA keys only
+	KeyFormatSEC1 KeyFormat = "sec1"
+)
+
+// ParseKeyFormat converts a key format name into a KeyFormat
+func ParseKeyFormat(name string) (KeyFormat, error) {
+	switch f := KeyFormat(strings.ToLower(name)); f {
+	case KeyFormatPKCS1, KeyFormatPKCS8, KeyFormatSEC1:
+		return f, nil
+	default:
+		return "", fmt.Errorf("unknown key format %s, must be one of: pkcs1, pkcs8, sec1", name)
+	}
+}
+
+// MarshalPrivateKey encodes the private key in format, returning it as a PEM block
+func MarshalPrivateKey(key crypto.PrivateKey, format KeyFormat) (*pem.Block, error) {
+	switch format {
+	case KeyFormatPKCS1:
+		k, ok := key.(*rsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("only RSA keys can be encoded as PKCS#1, not %s", DescribePrivateKey(key).PublicKey.Algorithm)
+		}
+		return &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(k)}, nil
+	case KeyFormatSEC1:
+		k, ok := key.(*ecdsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("only ECDSA keys can be encoded as SEC 1, not %s", DescribePrivateKey(key).PublicKey.Algorithm)
+		}
+		b, err := x509.MarshalECPrivateKey(k)
+		if err != nil {
+			return nil, err
+		}
+		return &pem.Block{Type: "EC PRIVATE KEY", Bytes: b}, nil
+	case KeyFormatPKCS8:
+		b, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+		return &pem.Block{Type: "PRIVATE KEY", Bytes: b}, nil
+	}
+	return nil, fmt.Errorf("unknown key format %s", format)
+}
+
+// PEMToDER returns the DER encoding of the single PEM block in b. It fails for several blocks, which DER
+// cannot hold, and for legacy encrypted keys, whose encryption is in the PEM headers.
+func PEMToDER(b []byte) ([]byte, error) {
+	block, rest := pem.Decode(b)
+	if block == nil {
+		return nil, errors.New("no valid PEM")
+	}
+	if next, _ := pem.Decode(rest); next != nil {
+		return nil, errors.New("more than one PEM block, but DER holds only one object")
+	}
+	if len(block.Headers) > 0 {
+		return nil, fmt.Errorf("%s has PEM headers, e.g. legacy encryption, which DER cannot hold", block.Type)
+	}
+	return block.Bytes, nil
+}
+
+// DERToPEM returns the PEM encoding of a DER-encoded certificate, CSR, private or public key, CRL or
+// PKCS#7 bundle, with the PEM type of its format
+func DERToPEM(der []byte) ([]byte, error) {
+	if bytes.Contains(der, []byte("-----BEGIN")) {
+		return nil, errors.New("already PEM")
+	}
+	pemType, err := derPEMType(der)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: pemType, Bytes: der}), nil
+}
+
+// derPEMType returns the PEM type of a DER-encoded object
+func derPEMType(der []byte) (string, error) {
+	if _, err := x509.ParseCertificate(der); err == nil {
+		return "CERTIFICATE", nil
+	}
+	if _, err := x509.ParseCertificateRequest(der); err == nil {
+		return "CERTIFICATE REQUEST", nil
+	}
+	if _, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return "RSA PRIVATE KEY", nil
+	}
+	if _, err := x509.ParsePKCS8PrivateKey(der); err == nil {
+		return "PRIVATE KEY", nil
+	}
+	if _, err := x509.ParseECPrivateKey(der); err == nil {
+		return "EC PRIVATE KEY", nil
+	}
+	if isEncryptedPKCS8(der) {
+		return "ENCRYPTED PRIVATE KEY", nil
+	}
+	if _, err := x509.ParsePKIXPublicKey(der); err == nil {
+		return "PUBLIC KEY", nil
+	}
+	if _, err := x509.ParsePKCS1PublicKey(der); err == nil {
+		return "RSA PUBLIC KEY", nil
+	}
+	if _, err := ParseCRL(der); err == nil {
+		return "X509 CRL", nil
+	}
+	if _, err := ParsePKCS7(der); err == nil {
+		return "PKCS7", nil
+	}
+	if IsPKCS12(der) {
+		return "", errors.New("PKCS#12 files have no PEM form; use 'convert pkcs12 read'")
+	}
+	return "", errors.New("neither a DER-encoded certificate, CSR, key, CRL nor PKCS#7")
+}
+
+// isEncryptedPKCS8 reports whether der is an EncryptedPrivateKeyInfo, encrypted with PKCS#5 or PKCS#12
+// password-based encryption
+func isEncryptedPKCS8(der []byte) bool {
+	var info encryptedPrivateKeyInfo
+	rest, err := asn1.Unmarshal(der, &info)
+	if err != nil || len(rest) != 0 || len(info.EncryptedData) == 0 {
+		return false
+	}
+	oid := info.Algorithm.Algorithm
+	for _, prefix := range []asn1.ObjectIdentifier{oidPKCS5, oidPKCS12PBE} {
+		if len(oid) > len(prefix) && oid[:len(prefix)].Equal(prefix) {
+			return true
+		}
+	}
+	return false
+}
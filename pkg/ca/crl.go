@@ -0,0 +1,215 @@
+package ca
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// RevocationReason is an RFC 5280 CRL reason code
+type RevocationReason int
+
+const (
+	ReasonUnspecified          RevocationReason = 0
+	ReasonKeyCompromise        RevocationReason = 1
+	ReasonCACompromise         RevocationReason = 2
+	ReasonAffiliationChanged   RevocationReason = 3
+	ReasonSuperseded           RevocationReason = 4
+	ReasonCessationOfOperation RevocationReason = 5
+	ReasonCertificateHold      RevocationReason = 6
+	ReasonRemoveFromCRL        RevocationReason = 8
+	ReasonPrivilegeWithdrawn   RevocationReason = 9
+	ReasonAACompromise         RevocationReason = 10
+)
+
+var revocationReasonNames = map[RevocationReason]string{
+	ReasonUnspecified:          "unspecified",
+	ReasonKeyCompromise:        "keyCompromise",
+	ReasonCACompromise:         "cACompromise",
+	ReasonAffiliationChanged:   "affiliationChanged",
+	ReasonSuperseded:           "superseded",
+	ReasonCessationOfOperation: "cessationOfOperation",
+	ReasonCertificateHold:      "certificateHold",
+	ReasonRemoveFromCRL:        "removeFromCRL",
+	ReasonPrivilegeWithdrawn:   "privilegeWithdrawn",
+	ReasonAACompromise:         "aACompromise",
+}
+
+// oidExtensionReasonCode is the CRL entry extension holding the revocation reason
+var oidExtensionReasonCode = asn1.ObjectIdentifier{2, 5, 29, 21}
+
+// revocationReasons are the reasons with which a certificate can be revoked, in code order.
+// removeFromCRL is not one of them: it is only used in delta CRLs, to take a certificate off hold.
+var revocationReasons = []RevocationReason{
+	ReasonUnspecified, ReasonKeyCompromise, ReasonCACompromise, ReasonAffiliationChanged, ReasonSuperseded,
+	ReasonCessationOfOperation, ReasonCertificateHold, ReasonPrivilegeWithdrawn, ReasonAACompromise,
+}
+
+// RevocationReasonNames returns the names of the reasons with which a certificate can be revoked
+func RevocationReasonNames() []string {
+	names := make([]string, 0, len(revocationReasons))
+	for _, r := range revocationReasons {
+		names = append(names, r.String())
+	}
+	return names
+}
+
+// ParseRevocationReason converts an RFC 5280 reason name, e.g. keyCompromise, into a RevocationReason
+// with which a certificate can be revoked
+func ParseRevocationReason(name string) (RevocationReason, error) {
+	for _, r := range revocationReasons {
+		if r.String() == name {
+			return r, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid revocation reason %s, must be one of: %s", name, strings.Join(RevocationReasonNames(), ", "))
+}
+
+func (r RevocationReason) String() string {
+	if name, ok := revocationReasonNames[r]; ok {
+		return name
+	}
+	return fmt.Sprintf("RevocationReason(%d)", int(r))
+}
+
+// MarshalText encodes the reason as its RFC 5280 name
+func (r RevocationReason) MarshalText() ([]byte, error) {
+	if _, ok := revocationReasonNames[r]; !ok {
+		return nil, fmt.Errorf("unknown revocation reason: %d", int(r))
+	}
+	return []byte(r.String()), nil
+}
+
+// UnmarshalText decodes the reason from its RFC 5280 name
+func (r *RevocationReason) UnmarshalText(text []byte) error {
+	for reason, name := range revocationReasonNames {
+		if name == string(text) {
+			*r = reason
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown revocation reason: %s", text)
+}
+
+// CRLOptions describe a certificate revocation list to be signed
+type CRLOptions struct {
+	// Number is the CRL number, which must increase with every CRL the CA issues
+	Number *big.Int
+	// ThisUpdate is when the CRL is issued, now if not set
+	ThisUpdate time.Time
+	// NextUpdate is when the next CRL will be issued
+	NextUpdate time.Time
+}
+
+// CreateCRL creates a CRL signed by the CA, listing every revoked certificate in entries.
+// The CA certificate must have the CRLSign key usage.
+func (c *CA) CreateCRL(entries []IndexEntry, opts CRLOptions) ([]byte, error) {
+	if opts.ThisUpdate.IsZero() {
+		opts.ThisUpdate = time.Now()
+	}
+	revoked := make([]pkix.RevokedCertificate, 0)
+	for _, e := range entries {
+		if !e.Revoked() {
+			continue
+		}
+		serial, err := e.SerialNumber()
+		if err != nil {
+			return nil, err
+		}
+		rc := pkix.RevokedCertificate{
+			SerialNumber:   serial,
+			RevocationTime: e.RevokedAt.UTC(),
+		}
+		// RFC 5280 5.3.1: the reason code extension should be absent rather than unspecified
+		if e.RevocationReason != ReasonUnspecified {
+			value, err := asn1.Marshal(asn1.Enumerated(e.RevocationReason))
+			if err != nil {
+				return nil, err
+			}
+			rc.Extensions = []pkix.Extension{{Id: oidExtensionReasonCode, Value: value}}
+		}
+		revoked = append(revoked, rc)
+	}
+	template := &x509.RevocationList{
+		RevokedCertificates: revoked,
+		Number:              opts.Number,
+		ThisUpdate:          opts.ThisUpdate,
+		NextUpdate:          opts.NextUpdate,
+	}
+	b, err := x509.CreateRevocationList(rand.Reader, template, c.Certificate, c.Key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create CRL: %v", err)
+	}
+	return b, nil
+}
+
+// WriteCRL writes the DER-encoded CRL to w, PEM-encoded
+func WriteCRL(w io.Writer, der []byte) error {
+	return pem.Encode(w, &pem.Block{Type: "X509 CRL", Bytes: der})
+}
+
+var oidExtensionCRLNumber = asn1.ObjectIdentifier{2, 5, 29, 20}
+
+// CRL is a parsed certificate revocation list
+type CRL struct {
+	Issuer pkix.Name
+	// Number is nil if the CRL has none
+	Number     *big.Int
+	ThisUpdate time.Time
+	NextUpdate time.Time
+	Revoked    []RevokedCertificate
+	// List is the CRL as parsed by x509, e.g. to check its signature with x509.Certificate.CheckCRLSignature
+	List *pkix.CertificateList
+}
+
+// RevokedCertificate is an entry in a CRL
+type RevokedCertificate struct {
+	SerialNumber *big.Int
+	RevokedAt    time.Time
+	Reason       RevocationReason
+}
+
+// ParseCRL parses a DER-encoded CRL
+func ParseCRL(der []byte) (*CRL, error) {
+	list, err := x509.ParseDERCRL(der)
+	if err != nil {
+		return nil, err
+	}
+	var issuer pkix.Name
+	issuer.FillFromRDNSequence(&list.TBSCertList.Issuer)
+	crl := &CRL{
+		Issuer:     issuer,
+		ThisUpdate: list.TBSCertList.ThisUpdate,
+		NextUpdate: list.TBSCertList.NextUpdate,
+		List:       list,
+	}
+	for _, ext := range list.TBSCertList.Extensions {
+		if ext.Id.Equal(oidExtensionCRLNumber) {
+			crl.Number = new(big.Int)
+			if _, err := asn1.Unmarshal(ext.Value, &crl.Number); err != nil {
+				return nil, fmt.Errorf("invalid CRL number: %v", err)
+			}
+		}
+	}
+	for _, rc := range list.TBSCertList.RevokedCertificates {
+		entry := RevokedCertificate{SerialNumber: rc.SerialNumber, RevokedAt: rc.RevocationTime}
+		for _, ext := range rc.Extensions {
+			if ext.Id.Equal(oidExtensionReasonCode) {
+				var reason asn1.Enumerated
+				if _, err := asn1.Unmarshal(ext.Value, &reason); err != nil {
+					return nil, fmt.Errorf("invalid reason code for %s: %v", SerialString(rc.SerialNumber), err)
+				}
+				entry.Reason = RevocationReason(reason)
+			}
+		}
+		crl.Revoked = append(crl.Revoked, entry)
+	}
+	return crl, nil
+}
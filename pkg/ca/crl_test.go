@@ -0,0 +1,35 @@
+package ca
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseRevocationReason(t *testing.T) {
+	tests := []struct {
+		name   string
+		reason RevocationReason
+		err    string
+	}{
+		{"unspecified", ReasonUnspecified, ""},
+		{"keyCompromise", ReasonKeyCompromise, ""},
+		{"certificateHold", ReasonCertificateHold, ""},
+		{"aACompromise", ReasonAACompromise, ""},
+		{"removeFromCRL", 0, "must be one of: unspecified, keyCompromise"},
+		{"keycompromise", 0, "invalid revocation reason keycompromise"},
+	}
+	for _, tt := range tests {
+		reason, err := ParseRevocationReason(tt.name)
+		switch {
+		case tt.err == "" && err != nil:
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+		case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+			t.Errorf("%s: error %v, expected %q", tt.name, err, tt.err)
+		case tt.err == "" && reason != tt.reason:
+			t.Errorf("%s: got %v", tt.name, reason)
+		}
+	}
+	if strings.Contains(strings.Join(RevocationReasonNames(), ","), "removeFromCRL") {
+		t.Error("removeFromCRL is listed as a revocation reason")
+	}
+}
@@ -0,0 +1,111 @@
+package ca
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// CSROptions describe a certificate signing request
+type CSROptions struct {
+	Subject pkix.Name
+	// RawSubject is the DER-encoded subject, e.g. from MarshalDN; if set, it is used instead of Subject
+	RawSubject []byte
+	SANs
+	// SignatureAlgorithm is the algorithm with which the key signs the CSR; if unknown, the default for
+	// the key
+	SignatureAlgorithm x509.SignatureAlgorithm
+}
+
+// CreateCSR creates a certificate signing request signed by key
+func CreateCSR(opts CSROptions, key crypto.PrivateKey) (*x509.CertificateRequest, error) {
+	if signer, ok := key.(crypto.Signer); ok {
+		if err := CheckSignatureAlgorithm(opts.SignatureAlgorithm, signer.Public()); err != nil {
+			return nil, err
+		}
+	}
+	template := x509.CertificateRequest{
+		Subject:            opts.Subject,
+		RawSubject:         opts.RawSubject,
+		SignatureAlgorithm: opts.SignatureAlgorithm,
+	}
+	opts.SANs.apply(&template.DNSNames, &template.IPAddresses, &template.EmailAddresses, &template.URIs, &template.ExtraExtensions, isEmptySubject(opts.Subject, opts.RawSubject))
+	b, err := x509.CreateCertificateRequest(rand.Reader, &template, key)
+	if err != nil {
+		return nil, err
+	}
+	return x509.ParseCertificateRequest(b)
+}
+
+// WriteCSR writes the certificate signing request to w, PEM-encoded
+func WriteCSR(w io.Writer, csr *x509.CertificateRequest) error {
+	return pem.Encode(w, &pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr.Raw})
+}
+
+// ParseCSRPEM parses the first PEM-encoded certificate signing request in b
+func ParseCSRPEM(b []byte) (*x509.CertificateRequest, error) {
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, errors.New("no valid PEM")
+	}
+	return x509.ParseCertificateRequest(block.Bytes)
+}
+
+// CSRAttribute is an attribute of a certificate signing request, PKCS#10 section 4.1
+type CSRAttribute struct {
+	Type asn1.ObjectIdentifier
+	// Values are the string values of the attribute, or hex-encoded DER for those that are not strings
+	Values []string
+}
+
+// csrAttributeNames are the names of well-known CSR attributes, PKCS#9
+var csrAttributeNames = map[string]string{
+	"1.2.840.113549.1.9.2":  "unstructuredName",
+	"1.2.840.113549.1.9.7":  "challengePassword",
+	"1.2.840.113549.1.9.14": "extensionRequest",
+}
+
+// Name returns the name of the attribute type if well known, or else its OID
+func (a CSRAttribute) Name() string {
+	if name, ok := csrAttributeNames[a.Type.String()]; ok {
+		return name
+	}
+	return a.Type.String()
+}
+
+// CSRAttributes returns all of the attributes of csr, which x509 only parses for extension requests
+func CSRAttributes(csr *x509.CertificateRequest) ([]CSRAttribute, error) {
+	var tbs struct {
+		Version    int
+		Subject    asn1.RawValue
+		PublicKey  asn1.RawValue
+		Attributes []struct {
+			Type   asn1.ObjectIdentifier
+			Values []asn1.RawValue `asn1:"set"`
+		} `asn1:"tag:0"`
+	}
+	if _, err := asn1.Unmarshal(csr.RawTBSCertificateRequest, &tbs); err != nil {
+		return nil, fmt.Errorf("invalid certificate request: %v", err)
+	}
+	attributes := make([]CSRAttribute, 0, len(tbs.Attributes))
+	for _, attr := range tbs.Attributes {
+		a := CSRAttribute{Type: attr.Type}
+		for _, v := range attr.Values {
+			var s string
+			if _, err := asn1.Unmarshal(v.FullBytes, &s); err == nil {
+				a.Values = append(a.Values, s)
+			} else {
+				a.Values = append(a.Values, hex.EncodeToString(v.FullBytes))
+			}
+		}
+		attributes = append(attributes, a)
+	}
+	return attributes, nil
+}
@@ -0,0 +1,301 @@
+package ca
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"time"
+)
+
+// StartTLS protocols, which negotiate TLS on a plaintext connection
+var startTLSProtocols = map[string]struct {
+	port      string
+	negotiate func(conn net.Conn) error
+}{
+	"smtp":     {"25", startTLSSMTP},
+	"imap":     {"143", startTLSIMAP},
+	"postgres": {"5432", startTLSPostgres},
+	"ldap":     {"389", startTLSLDAP},
+}
+
+// StartTLSProtocols returns the names of the supported StartTLS protocols, sorted
+func StartTLSProtocols() []string {
+	names := make([]string, 0, len(startTLSProtocols))
+	for name := range startTLSProtocols {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// FetchOptions describe how to connect to a TLS endpoint
+type FetchOptions struct {
+	// ServerName is sent as SNI; if empty, the host of the address, unless it is an IP address
+	ServerName string
+	// StartTLS is the protocol with which to negotiate TLS, one of StartTLSProtocols, or empty for TLS
+	// from the start
+	StartTLS string
+	// Timeout limits connecting and the handshake; if zero, 10 seconds
+	Timeout time.Duration
+}
+
+// FetchResult is what a TLS endpoint presented in the handshake
+type FetchResult struct {
+	// Certificates are the chain presented by the server, leaf first
+	Certificates []*x509.Certificate
+	Version      uint16
+	CipherSuite  uint16
+	// OCSPResponse is the DER-encoded stapled OCSP response, if any
+	OCSPResponse []byte
+	// Host is the host connected to, and ServerName the SNI sent, if any
+	Host       string
+	ServerName string
+}
+
+// Fetch connects to address, host:port, completes a TLS handshake and returns the certificates
+// presented, without verifying them. If address has no port, the default for the StartTLS protocol is
+// used, or 443.
+func Fetch(address string, opts FetchOptions) (*FetchResult, error) {
+	timeout := opts.Timeout
+	if timeout == 0 {
+		timeout = 10 * time.Second
+	}
+	port := "443"
+	var negotiate func(net.Conn) error
+	if opts.StartTLS != "" {
+		proto, ok := startTLSProtocols[strings.ToLower(opts.StartTLS)]
+		if !ok {
+			return nil, fmt.Errorf("unknown StartTLS protocol %s, must be one of: %s", opts.StartTLS, strings.Join(StartTLSProtocols(), ", "))
+		}
+		port, negotiate = proto.port, proto.negotiate
+	}
+	host, p, err := net.SplitHostPort(address)
+	if err != nil {
+		// no port
+		host, p = strings.Trim(address, "[]"), port
+	}
+	address = net.JoinHostPort(host, p)
+	serverName := opts.ServerName
+	if serverName == "" && net.ParseIP(host) == nil {
+		serverName = host
+	}
+
+	conn, err := net.DialTimeout("tcp", address, timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, err
+	}
+	if negotiate != nil {
+		if err := negotiate(conn); err != nil {
+			return nil, fmt.Errorf("%s StartTLS failed: %v", opts.StartTLS, err)
+		}
+	}
+	// the chain is returned to be verified by the caller, with its own roots and purpose
+	tlsConn := tls.Client(conn, &tls.Config{ServerName: serverName, InsecureSkipVerify: true})
+	if err := tlsConn.Handshake(); err != nil {
+		return nil, fmt.Errorf("TLS handshake with %s failed: %v", address, err)
+	}
+	state := tlsConn.ConnectionState()
+	return &FetchResult{
+		Certificates: state.PeerCertificates,
+		Version:      state.Version,
+		CipherSuite:  state.CipherSuite,
+		OCSPResponse: state.OCSPResponse,
+		Host:         host,
+		ServerName:   serverName,
+	}, nil
+}
+
+// TLSVersionName returns the name of a TLS version, e.g. TLS 1.3
+func TLSVersionName(version uint16) string {
+	switch version {
+	case tls.VersionTLS10:
+		return "TLS 1.0"
+	case tls.VersionTLS11:
+		return "TLS 1.1"
+	case tls.VersionTLS12:
+		return "TLS 1.2"
+	case tls.VersionTLS13:
+		return "TLS 1.3"
+	}
+	return fmt.Sprintf("0x%04X", version)
+}
+
+// startTLSSMTP negotiates TLS with an RFC 3207 SMTP server
+func startTLSSMTP(conn net.Conn) error {
+	r := bufio.NewReader(conn)
+	if err := readSMTPReply(r, "220"); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(conn, "EHLO ca\r\n"); err != nil {
+		return err
+	}
+	if err := readSMTPReply(r, "250"); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(conn, "STARTTLS\r\n"); err != nil {
+		return err
+	}
+	return readSMTPReply(r, "220")
+}
+
+// readSMTPReply reads a possibly multi-line SMTP reply, which must have code
+func readSMTPReply(r *bufio.Reader, code string) error {
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		if !strings.HasPrefix(line, code) {
+			return fmt.Errorf("unexpected reply: %s", strings.TrimSpace(line))
+		}
+		// the last line of a reply has a space after the code, the others a '-'
+		if len(line) <= len(code) || line[len(code)] != '-' {
+			return nil
+		}
+	}
+}
+
+// startTLSIMAP negotiates TLS with an RFC 2595 IMAP server
+func startTLSIMAP(conn net.Conn) error {
+	r := bufio.NewReader(conn)
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, "* OK") {
+		return fmt.Errorf("unexpected greeting: %s", strings.TrimSpace(line))
+	}
+	if _, err := io.WriteString(conn, "a001 STARTTLS\r\n"); err != nil {
+		return err
+	}
+	for {
+		if line, err = r.ReadString('\n'); err != nil {
+			return err
+		}
+		// skip untagged responses
+		if strings.HasPrefix(line, "* ") {
+			continue
+		}
+		if !strings.HasPrefix(line, "a001 OK") {
+			return fmt.Errorf("unexpected reply: %s", strings.TrimSpace(line))
+		}
+		return nil
+	}
+}
+
+// postgresSSLRequest is the code of the PostgreSQL SSLRequest message
+const postgresSSLRequest = 80877103
+
+// startTLSPostgres negotiates TLS with a PostgreSQL server
+func startTLSPostgres(conn net.Conn) error {
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint32(msg[0:4], 8)
+	binary.BigEndian.PutUint32(msg[4:8], postgresSSLRequest)
+	if _, err := conn.Write(msg); err != nil {
+		return err
+	}
+	reply := make([]byte, 1)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return err
+	}
+	if reply[0] != 'S' {
+		return errors.New("server does not support SSL")
+	}
+	return nil
+}
+
+// oidLDAPStartTLS is the RFC 4511 StartTLS extended operation
+const oidLDAPStartTLS = "1.3.6.1.4.1.1466.20037"
+
+type ldapExtendedRequest struct {
+	Name []byte `asn1:"tag:0"`
+}
+
+type ldapMessage struct {
+	MessageID int
+	Request   ldapExtendedRequest `asn1:"application,tag:23"`
+}
+
+// startTLSLDAP negotiates TLS with an RFC 4511 LDAP server
+func startTLSLDAP(conn net.Conn) error {
+	// LDAPMessage { messageID 1, ExtendedRequest [APPLICATION 23] { requestName [0] oid } }
+	request, err := asn1.Marshal(ldapMessage{MessageID: 1, Request: ldapExtendedRequest{Name: []byte(oidLDAPStartTLS)}})
+	if err != nil {
+		return err
+	}
+	if _, err := conn.Write(request); err != nil {
+		return err
+	}
+	reply, err := readBERElement(conn)
+	if err != nil {
+		return err
+	}
+	// LDAPMessage { messageID, ExtendedResponse [APPLICATION 24] { resultCode, matchedDN, diagnosticMessage, ... } }
+	var msg struct {
+		MessageID int
+		Response  asn1.RawValue
+	}
+	if _, err := asn1.Unmarshal(reply, &msg); err != nil {
+		return fmt.Errorf("invalid response: %v", err)
+	}
+	if msg.Response.Class != asn1.ClassApplication || msg.Response.Tag != 24 {
+		return fmt.Errorf("unexpected response with tag %d", msg.Response.Tag)
+	}
+	var result asn1.Enumerated
+	rest, err := asn1.Unmarshal(msg.Response.Bytes, &result)
+	if err != nil {
+		return fmt.Errorf("invalid response: %v", err)
+	}
+	if result != 0 {
+		var matchedDN, message []byte
+		if rest, err = asn1.Unmarshal(rest, &matchedDN); err == nil {
+			_, _ = asn1.Unmarshal(rest, &message)
+		}
+		return fmt.Errorf("server refused with result code %d: %s", result, message)
+	}
+	return nil
+}
+
+// readBERElement reads a single definite-length BER element
+func readBERElement(r io.Reader) ([]byte, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	length := int(header[1])
+	if header[1]&0x80 != 0 {
+		n := int(header[1] & 0x7f)
+		if n == 0 || n > 4 {
+			return nil, fmt.Errorf("unsupported length encoding")
+		}
+		lengthBytes := make([]byte, n)
+		if _, err := io.ReadFull(r, lengthBytes); err != nil {
+			return nil, err
+		}
+		header = append(header, lengthBytes...)
+		length = 0
+		for _, b := range lengthBytes {
+			length = length<<8 | int(b)
+		}
+	}
+	if length > 1<<20 {
+		return nil, fmt.Errorf("response too long")
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	return append(header, body...), nil
+}
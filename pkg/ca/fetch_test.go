@@ -0,0 +1,250 @@
+package ca
+
+import (
+	"bufio"
+	"bytes"
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// fetchTestServer is a CA store, and a TLS configuration for a server certificate it issued with a
+// stapled OCSP response
+type fetchTestServer struct {
+	store  *Store
+	leaf   *x509.Certificate
+	config *tls.Config
+	// serverNames receives the SNI of each handshake
+	serverNames chan string
+}
+
+func newFetchTestServer(t *testing.T) *fetchTestServer {
+	t.Helper()
+	store := newTestStore(t)
+	key, err := GenerateKey(KeyOptions{Type: ECDSA})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sans, err := ParseSANs([]string{"test.example"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := store.Sign(CertificateOptions{Subject: pkix.Name{CommonName: "test.example"}, Days: 1, SANs: *sans, ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}}.Template(), key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	staple, err := ocsp.CreateResponse(store.CA.Certificate, store.CA.Certificate, ocsp.Response{
+		Status:       ocsp.Good,
+		SerialNumber: leaf.SerialNumber,
+		ThisUpdate:   time.Now().Truncate(time.Minute),
+		NextUpdate:   time.Now().Add(time.Hour),
+	}, store.CA.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fetchTestServer{store: store, leaf: leaf, serverNames: make(chan string, 10)}
+	cert := tls.Certificate{Certificate: [][]byte{leaf.Raw, store.CA.Certificate.Raw}, PrivateKey: key.(crypto.PrivateKey), OCSPStaple: staple}
+	s.config = &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			s.serverNames <- hello.ServerName
+			return nil, nil
+		},
+	}
+	return s
+}
+
+// check checks that result is what the server presented, with the given SNI
+func (s *fetchTestServer) check(t *testing.T, name string, result *FetchResult, serverName string) {
+	t.Helper()
+	if len(result.Certificates) != 2 || !result.Certificates[0].Equal(s.leaf) || !result.Certificates[1].Equal(s.store.CA.Certificate) {
+		t.Errorf("%s: presented %d certificates, expected the leaf and CA", name, len(result.Certificates))
+	}
+	if result.Version < tls.VersionTLS12 || result.CipherSuite == 0 {
+		t.Errorf("%s: version %s, cipher suite %x", name, TLSVersionName(result.Version), result.CipherSuite)
+	}
+	if result.ServerName != serverName {
+		t.Errorf("%s: result server name %q, expected %q", name, result.ServerName, serverName)
+	}
+	select {
+	case sni := <-s.serverNames:
+		if sni != serverName {
+			t.Errorf("%s: server received SNI %q, expected %q", name, sni, serverName)
+		}
+	default:
+		t.Errorf("%s: server did not handshake", name)
+	}
+	resp, err := ocsp.ParseResponseForCert(result.OCSPResponse, s.leaf, s.store.CA.Certificate)
+	if err != nil {
+		t.Errorf("%s: stapled OCSP response: %v", name, err)
+	} else if resp.Status != ocsp.Good {
+		t.Errorf("%s: stapled OCSP status %d", name, resp.Status)
+	}
+}
+
+func TestFetchTLS(t *testing.T) {
+	s := newFetchTestServer(t)
+	srv := httptest.NewUnstartedServer(http.NotFoundHandler())
+	srv.TLS = s.config
+	// Fetch hangs up straight after the handshake, which the server would log
+	srv.Config.ErrorLog = log.New(io.Discard, "", 0)
+	srv.StartTLS()
+	defer srv.Close()
+	address := strings.TrimPrefix(srv.URL, "https://")
+
+	// an IP address is not sent as SNI
+	result, err := Fetch(address, FetchOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.check(t, "no SNI", result, "")
+	if result.Host != "127.0.0.1" {
+		t.Errorf("host %s", result.Host)
+	}
+
+	result, err = Fetch(address, FetchOptions{ServerName: "test.example"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.check(t, "SNI", result, "test.example")
+
+	_, port, _ := net.SplitHostPort(address)
+	result, err = Fetch(net.JoinHostPort("localhost", port), FetchOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.check(t, "hostname", result, "localhost")
+}
+
+// startTLSServers are fake servers for each StartTLS protocol, which negotiate on the plaintext
+// connection before the TLS handshake
+var startTLSServers = map[string]func(conn net.Conn, r *bufio.Reader) error{
+	"smtp": func(conn net.Conn, r *bufio.Reader) error {
+		fmt.Fprint(conn, "220 mail.test ESMTP\r\n")
+		if line, _ := r.ReadString('\n'); !strings.HasPrefix(line, "EHLO ") {
+			return fmt.Errorf("expected EHLO, got %q", line)
+		}
+		fmt.Fprint(conn, "250-mail.test\r\n250-SIZE 1000\r\n250 STARTTLS\r\n")
+		if line, _ := r.ReadString('\n'); line != "STARTTLS\r\n" {
+			return fmt.Errorf("expected STARTTLS, got %q", line)
+		}
+		fmt.Fprint(conn, "220 go ahead\r\n")
+		return nil
+	},
+	"imap": func(conn net.Conn, r *bufio.Reader) error {
+		fmt.Fprint(conn, "* OK IMAP4rev1 ready\r\n")
+		if line, _ := r.ReadString('\n'); line != "a001 STARTTLS\r\n" {
+			return fmt.Errorf("expected STARTTLS, got %q", line)
+		}
+		fmt.Fprint(conn, "* CAPABILITY IMAP4rev1\r\na001 OK begin TLS\r\n")
+		return nil
+	},
+	"postgres": func(conn net.Conn, r *bufio.Reader) error {
+		msg := make([]byte, 8)
+		if _, err := io.ReadFull(r, msg); err != nil {
+			return err
+		}
+		if binary.BigEndian.Uint32(msg[0:4]) != 8 || binary.BigEndian.Uint32(msg[4:8]) != postgresSSLRequest {
+			return fmt.Errorf("expected SSLRequest, got %x", msg)
+		}
+		_, err := conn.Write([]byte{'S'})
+		return err
+	},
+	"ldap": func(conn net.Conn, r *bufio.Reader) error {
+		request, err := readBERElement(r)
+		if err != nil {
+			return err
+		}
+		if !bytes.Contains(request, []byte(oidLDAPStartTLS)) {
+			return fmt.Errorf("expected StartTLS extended request, got %x", request)
+		}
+		// LDAPMessage { 1, ExtendedResponse { success, "", "" } }
+		_, err = conn.Write([]byte{0x30, 0x0c, 0x02, 0x01, 0x01, 0x78, 0x07, 0x0a, 0x01, 0x00, 0x04, 0x00, 0x04, 0x00})
+		return err
+	},
+}
+
+func TestFetchStartTLS(t *testing.T) {
+	s := newFetchTestServer(t)
+	for _, proto := range StartTLSProtocols() {
+		negotiate, ok := startTLSServers[proto]
+		if !ok {
+			t.Errorf("no test server for %s", proto)
+			continue
+		}
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		errs := make(chan error, 1)
+		go func() {
+			conn, err := ln.Accept()
+			if err != nil {
+				errs <- err
+				return
+			}
+			defer conn.Close()
+			// the client sends nothing more until the negotiation is done, so nothing is left buffered
+			if err := negotiate(conn, bufio.NewReader(conn)); err != nil {
+				errs <- err
+				return
+			}
+			errs <- tls.Server(conn, s.config).Handshake()
+		}()
+		result, err := Fetch(ln.Addr().String(), FetchOptions{StartTLS: strings.ToUpper(proto), ServerName: "test.example", Timeout: 5 * time.Second})
+		if err != nil {
+			t.Errorf("%s: %v", proto, err)
+		} else {
+			s.check(t, proto, result, "test.example")
+		}
+		if err := <-errs; err != nil {
+			t.Errorf("%s server: %v", proto, err)
+		}
+		ln.Close()
+	}
+
+	if _, err := Fetch("127.0.0.1:1", FetchOptions{StartTLS: "pop3"}); err == nil || !strings.Contains(err.Error(), "must be one of: imap, ldap, postgres, smtp") {
+		t.Errorf("unknown protocol: %v", err)
+	}
+}
+
+func TestStartTLSRefused(t *testing.T) {
+	tests := []struct {
+		proto  string
+		server string
+		err    string
+	}{
+		{"smtp", "220 mail.test\r\n250 mail.test\r\n454 TLS not available\r\n", "unexpected reply: 454 TLS not available"},
+		{"smtp", "554 go away\r\n", "unexpected reply: 554 go away"},
+		{"imap", "* OK ready\r\na001 BAD unknown command\r\n", "unexpected reply: a001 BAD"},
+		{"imap", "* BYE\r\n", "unexpected greeting"},
+		{"postgres", "N", "server does not support SSL"},
+		// LDAPMessage { 1, ExtendedResponse { protocolError, "", "nope" } }
+		{"ldap", "\x30\x10\x02\x01\x01\x78\x0b\x0a\x01\x02\x04\x00\x04\x04nope", "result code 2: nope"},
+	}
+	for _, tt := range tests {
+		client, server := net.Pipe()
+		// the server writes its replies, discarding whatever the client sends
+		go func() { _, _ = io.Copy(io.Discard, server) }()
+		go func() { _, _ = io.WriteString(server, tt.server) }()
+		err := startTLSProtocols[tt.proto].negotiate(client)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s %q: error %v, expected %q", tt.proto, tt.server, err, tt.err)
+		}
+		client.Close()
+		server.Close()
+	}
+}
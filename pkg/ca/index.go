@@ -0,0 +1,162 @@
+package ca
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// CRLNumberFile is the file, alongside the index, that holds the number of the next CRL
+const CRLNumberFile = "crlnumber"
+
+// IndexEntry is the record of a single certificate issued by a CA
+type IndexEntry struct {
+	// Serial is the serial number in hex
+	Serial    string    `json:"serial"`
+	Subject   string    `json:"subject"`
+	NotBefore time.Time `json:"notBefore"`
+	NotAfter  time.Time `json:"notAfter"`
+	IssuedAt  time.Time `json:"issuedAt"`
+	// RevokedAt is when the certificate was revoked, nil if it has not been
+	RevokedAt        *time.Time       `json:"revokedAt,omitempty"`
+	RevocationReason RevocationReason `json:"revocationReason,omitempty"`
+}
+
+// Revoked reports whether the certificate has been revoked
+func (e IndexEntry) Revoked() bool {
+	return e.RevokedAt != nil
+}
+
+// SerialNumber returns the serial number of the entry
+func (e IndexEntry) SerialNumber() (*big.Int, error) {
+	serial, ok := new(big.Int).SetString(e.Serial, 16)
+	if !ok {
+		return nil, fmt.Errorf("invalid serial number %s", e.Serial)
+	}
+	return serial, nil
+}
+
+// Index is the JSON file recording every certificate issued by a CA, and whether it has been revoked
+type Index struct {
+	Path string
+}
+
+// Entries returns all of the records in the index
+func (x Index) Entries() ([]IndexEntry, error) {
+	b, err := os.ReadFile(x.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read index: %v", err)
+	}
+	var entries []IndexEntry
+	if err := json.Unmarshal(b, &entries); err != nil {
+		return nil, fmt.Errorf("invalid index %s: %v", x.Path, err)
+	}
+	return entries, nil
+}
+
+// Lookup returns the record for serial, or nil if there is none
+func (x Index) Lookup(serial *big.Int) (*IndexEntry, error) {
+	entries, err := x.Entries()
+	if err != nil {
+		return nil, err
+	}
+	s := SerialString(serial)
+	for _, e := range entries {
+		if e.Serial == s {
+			return &e, nil
+		}
+	}
+	return nil, nil
+}
+
+// Add adds a record to the index. The serial number must not already be in the index.
+func (x Index) Add(entry IndexEntry) error {
+	unlock, err := lockFile(x.Path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	entries, err := x.Entries()
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if e.Serial == entry.Serial {
+			return fmt.Errorf("certificate with serial %s already issued", entry.Serial)
+		}
+	}
+	return x.write(append(entries, entry))
+}
+
+// Revoke marks the certificate with serial as revoked at the given time for reason, and
+// returns the updated record
+func (x Index) Revoke(serial *big.Int, reason RevocationReason, at time.Time) (*IndexEntry, error) {
+	if _, err := ParseRevocationReason(reason.String()); err != nil {
+		return nil, err
+	}
+	unlock, err := lockFile(x.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	entries, err := x.Entries()
+	if err != nil {
+		return nil, err
+	}
+	s := SerialString(serial)
+	for i := range entries {
+		if entries[i].Serial != s {
+			continue
+		}
+		if entries[i].Revoked() {
+			return nil, fmt.Errorf("certificate with serial %s already revoked", s)
+		}
+		at = at.UTC()
+		entries[i].RevokedAt = &at
+		entries[i].RevocationReason = reason
+		if err := x.write(entries); err != nil {
+			return nil, err
+		}
+		return &entries[i], nil
+	}
+	return nil, fmt.Errorf("no certificate with serial %s in index", s)
+}
+
+// NextCRLNumber returns the number for a new CRL, and advances the counter kept in
+// CRLNumberFile alongside the index, so CRL numbers always increase
+func (x Index) NextCRLNumber() (*big.Int, error) {
+	path := filepath.Join(filepath.Dir(x.Path), CRLNumberFile)
+	unlock, err := lockFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	number := big.NewInt(1)
+	b, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		var ok bool
+		if number, ok = new(big.Int).SetString(strings.TrimSpace(string(b)), 16); !ok {
+			return nil, fmt.Errorf("invalid CRL number in %s", path)
+		}
+	case !os.IsNotExist(err):
+		return nil, fmt.Errorf("failed to read CRL number: %v", err)
+	}
+	next := new(big.Int).Add(number, big.NewInt(1))
+	if err := writeFileAtomic(path, []byte(SerialString(next)+"\n"), 0600); err != nil {
+		return nil, err
+	}
+	return number, nil
+}
+
+func (x Index) write(entries []IndexEntry) error {
+	b, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(x.Path, b, 0600)
+}
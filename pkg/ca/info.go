@@ -0,0 +1,391 @@
+package ca
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"hash"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// ObjectInfo describes an object read from a file, for structured output. Which fields are set
+// depends on Type, unless Error is set:
+//
+//   - certificate: Certificate
+//   - certificateRequest: CertificateRequest
+//   - privateKey: PrivateKey
+//   - publicKey: PublicKey
+//   - crl: CRL
+//   - pkcs7: Certificates
+//   - pkcs12: Certificates, and PrivateKey if it has one
+//   - sshPublicKey and sshCertificate: SSH
+//   - sshPrivateKey: PrivateKey and SSH
+type ObjectInfo struct {
+	// Index is the position of the object in the file, starting at 1
+	Index int `json:"index" yaml:"index"`
+	// Type is one of certificate, certificateRequest, privateKey, publicKey, crl, pkcs7, pkcs12,
+	// sshPublicKey, sshCertificate, sshPrivateKey or unknown
+	Type string `json:"type" yaml:"type"`
+	// PEMType is the type of the PEM block, empty if not PEM
+	PEMType            string                  `json:"pemType,omitempty" yaml:"pemType,omitempty"`
+	Error              string                  `json:"error,omitempty" yaml:"error,omitempty"`
+	Certificate        *CertificateInfo        `json:"certificate,omitempty" yaml:"certificate,omitempty"`
+	CertificateRequest *CertificateRequestInfo `json:"certificateRequest,omitempty" yaml:"certificateRequest,omitempty"`
+	PrivateKey         *PrivateKeyInfo         `json:"privateKey,omitempty" yaml:"privateKey,omitempty"`
+	PublicKey          *PublicKeyInfo          `json:"publicKey,omitempty" yaml:"publicKey,omitempty"`
+	CRL                *CRLInfo                `json:"crl,omitempty" yaml:"crl,omitempty"`
+	Certificates       []*CertificateInfo      `json:"certificates,omitempty" yaml:"certificates,omitempty"`
+	SSH                *SSHInfo                `json:"ssh,omitempty" yaml:"ssh,omitempty"`
+}
+
+// CertificateInfo describes a certificate
+type CertificateInfo struct {
+	Subject string `json:"subject" yaml:"subject"`
+	Issuer  string `json:"issuer" yaml:"issuer"`
+	// Serial is in upper-case hex
+	Serial             string        `json:"serial" yaml:"serial"`
+	NotBefore          time.Time     `json:"notBefore" yaml:"notBefore"`
+	NotAfter           time.Time     `json:"notAfter" yaml:"notAfter"`
+	KeyUsage           []string      `json:"keyUsage" yaml:"keyUsage"`
+	ExtKeyUsage        []string      `json:"extKeyUsage" yaml:"extKeyUsage"`
+	IsCA               bool          `json:"isCA" yaml:"isCA"`
+	MaxPathLen         *int          `json:"maxPathLen,omitempty" yaml:"maxPathLen,omitempty"`
+	SANs               SANInfo       `json:"sans" yaml:"sans"`
+	PublicKey          PublicKeyInfo `json:"publicKey" yaml:"publicKey"`
+	SignatureAlgorithm string        `json:"signatureAlgorithm" yaml:"signatureAlgorithm"`
+	// Fingerprints are of the DER-encoded certificate
+	Fingerprints Fingerprints    `json:"fingerprints" yaml:"fingerprints"`
+	Extensions   []ExtensionInfo `json:"extensions" yaml:"extensions"`
+}
+
+// CertificateRequestInfo describes a certificate signing request
+type CertificateRequestInfo struct {
+	Subject            string          `json:"subject" yaml:"subject"`
+	SANs               SANInfo         `json:"sans" yaml:"sans"`
+	PublicKey          PublicKeyInfo   `json:"publicKey" yaml:"publicKey"`
+	SignatureAlgorithm string          `json:"signatureAlgorithm" yaml:"signatureAlgorithm"`
+	SignatureValid     bool            `json:"signatureValid" yaml:"signatureValid"`
+	Extensions         []ExtensionInfo `json:"extensions" yaml:"extensions"`
+}
+
+// PrivateKeyInfo describes a private key
+type PrivateKeyInfo struct {
+	PublicKey PublicKeyInfo `json:"publicKey" yaml:"publicKey"`
+	// Matches are the indexes of the certificates in the same file whose public key is this key's
+	Matches []int `json:"matches,omitempty" yaml:"matches,omitempty"`
+}
+
+// CRLInfo describes a certificate revocation list
+type CRLInfo struct {
+	Issuer string `json:"issuer" yaml:"issuer"`
+	// Number is in decimal, empty if the CRL has none
+	Number     string                   `json:"number,omitempty" yaml:"number,omitempty"`
+	ThisUpdate time.Time                `json:"thisUpdate" yaml:"thisUpdate"`
+	NextUpdate *time.Time               `json:"nextUpdate,omitempty" yaml:"nextUpdate,omitempty"`
+	Revoked    []RevokedCertificateInfo `json:"revoked" yaml:"revoked"`
+}
+
+// RevokedCertificateInfo describes an entry in a CRL
+type RevokedCertificateInfo struct {
+	// Serial is in upper-case hex
+	Serial    string    `json:"serial" yaml:"serial"`
+	RevokedAt time.Time `json:"revokedAt" yaml:"revokedAt"`
+	Reason    string    `json:"reason" yaml:"reason"`
+}
+
+// SSHInfo describes an OpenSSH key or certificate
+type SSHInfo struct {
+	// Type is the OpenSSH key type, e.g. ssh-ed25519
+	Type string `json:"type" yaml:"type"`
+	// Fingerprint is as shown by ssh-keygen -l, e.g. SHA256:...
+	Fingerprint string        `json:"fingerprint" yaml:"fingerprint"`
+	Comment     string        `json:"comment,omitempty" yaml:"comment,omitempty"`
+	PublicKey   PublicKeyInfo `json:"publicKey" yaml:"publicKey"`
+	// Certificate is set for SSH certificates; Fingerprint and PublicKey are then of the certified key
+	Certificate *SSHCertificateInfo `json:"certificate,omitempty" yaml:"certificate,omitempty"`
+}
+
+// SSHCertificateInfo describes an OpenSSH certificate
+type SSHCertificateInfo struct {
+	// CertType is user or host
+	CertType   string    `json:"certType" yaml:"certType"`
+	KeyID      string    `json:"keyId" yaml:"keyId"`
+	Serial     uint64    `json:"serial" yaml:"serial"`
+	Principals []string  `json:"principals" yaml:"principals"`
+	ValidAfter time.Time `json:"validAfter" yaml:"validAfter"`
+	// ValidBefore is not set if the certificate is valid forever
+	ValidBefore *time.Time `json:"validBefore,omitempty" yaml:"validBefore,omitempty"`
+	// CAFingerprint is the fingerprint of the signing CA key
+	CAFingerprint   string            `json:"caFingerprint" yaml:"caFingerprint"`
+	CriticalOptions map[string]string `json:"criticalOptions,omitempty" yaml:"criticalOptions,omitempty"`
+	Extensions      map[string]string `json:"extensions,omitempty" yaml:"extensions,omitempty"`
+}
+
+// PublicKeyInfo describes a public key
+type PublicKeyInfo struct {
+	// Algorithm is one of RSA, ECDSA or Ed25519
+	Algorithm string `json:"algorithm" yaml:"algorithm"`
+	// Size is in bits
+	Size int `json:"size" yaml:"size"`
+	// Curve is the ECDSA curve, e.g. P-256
+	Curve string `json:"curve,omitempty" yaml:"curve,omitempty"`
+	// Fingerprint is the SHA-256 fingerprint of the DER-encoded SubjectPublicKeyInfo
+	Fingerprint string `json:"fingerprint" yaml:"fingerprint"`
+}
+
+// SANInfo are subject alternative names by type
+type SANInfo struct {
+	DNS   []string `json:"dns,omitempty" yaml:"dns,omitempty"`
+	IP    []string `json:"ip,omitempty" yaml:"ip,omitempty"`
+	Email []string `json:"email,omitempty" yaml:"email,omitempty"`
+	URI   []string `json:"uri,omitempty" yaml:"uri,omitempty"`
+	UPN   []string `json:"upn,omitempty" yaml:"upn,omitempty"`
+}
+
+// Fingerprints are hashes of an object, in upper-case hex separated by colons
+type Fingerprints struct {
+	SHA1   string `json:"sha1" yaml:"sha1"`
+	SHA256 string `json:"sha256" yaml:"sha256"`
+}
+
+// ExtensionInfo describes an extension
+type ExtensionInfo struct {
+	OID string `json:"oid" yaml:"oid"`
+	// Name is empty for extensions that are not known
+	Name     string `json:"name,omitempty" yaml:"name,omitempty"`
+	Critical bool   `json:"critical" yaml:"critical"`
+}
+
+// extensionNames are the names of well-known extensions
+var extensionNames = map[string]string{
+	"2.5.29.14":               "subjectKeyIdentifier",
+	"2.5.29.15":               "keyUsage",
+	"2.5.29.17":               "subjectAltName",
+	"2.5.29.18":               "issuerAltName",
+	"2.5.29.19":               "basicConstraints",
+	"2.5.29.30":               "nameConstraints",
+	"2.5.29.31":               "cRLDistributionPoints",
+	"2.5.29.32":               "certificatePolicies",
+	"2.5.29.35":               "authorityKeyIdentifier",
+	"2.5.29.37":               "extKeyUsage",
+	"1.3.6.1.5.5.7.1.1":       "authorityInfoAccess",
+	"1.3.6.1.4.1.11129.2.4.2": "signedCertificateTimestamps",
+	"1.3.6.1.5.5.7.48.1.5":    "ocspNoCheck",
+}
+
+// DescribeObjects describes each of the objects, as read by ReadObjects
+func DescribeObjects(objects []Object) []ObjectInfo {
+	infos := make([]ObjectInfo, 0, len(objects))
+	for i, obj := range objects {
+		info := ObjectInfo{Index: i + 1, PEMType: obj.PEMType, Type: "unknown"}
+		switch {
+		case obj.Err != nil:
+			info.Error = obj.Err.Error()
+		case obj.Kind == KindCertificate:
+			info.Type, info.Certificate = "certificate", DescribeCertificate(obj.Certificate)
+		case obj.Kind == KindCSR:
+			info.Type, info.CertificateRequest = "certificateRequest", DescribeCertificateRequest(obj.CSR)
+		case obj.Kind == KindPrivateKey || obj.Kind == KindSSHPrivateKey:
+			info.Type, info.PrivateKey = "privateKey", DescribePrivateKey(obj.PrivateKey)
+			for j, other := range objects {
+				if other.Err == nil && other.Kind == KindCertificate && KeyMatches(obj.PrivateKey, other.Certificate.PublicKey) {
+					info.PrivateKey.Matches = append(info.PrivateKey.Matches, j+1)
+				}
+			}
+			if obj.Kind == KindSSHPrivateKey {
+				info.Type = "sshPrivateKey"
+				if signer, ok := obj.PrivateKey.(crypto.Signer); ok {
+					if pub, err := ssh.NewPublicKey(signer.Public()); err == nil {
+						info.SSH = DescribeSSHPublicKey(pub, "")
+					}
+				}
+			}
+		case obj.Kind == KindPublicKey:
+			pub := DescribePublicKey(obj.PublicKey)
+			info.Type, info.PublicKey = "publicKey", &pub
+		case obj.Kind == KindCRL:
+			info.Type, info.CRL = "crl", DescribeCRL(obj.CRL)
+		case obj.Kind == KindPKCS7 || obj.Kind == KindPKCS12:
+			info.Type = string(obj.Kind)
+			for _, cert := range obj.Certificates {
+				info.Certificates = append(info.Certificates, DescribeCertificate(cert))
+			}
+			if obj.PrivateKey != nil {
+				info.PrivateKey = DescribePrivateKey(obj.PrivateKey)
+			}
+		case obj.Kind == KindSSHPublicKey:
+			info.Type, info.SSH = "sshPublicKey", DescribeSSHPublicKey(obj.SSHPublicKey, obj.SSHComment)
+		case obj.Kind == KindSSHCertificate:
+			info.Type, info.SSH = "sshCertificate", DescribeSSHCertificate(obj.SSHCertificate, obj.SSHComment)
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+// DescribeCertificate describes a certificate
+func DescribeCertificate(cert *x509.Certificate) *CertificateInfo {
+	info := &CertificateInfo{
+		Subject:            cert.Subject.String(),
+		Issuer:             cert.Issuer.String(),
+		Serial:             SerialString(cert.SerialNumber),
+		NotBefore:          cert.NotBefore,
+		NotAfter:           cert.NotAfter,
+		KeyUsage:           KeyUsageStrings(cert.KeyUsage),
+		ExtKeyUsage:        ExtKeyUsageStrings(cert.ExtKeyUsage, cert.UnknownExtKeyUsage),
+		IsCA:               cert.IsCA,
+		PublicKey:          DescribePublicKey(cert.PublicKey),
+		SignatureAlgorithm: cert.SignatureAlgorithm.String(),
+		Fingerprints:       Fingerprints{SHA1: Fingerprint(sha1.New(), cert.Raw), SHA256: Fingerprint(sha256.New(), cert.Raw)},
+		Extensions:         describeExtensions(cert.Extensions),
+	}
+	if cert.IsCA && (cert.MaxPathLen > 0 || cert.MaxPathLenZero) {
+		pathLen := cert.MaxPathLen
+		info.MaxPathLen = &pathLen
+	}
+	if sans, err := SANsFromCertificate(cert); err == nil {
+		info.SANs = describeSANs(sans)
+	}
+	return info
+}
+
+// DescribeCertificateRequest describes a certificate signing request
+func DescribeCertificateRequest(csr *x509.CertificateRequest) *CertificateRequestInfo {
+	info := &CertificateRequestInfo{
+		Subject:            csr.Subject.String(),
+		PublicKey:          DescribePublicKey(csr.PublicKey),
+		SignatureAlgorithm: csr.SignatureAlgorithm.String(),
+		SignatureValid:     csr.CheckSignature() == nil,
+		Extensions:         describeExtensions(csr.Extensions),
+	}
+	if sans, err := SANsFromCSR(csr); err == nil {
+		info.SANs = describeSANs(sans)
+	}
+	return info
+}
+
+// DescribePrivateKey describes a private key by its public key
+func DescribePrivateKey(key crypto.PrivateKey) *PrivateKeyInfo {
+	info := &PrivateKeyInfo{PublicKey: PublicKeyInfo{Algorithm: fmt.Sprintf("%T", key)}}
+	if signer, ok := key.(crypto.Signer); ok {
+		info.PublicKey = DescribePublicKey(signer.Public())
+	}
+	return info
+}
+
+// DescribeCRL describes a certificate revocation list
+func DescribeCRL(crl *CRL) *CRLInfo {
+	info := &CRLInfo{Issuer: crl.Issuer.String(), ThisUpdate: crl.ThisUpdate, Revoked: make([]RevokedCertificateInfo, 0, len(crl.Revoked))}
+	if crl.Number != nil {
+		info.Number = crl.Number.String()
+	}
+	if !crl.NextUpdate.IsZero() {
+		next := crl.NextUpdate
+		info.NextUpdate = &next
+	}
+	for _, rc := range crl.Revoked {
+		info.Revoked = append(info.Revoked, RevokedCertificateInfo{Serial: SerialString(rc.SerialNumber), RevokedAt: rc.RevokedAt, Reason: rc.Reason.String()})
+	}
+	return info
+}
+
+// DescribeSSHPublicKey describes an OpenSSH public key
+func DescribeSSHPublicKey(pub ssh.PublicKey, comment string) *SSHInfo {
+	info := &SSHInfo{Type: pub.Type(), Fingerprint: ssh.FingerprintSHA256(pub), Comment: comment}
+	if cpub, ok := pub.(ssh.CryptoPublicKey); ok {
+		info.PublicKey = DescribePublicKey(cpub.CryptoPublicKey())
+	} else {
+		info.PublicKey = PublicKeyInfo{Algorithm: pub.Type()}
+	}
+	return info
+}
+
+// DescribeSSHCertificate describes an OpenSSH certificate
+func DescribeSSHCertificate(cert *ssh.Certificate, comment string) *SSHInfo {
+	info := DescribeSSHPublicKey(cert.Key, comment)
+	info.Type = cert.Type()
+	certInfo := &SSHCertificateInfo{
+		CertType:        "user",
+		KeyID:           cert.KeyId,
+		Serial:          cert.Serial,
+		Principals:      append([]string{}, cert.ValidPrincipals...),
+		ValidAfter:      time.Unix(int64(cert.ValidAfter), 0).UTC(),
+		CAFingerprint:   ssh.FingerprintSHA256(cert.SignatureKey),
+		CriticalOptions: cert.CriticalOptions,
+		Extensions:      cert.Extensions,
+	}
+	if cert.CertType == ssh.HostCert {
+		certInfo.CertType = "host"
+	}
+	if cert.ValidBefore != ssh.CertTimeInfinity {
+		before := time.Unix(int64(cert.ValidBefore), 0).UTC()
+		certInfo.ValidBefore = &before
+	}
+	info.Certificate = certInfo
+	return info
+}
+
+// DescribePublicKey describes a public key
+func DescribePublicKey(pub crypto.PublicKey) PublicKeyInfo {
+	var info PublicKeyInfo
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		info.Algorithm, info.Size = "RSA", k.N.BitLen()
+	case *ecdsa.PublicKey:
+		info.Algorithm, info.Size, info.Curve = "ECDSA", k.Curve.Params().BitSize, k.Curve.Params().Name
+	case ed25519.PublicKey:
+		info.Algorithm, info.Size = "Ed25519", 256
+	default:
+		info.Algorithm = fmt.Sprintf("%T", pub)
+	}
+	if der, err := x509.MarshalPKIXPublicKey(pub); err == nil {
+		info.Fingerprint = Fingerprint(sha256.New(), der)
+	}
+	return info
+}
+
+// Fingerprint hashes b with h, returning upper-case hex separated by colons
+func Fingerprint(h hash.Hash, b []byte) string {
+	_, _ = h.Write(b)
+	return ColonHex(h.Sum(nil))
+}
+
+// ColonHex returns b in upper-case hex, each byte separated by a colon
+func ColonHex(b []byte) string {
+	parts := make([]string, len(b))
+	for i, c := range b {
+		parts[i] = fmt.Sprintf("%02X", c)
+	}
+	return strings.Join(parts, ":")
+}
+
+// ExtensionName returns the name of a well-known extension, or empty if it is not known
+func ExtensionName(oid asn1.ObjectIdentifier) string {
+	return extensionNames[oid.String()]
+}
+
+func describeSANs(sans *SANs) SANInfo {
+	info := SANInfo{DNS: sans.DNSNames, Email: sans.EmailAddresses, UPN: sans.UPNs, IP: ipStrings(sans)}
+	for _, u := range sans.URIs {
+		info.URI = append(info.URI, u.String())
+	}
+	return info
+}
+
+func describeExtensions(extensions []pkix.Extension) []ExtensionInfo {
+	infos := make([]ExtensionInfo, 0, len(extensions))
+	for _, ext := range extensions {
+		infos = append(infos, ExtensionInfo{OID: ext.Id.String(), Name: extensionNames[ext.Id.String()], Critical: ext.Critical})
+	}
+	return infos
+}
@@ -0,0 +1,285 @@
+package ca
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// JCEKS entry tags
+const (
+	jceksPrivateKey  = 1
+	jceksTrustedCert = 2
+	jceksSecretKey   = 3
+)
+
+// jceksMaxIterations is the highest PBEWithMD5AndTripleDES iteration count accepted, the same limit
+// as Java's
+const jceksMaxIterations = 5000000
+
+// oidPBEWithMD5AndTripleDES is Sun's proprietary private key protection in JCEKS keystores
+var oidPBEWithMD5AndTripleDES = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 42, 2, 19, 1}
+
+// jceksWhitener is mixed into the keystore integrity digest, after the password and before the data
+const jceksWhitener = "Mighty Aphrodite"
+
+// jceksEntry is an entry of a JCEKS keystore as stored, its private key still encrypted
+type jceksEntry struct {
+	alias        string
+	encryptedKey []byte
+	certificates [][]byte
+}
+
+// parseJCEKS returns the entries of a JCEKS keystore, asking for its passwords as ParseJKS does.
+// Secret key entries are Java serialized objects, and are not supported.
+func parseJCEKS(b []byte, password, keyPassword PasswordFunc) ([]JKSEntry, error) {
+	stored, body, digest, err := readJCEKS(b)
+	if err != nil {
+		return nil, err
+	}
+	storePassword := ""
+	if !jceksDigestMatches(body, digest, storePassword) {
+		if password == nil {
+			return nil, errors.New("keystore is protected with a password, but none was given")
+		}
+		if storePassword, err = password("Keystore password: "); err != nil {
+			return nil, err
+		}
+		if !jceksDigestMatches(body, digest, storePassword) {
+			return nil, errors.New("failed to load keystore, the password may be incorrect")
+		}
+	}
+	privateKeyPassword := storePassword
+	if keyPassword != nil {
+		if privateKeyPassword, err = keyPassword("Key password: "); err != nil {
+			return nil, err
+		}
+	}
+
+	var entries []JKSEntry
+	for _, s := range stored {
+		entry := JKSEntry{Alias: s.alias}
+		if s.encryptedKey != nil {
+			der, err := decryptJCEKSKey(s.encryptedKey, privateKeyPassword)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decrypt private key %s, the key password may be incorrect: %v", s.alias, err)
+			}
+			if entry.PrivateKey, err = ParsePrivateKey(der); err != nil {
+				return nil, fmt.Errorf("failed to parse private key %s: %v", s.alias, err)
+			}
+		}
+		for _, c := range s.certificates {
+			cert, err := x509.ParseCertificate(c)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse certificate of %s: %v", s.alias, err)
+			}
+			entry.Certificates = append(entry.Certificates, cert)
+		}
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Alias < entries[j].Alias })
+	return entries, nil
+}
+
+// readJCEKS splits a JCEKS keystore into its entries, the data covered by its integrity digest, and
+// the digest
+func readJCEKS(b []byte) ([]jceksEntry, []byte, []byte, error) {
+	r := &jceksReader{b: b}
+	if r.uint32() != jceksMagic {
+		return nil, nil, nil, errors.New("not a JCEKS keystore")
+	}
+	version := r.uint32()
+	if r.err == nil && version != 1 && version != 2 {
+		return nil, nil, nil, fmt.Errorf("unsupported JCEKS version %d", version)
+	}
+	count := r.uint32()
+	var entries []jceksEntry
+	for i := uint32(0); i < count && r.err == nil; i++ {
+		tag := r.uint32()
+		entry := jceksEntry{alias: r.utf()}
+		// creation time, in milliseconds
+		r.uint64()
+		switch tag {
+		case jceksPrivateKey:
+			entry.encryptedKey = r.bytes()
+			certs := r.uint32()
+			for j := uint32(0); j < certs && r.err == nil; j++ {
+				entry.certificates = append(entry.certificates, r.certificate(version))
+			}
+		case jceksTrustedCert:
+			entry.certificates = append(entry.certificates, r.certificate(version))
+		case jceksSecretKey:
+			if r.err == nil {
+				return nil, nil, nil, fmt.Errorf("entry %s is a secret key, which is not supported", entry.alias)
+			}
+		default:
+			if r.err == nil {
+				return nil, nil, nil, fmt.Errorf("unknown JCEKS entry type %d", tag)
+			}
+		}
+		entries = append(entries, entry)
+	}
+	body := b[:r.pos]
+	digest := r.next(sha1.Size)
+	if r.err != nil {
+		return nil, nil, nil, fmt.Errorf("invalid JCEKS keystore: %v", r.err)
+	}
+	if r.pos != len(b) {
+		return nil, nil, nil, errors.New("invalid JCEKS keystore: trailing data")
+	}
+	return entries, body, digest, nil
+}
+
+// jceksDigestMatches checks the keystore integrity digest: SHA-1 over the password as UTF-16BE, the
+// whitener and the keystore data
+func jceksDigestMatches(body, digest []byte, password string) bool {
+	h := sha1.New()
+	for _, c := range password {
+		// Java chars are UTF-16 code units
+		if c > 0xffff {
+			hi, lo := 0xd800+((c-0x10000)>>10), 0xdc00+((c-0x10000)&0x3ff)
+			h.Write([]byte{byte(hi >> 8), byte(hi), byte(lo >> 8), byte(lo)})
+			continue
+		}
+		h.Write([]byte{byte(c >> 8), byte(c)})
+	}
+	h.Write([]byte(jceksWhitener))
+	h.Write(body)
+	return subtle.ConstantTimeCompare(h.Sum(nil), digest) == 1
+}
+
+// decryptJCEKSKey decrypts an EncryptedPrivateKeyInfo protected with PBEWithMD5AndTripleDES, returning the
+// DER-encoded PKCS#8 private key
+func decryptJCEKSKey(der []byte, password string) ([]byte, error) {
+	var info encryptedPrivateKeyInfo
+	if _, err := asn1.Unmarshal(der, &info); err != nil {
+		return nil, fmt.Errorf("invalid encrypted private key: %v", err)
+	}
+	if !info.Algorithm.Algorithm.Equal(oidPBEWithMD5AndTripleDES) {
+		return nil, fmt.Errorf("unsupported private key protection %s", info.Algorithm.Algorithm)
+	}
+	var params struct {
+		Salt       []byte
+		Iterations int
+	}
+	if _, err := asn1.Unmarshal(info.Algorithm.Parameters.FullBytes, &params); err != nil {
+		return nil, fmt.Errorf("invalid PBEWithMD5AndTripleDES parameters: %v", err)
+	}
+	if len(params.Salt) != 8 {
+		return nil, fmt.Errorf("invalid PBEWithMD5AndTripleDES salt length %d", len(params.Salt))
+	}
+	if params.Iterations < 1 || params.Iterations > jceksMaxIterations {
+		return nil, fmt.Errorf("unsupported PBEWithMD5AndTripleDES iteration count %d, must be from 1 to %d", params.Iterations, jceksMaxIterations)
+	}
+	for _, c := range password {
+		if c < 0x20 || c > 0x7e {
+			return nil, errors.New("PBEWithMD5AndTripleDES passwords must be printable ASCII")
+		}
+	}
+	key, iv := jceksDeriveKey([]byte(password), params.Salt, params.Iterations)
+	block, err := des.NewTripleDESCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(info.EncryptedData) == 0 || len(info.EncryptedData)%des.BlockSize != 0 {
+		return nil, errors.New("invalid encrypted private key length")
+	}
+	decrypted := make([]byte, len(info.EncryptedData))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(decrypted, info.EncryptedData)
+	padding := int(decrypted[len(decrypted)-1])
+	if padding == 0 || padding > des.BlockSize || !bytes.Equal(decrypted[len(decrypted)-padding:], bytes.Repeat([]byte{byte(padding)}, padding)) {
+		return nil, ErrIncorrectPassphrase
+	}
+	return decrypted[:len(decrypted)-padding], nil
+}
+
+// jceksDeriveKey derives the 3DES key and IV of PBEWithMD5AndTripleDES: each half of the salt, with the
+// first reversed if both are the same, is hashed with the password iterations times, each round over
+// the previous digest and the password, and the two digests are the key followed by the IV
+func jceksDeriveKey(password, salt []byte, iterations int) ([]byte, []byte) {
+	salt = append([]byte{}, salt...)
+	if bytes.Equal(salt[:4], salt[4:]) {
+		salt[0], salt[3] = salt[3], salt[0]
+		salt[1], salt[2] = salt[2], salt[1]
+	}
+	var derived []byte
+	for half := 0; half < 2; half++ {
+		digest := salt[half*4 : half*4+4]
+		for i := 0; i < iterations; i++ {
+			h := md5.New()
+			h.Write(digest)
+			h.Write(password)
+			digest = h.Sum(nil)
+		}
+		derived = append(derived, digest...)
+	}
+	return derived[:24], derived[24:]
+}
+
+// jceksReader reads the Java DataOutputStream encoding of a keystore. After the first error, every
+// read returns zero values, and err is set.
+type jceksReader struct {
+	b   []byte
+	pos int
+	err error
+}
+
+func (r *jceksReader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(r.b)-r.pos {
+		r.err = errors.New("truncated")
+		return nil
+	}
+	b := r.b[r.pos : r.pos+n]
+	r.pos += n
+	return b
+}
+
+func (r *jceksReader) uint32() uint32 {
+	if b := r.next(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (r *jceksReader) uint64() uint64 {
+	if b := r.next(8); b != nil {
+		return binary.BigEndian.Uint64(b)
+	}
+	return 0
+}
+
+// utf reads a string written by DataOutputStream.writeUTF, its length in two bytes
+func (r *jceksReader) utf() string {
+	b := r.next(2)
+	if b == nil {
+		return ""
+	}
+	return string(r.next(int(binary.BigEndian.Uint16(b))))
+}
+
+// bytes reads a byte array, its length in four bytes
+func (r *jceksReader) bytes() []byte {
+	return r.next(int(r.uint32()))
+}
+
+// certificate reads a DER-encoded certificate, which since version 2 is preceded by its type
+func (r *jceksReader) certificate(version uint32) []byte {
+	if version == 2 {
+		if t := r.utf(); r.err == nil && t != "X.509" && t != "X509" {
+			r.err = fmt.Errorf("unsupported certificate type %s", t)
+		}
+	}
+	return r.bytes()
+}
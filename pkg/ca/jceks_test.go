@@ -0,0 +1,236 @@
+package ca
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+// jceksTestEntry is an entry for encodeTestJCEKS: a private key entry if key is set, otherwise a trusted
+// certificate entry, or a secret key entry if tag is jceksSecretKey
+type jceksTestEntry struct {
+	tag   uint32
+	alias string
+	key   []byte
+	certs [][]byte
+}
+
+// encodeTestJCEKS writes a version 2 JCEKS keystore, as keytool does
+func encodeTestJCEKS(entries []jceksTestEntry, password string) []byte {
+	var buf bytes.Buffer
+	u16 := func(v int) { binary.Write(&buf, binary.BigEndian, uint16(v)) }
+	u32 := func(v int) { binary.Write(&buf, binary.BigEndian, uint32(v)) }
+	cert := func(c []byte) {
+		u16(len("X.509"))
+		buf.WriteString("X.509")
+		u32(len(c))
+		buf.Write(c)
+	}
+	u32(jceksMagic)
+	u32(2)
+	u32(len(entries))
+	for _, e := range entries {
+		u32(int(e.tag))
+		u16(len(e.alias))
+		buf.WriteString(e.alias)
+		binary.Write(&buf, binary.BigEndian, uint64(1600000000000))
+		switch e.tag {
+		case jceksPrivateKey:
+			u32(len(e.key))
+			buf.Write(e.key)
+			u32(len(e.certs))
+			for _, c := range e.certs {
+				cert(c)
+			}
+		case jceksTrustedCert:
+			cert(e.certs[0])
+		default:
+			// a serialized object, which the reader never gets past
+			buf.Write([]byte{0xac, 0xed, 0x00, 0x05})
+		}
+	}
+	h := sha1.New()
+	for _, c := range password {
+		h.Write([]byte{0, byte(c)})
+	}
+	h.Write([]byte(jceksWhitener))
+	h.Write(buf.Bytes())
+	buf.Write(h.Sum(nil))
+	return buf.Bytes()
+}
+
+// encryptTestJCEKSKey protects a PKCS#8 private key with PBEWithMD5AndTripleDES
+func encryptTestJCEKSKey(t *testing.T, der []byte, password string, salt []byte, iterations int) []byte {
+	t.Helper()
+	key, iv := jceksDeriveKey([]byte(password), salt, iterations)
+	block, err := des.NewTripleDESCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	padding := des.BlockSize - len(der)%des.BlockSize
+	data := append(append([]byte{}, der...), bytes.Repeat([]byte{byte(padding)}, padding)...)
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(data, data)
+	params := mustMarshal(struct {
+		Salt       []byte
+		Iterations int
+	}{salt, iterations})
+	return mustMarshal(encryptedPrivateKeyInfo{
+		Algorithm:     pkix.AlgorithmIdentifier{Algorithm: oidPBEWithMD5AndTripleDES, Parameters: asn1.RawValue{FullBytes: params}},
+		EncryptedData: data,
+	})
+}
+
+func TestJCEKSDeriveKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		salt    string
+		key, iv string
+	}{
+		{"distinct halves", "0102030405060708", "130f52c2e02599d1d741a78e080c738bf09caeff32b49184", "b5b9fd790f1e2b17"},
+		// the first half is reversed, so the key starts as that of salt 04030201...
+		{"equal halves", "0102030401020304", "b0edee84ebcf50c812bc73acc0658d5c130f52c2e02599d1", "d741a78e080c738b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			salt, _ := hex.DecodeString(tt.salt)
+			key, iv := jceksDeriveKey([]byte("changeit"), salt, 20)
+			if hex.EncodeToString(key) != tt.key || hex.EncodeToString(iv) != tt.iv {
+				t.Errorf("derived %x, %x, want %s, %s", key, iv, tt.key, tt.iv)
+			}
+			if !bytes.Equal(salt, []byte{1, 2, 3, 4, salt[4], salt[5], salt[6], salt[7]}) {
+				t.Error("salt was modified")
+			}
+		})
+	}
+}
+
+func TestParseJCEKS(t *testing.T) {
+	caKey, err := GenerateKey(KeyOptions{Type: ECDSA})
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := CertificateOptions{Subject: pkix.Name{CommonName: "test CA"}, Days: 1, IsCA: true, KeyUsage: x509.KeyUsageCertSign}.Template()
+	store, err := InitStore(t.TempDir(), StoreConfig{}, template, caKey, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := GenerateKey(KeyOptions{Type: ECDSA})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := store.Sign(CertificateOptions{Subject: pkix.Name{CommonName: "server"}, Days: 1}.Template(), key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	salt := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	password := func(secret string) PasswordFunc {
+		return func(string) (string, error) { return secret, nil }
+	}
+	keystore := func(keyPassword string, salt []byte, iterations int, extra ...jceksTestEntry) []byte {
+		return encodeTestJCEKS(append([]jceksTestEntry{
+			{tag: jceksTrustedCert, alias: "ca", certs: [][]byte{store.CA.Certificate.Raw}},
+			{tag: jceksPrivateKey, alias: "server", key: encryptTestJCEKSKey(t, der, keyPassword, salt, iterations), certs: [][]byte{cert.Raw, store.CA.Certificate.Raw}},
+		}, extra...), "storepass")
+	}
+
+	t.Run("read", func(t *testing.T) {
+		b := keystore("storepass", salt, 200000)
+		if !IsJKS(b) {
+			t.Error("not detected as a keystore")
+		}
+		entries, err := ParseJKS(b, password("storepass"), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 2 || entries[0].Alias != "ca" || entries[1].Alias != "server" {
+			t.Fatalf("got entries %v", entries)
+		}
+		if entries[0].PrivateKey != nil || len(entries[0].Certificates) != 1 || !entries[0].Certificates[0].Equal(store.CA.Certificate) {
+			t.Error("trusted certificate entry does not match")
+		}
+		server := entries[1]
+		if !KeyMatches(server.PrivateKey, key.Public()) {
+			t.Error("private key does not match")
+		}
+		if len(server.Certificates) != 2 || !server.Certificates[0].Equal(cert) || !server.Certificates[1].Equal(store.CA.Certificate) {
+			t.Error("certificate chain does not match")
+		}
+	})
+
+	t.Run("key password", func(t *testing.T) {
+		b := keystore("keypass", []byte{9, 9, 9, 9, 9, 9, 9, 9}, 20)
+		entries, err := ParseJKS(b, password("storepass"), password("keypass"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !KeyMatches(entries[1].PrivateKey, key.Public()) {
+			t.Error("private key does not match")
+		}
+		if _, err := ParseJKS(b, password("storepass"), password("other")); err == nil {
+			t.Errorf("wrong key password gave %v", err)
+		}
+	})
+
+	t.Run("wrong store password", func(t *testing.T) {
+		b := keystore("storepass", salt, 20)
+		if _, err := ParseJKS(b, password("other"), nil); err == nil || !strings.Contains(err.Error(), "password may be incorrect") {
+			t.Errorf("wrong store password gave %v", err)
+		}
+		if _, err := ParseJKS(b, nil, nil); err == nil || !strings.Contains(err.Error(), "none was given") {
+			t.Errorf("no store password gave %v", err)
+		}
+	})
+
+	t.Run("empty store password", func(t *testing.T) {
+		b := encodeTestJCEKS([]jceksTestEntry{{tag: jceksTrustedCert, alias: "ca", certs: [][]byte{store.CA.Certificate.Raw}}}, "")
+		if _, err := ParseJKS(b, nil, nil); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("secret key", func(t *testing.T) {
+		b := keystore("storepass", salt, 20, jceksTestEntry{tag: jceksSecretKey, alias: "aes"})
+		if _, err := ParseJKS(b, password("storepass"), nil); err == nil || !strings.Contains(err.Error(), "aes is a secret key") {
+			t.Errorf("secret key entry gave %v", err)
+		}
+	})
+
+	t.Run("iterations", func(t *testing.T) {
+		params := mustMarshal(struct {
+			Salt       []byte
+			Iterations int
+		}{salt, jceksMaxIterations + 1})
+		encrypted := mustMarshal(encryptedPrivateKeyInfo{
+			Algorithm:     pkix.AlgorithmIdentifier{Algorithm: oidPBEWithMD5AndTripleDES, Parameters: asn1.RawValue{FullBytes: params}},
+			EncryptedData: make([]byte, 16),
+		})
+		b := encodeTestJCEKS([]jceksTestEntry{{tag: jceksPrivateKey, alias: "server", key: encrypted, certs: [][]byte{cert.Raw}}}, "storepass")
+		if _, err := ParseJKS(b, password("storepass"), nil); err == nil || !strings.Contains(err.Error(), "iteration count") {
+			t.Errorf("too many iterations gave %v", err)
+		}
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		b := keystore("storepass", salt, 20)
+		for _, n := range []int{8, 20, len(b) / 2, len(b) - 1} {
+			if _, err := ParseJKS(b[:n], password("storepass"), nil); err == nil {
+				t.Errorf("keystore truncated to %d bytes was read", n)
+			}
+		}
+		if _, err := ParseJKS(append(b, 0), password("storepass"), nil); err == nil || !strings.Contains(err.Error(), "trailing data") {
+			t.Errorf("trailing data gave %v", err)
+		}
+	})
+}
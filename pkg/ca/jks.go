@@ -0,0 +1,139 @@
+package ca
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	keystore "github.com/pavlo-v-chernykh/keystore-go/v4"
+)
+
+// magic numbers at the start of Java keystores
+const (
+	jksMagic   = 0xfeedfeed
+	jceksMagic = 0xcececece
+)
+
+// JKSEntry is an entry of a Java keystore: a private key and its certificate chain, leaf first, or a
+// trusted certificate, without a private key
+type JKSEntry struct {
+	Alias        string
+	PrivateKey   crypto.PrivateKey
+	Certificates []*x509.Certificate
+}
+
+// IsJKS reports whether b looks like a JKS or JCEKS keystore, without checking its integrity
+func IsJKS(b []byte) bool {
+	return len(b) >= 4 && (binary.BigEndian.Uint32(b) == jksMagic || binary.BigEndian.Uint32(b) == jceksMagic)
+}
+
+// EncodeJKS returns a JKS keystore of the entries, its integrity protected with password, and the private
+// keys encrypted with keyPassword. As with keytool, the aliases are stored lowercase, so they must differ
+// other than in case.
+func EncodeJKS(entries []JKSEntry, password, keyPassword string) ([]byte, error) {
+	ks := keystore.New(keystore.WithOrderedAliases())
+	now := time.Now()
+	aliases := map[string]bool{}
+	for _, entry := range entries {
+		if len(entry.Certificates) == 0 {
+			return nil, fmt.Errorf("entry %s has no certificates", entry.Alias)
+		}
+		alias := strings.ToLower(entry.Alias)
+		if aliases[alias] {
+			return nil, fmt.Errorf("more than one entry has alias %s, and aliases are not case sensitive", entry.Alias)
+		}
+		aliases[alias] = true
+		var certs []keystore.Certificate
+		for _, cert := range entry.Certificates {
+			certs = append(certs, keystore.Certificate{Type: "X509", Content: cert.Raw})
+		}
+		var err error
+		if entry.PrivateKey != nil {
+			var der []byte
+			if der, err = x509.MarshalPKCS8PrivateKey(entry.PrivateKey); err != nil {
+				return nil, err
+			}
+			err = ks.SetPrivateKeyEntry(entry.Alias, keystore.PrivateKeyEntry{CreationTime: now, PrivateKey: der, CertificateChain: certs}, []byte(keyPassword))
+		} else {
+			err = ks.SetTrustedCertificateEntry(entry.Alias, keystore.TrustedCertificateEntry{CreationTime: now, Certificate: certs[0]})
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to add entry %s: %v", entry.Alias, err)
+		}
+	}
+	var buf bytes.Buffer
+	if err := ks.Store(&buf, []byte(password)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ParseJKS returns the entries of a JKS or JCEKS keystore, ordered by alias. The aliases are lowercase in
+// JKS, but keep their case in JCEKS, so should be compared without case. An empty password is tried first,
+// and then the password is asked of password. The private keys are decrypted with the password asked of
+// keyPassword, or with that of the keystore if it is nil. JCEKS secret key entries are not supported.
+func ParseJKS(b []byte, password, keyPassword PasswordFunc) ([]JKSEntry, error) {
+	if !IsJKS(b) {
+		return nil, errors.New("not a JKS or JCEKS keystore")
+	}
+	if binary.BigEndian.Uint32(b) == jceksMagic {
+		return parseJCEKS(b, password, keyPassword)
+	}
+	storePassword := ""
+	ks := keystore.New(keystore.WithOrderedAliases())
+	if err := ks.Load(bytes.NewReader(b), nil); err != nil {
+		if password == nil {
+			return nil, errors.New("keystore is protected with a password, but none was given")
+		}
+		if storePassword, err = password("Keystore password: "); err != nil {
+			return nil, err
+		}
+		ks = keystore.New(keystore.WithOrderedAliases())
+		if err := ks.Load(bytes.NewReader(b), []byte(storePassword)); err != nil {
+			return nil, fmt.Errorf("failed to load keystore, the password may be incorrect: %v", err)
+		}
+	}
+	privateKeyPassword := storePassword
+	if keyPassword != nil {
+		var err error
+		if privateKeyPassword, err = keyPassword("Key password: "); err != nil {
+			return nil, err
+		}
+	}
+
+	var entries []JKSEntry
+	for _, alias := range ks.Aliases() {
+		entry := JKSEntry{Alias: alias}
+		var certs []keystore.Certificate
+		if ks.IsPrivateKeyEntry(alias) {
+			pke, err := ks.GetPrivateKeyEntry(alias, []byte(privateKeyPassword))
+			if err != nil {
+				return nil, fmt.Errorf("failed to decrypt private key %s, the key password may be incorrect: %v", alias, err)
+			}
+			if entry.PrivateKey, err = ParsePrivateKey(pke.PrivateKey); err != nil {
+				return nil, fmt.Errorf("failed to parse private key %s: %v", alias, err)
+			}
+			certs = pke.CertificateChain
+		} else {
+			tce, err := ks.GetTrustedCertificateEntry(alias)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read entry %s: %v", alias, err)
+			}
+			certs = []keystore.Certificate{tce.Certificate}
+		}
+		for _, c := range certs {
+			cert, err := x509.ParseCertificate(c.Content)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse certificate of %s: %v", alias, err)
+			}
+			entry.Certificates = append(entry.Certificates, cert)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
@@ -0,0 +1,43 @@
+package ca
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"strings"
+	"testing"
+)
+
+func TestJKSAliasCase(t *testing.T) {
+	store := newTestStore(t)
+	key, err := GenerateKey(KeyOptions{Type: ECDSA})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := store.Sign(CertificateOptions{Subject: pkix.Name{CommonName: "server"}, Days: 1}.Template(), key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := []JKSEntry{
+		{Alias: "MyKey", PrivateKey: key, Certificates: []*x509.Certificate{cert}},
+		{Alias: "CA", Certificates: []*x509.Certificate{store.CA.Certificate}},
+	}
+	b, err := EncodeJKS(entries, "storepass", "storepass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := ParseJKS(b, func(string) (string, error) { return "storepass", nil }, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parsed) != 2 || parsed[0].Alias != "ca" || parsed[1].Alias != "mykey" {
+		t.Fatalf("got aliases %v, expected ca and mykey", parsed)
+	}
+	if !KeyMatches(parsed[1].PrivateKey, key.Public()) {
+		t.Error("private key does not match")
+	}
+
+	entries[1].Alias = "mykey"
+	if _, err := EncodeJKS(entries, "storepass", "storepass"); err == nil || !strings.Contains(err.Error(), "not case sensitive") {
+		t.Errorf("aliases differing only in case gave %v", err)
+	}
+}
@@ -0,0 +1,297 @@
+// Package ca implements the certificate authority operations used by the ca
+// command: generating keys, creating certificate requests and signing
+// certificates. Everything returns values in memory or writes to an io.Writer,
+// so it can be used directly from other programs.
+package ca
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// KeyType is the algorithm of a key pair
+type KeyType int
+
+const (
+	RSA KeyType = iota
+	Ed25519
+	ECDSA
+)
+
+// ParseKeyType converts a key type name, one of rsa, ecdsa, ed25519, into a KeyType
+func ParseKeyType(name string) (KeyType, error) {
+	switch name {
+	case "rsa":
+		return RSA, nil
+	case "ecdsa":
+		return ECDSA, nil
+	case "ed25519":
+		return Ed25519, nil
+	default:
+		return 0, fmt.Errorf("unknown key type: %s", name)
+	}
+}
+
+func (k KeyType) String() string {
+	switch k {
+	case RSA:
+		return "rsa"
+	case ECDSA:
+		return "ecdsa"
+	case Ed25519:
+		return "ed25519"
+	default:
+		return fmt.Sprintf("KeyType(%d)", int(k))
+	}
+}
+
+// RSAKeySizes are the sizes in bits of RSA keys that can be generated
+var RSAKeySizes = []int{2048, 3072, 4096, 8192}
+
+// curves are the ECDSA curves that can be generated, by size in bits
+var curves = map[int]elliptic.Curve{256: elliptic.P256(), 384: elliptic.P384(), 521: elliptic.P521()}
+
+// KeyOptions describe a private key to generate
+type KeyOptions struct {
+	Type KeyType
+	// Size is the size in bits of an RSA key, one of RSAKeySizes, or of the curve of an ECDSA key, one
+	// of 256, 384 or 521. If 0, it is 4096 for RSA and 256 for ECDSA. It is unused for Ed25519.
+	Size int
+}
+
+// ParseCurve converts an ECDSA curve name, one of P-256, P-384, P-521, or their SEC 2 or OpenSSL names,
+// into its size in bits for KeyOptions
+func ParseCurve(name string) (int, error) {
+	switch strings.ToLower(strings.ReplaceAll(name, "-", "")) {
+	case "p256", "secp256r1", "prime256v1":
+		return 256, nil
+	case "p384", "secp384r1":
+		return 384, nil
+	case "p521", "secp521r1":
+		return 521, nil
+	}
+	return 0, fmt.Errorf("unknown curve %s, must be one of: P-256, P-384, P-521", name)
+}
+
+// Validate returns an error if the key size is not valid for the key type
+func (o KeyOptions) Validate() error {
+	switch o.Type {
+	case RSA:
+		if o.Size == 0 {
+			return nil
+		}
+		for _, size := range RSAKeySizes {
+			if o.Size == size {
+				return nil
+			}
+		}
+		return fmt.Errorf("invalid RSA key size %d, must be one of: %s", o.Size, joinInts(RSAKeySizes))
+	case ECDSA:
+		if _, ok := curves[o.Size]; o.Size != 0 && !ok {
+			return fmt.Errorf("invalid ECDSA key size %d, must be that of a curve, one of: 256, 384, 521", o.Size)
+		}
+	case Ed25519:
+	default:
+		return fmt.Errorf("unknown key type: %v", o.Type)
+	}
+	return nil
+}
+
+// GenerateKey generates a new private key
+func GenerateKey(opts KeyOptions) (crypto.Signer, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	reader := rand.Reader
+	switch opts.Type {
+	case RSA:
+		size := opts.Size
+		if size == 0 {
+			size = 4096
+		}
+		return rsa.GenerateKey(reader, size)
+	case Ed25519:
+		_, privateKey, err := ed25519.GenerateKey(reader)
+		return privateKey, err
+	case ECDSA:
+		curve := elliptic.P256()
+		if opts.Size != 0 {
+			curve = curves[opts.Size]
+		}
+		return ecdsa.GenerateKey(curve, reader)
+	default:
+		return nil, fmt.Errorf("unknown key type: %v", opts.Type)
+	}
+}
+
+func joinInts(ints []int) string {
+	s := make([]string, len(ints))
+	for i, n := range ints {
+		s[i] = strconv.Itoa(n)
+	}
+	return strings.Join(s, ", ")
+}
+
+// WritePrivateKey writes the private key to w as PEM-encoded PKCS#8
+func WritePrivateKey(w io.Writer, privateKey crypto.PrivateKey) error {
+	b, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return err
+	}
+	return pem.Encode(w, &pem.Block{Type: "PRIVATE KEY", Bytes: b})
+}
+
+// ParsePrivateKey parses a DER-encoded private key in PKCS#1, PKCS#8 or SEC1 format
+func ParsePrivateKey(der []byte) (crypto.PrivateKey, error) {
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKCS8PrivateKey(der); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(der); err == nil {
+		return key, nil
+	}
+
+	return nil, errors.New("tls: failed to parse private key")
+}
+
+// WriteEncryptedPrivateKey writes the private key to w as PEM-encoded PKCS#8, encrypted with the
+// passphrase in enc
+func WriteEncryptedPrivateKey(w io.Writer, privateKey crypto.PrivateKey, enc KeyEncryption) error {
+	b, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return err
+	}
+	if b, err = EncryptPKCS8(b, enc); err != nil {
+		return err
+	}
+	return pem.Encode(w, &pem.Block{Type: "ENCRYPTED PRIVATE KEY", Bytes: b})
+}
+
+// ParsePrivateKeyPEM parses the first PEM-encoded private key in b, which must not be encrypted
+func ParsePrivateKeyPEM(b []byte) (crypto.PrivateKey, error) {
+	return ParsePrivateKeyPEMWithPassword(b, nil)
+}
+
+// ParsePrivateKeyPEMWithPassword parses the first PEM-encoded private key in b. If it is encrypted,
+// either as PKCS#8 or with legacy Proc-Type headers, the passphrase is asked of password.
+func ParsePrivateKeyPEMWithPassword(b []byte, password PasswordFunc) (crypto.PrivateKey, error) {
+	der, _ := pem.Decode(b)
+	if der == nil {
+		return nil, errors.New("no valid PEM")
+	}
+	if !(der.Type == "PRIVATE KEY" || strings.HasSuffix(der.Type, " PRIVATE KEY")) {
+		return nil, errors.New("does not contain private key")
+	}
+	return parsePrivateKeyBlock(der, password)
+}
+
+// WritePublicKey writes the public key to w as PEM-encoded PKIX
+func WritePublicKey(w io.Writer, pub crypto.PublicKey) error {
+	b, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return err
+	}
+	return pem.Encode(w, &pem.Block{Type: "PUBLIC KEY", Bytes: b})
+}
+
+// WriteSSHPublicKey writes the public key to w in OpenSSH authorized_keys format, with the comment if set
+func WriteSSHPublicKey(w io.Writer, pub crypto.PublicKey, comment string) error {
+	sshKey, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		return err
+	}
+	line := strings.TrimSuffix(string(ssh.MarshalAuthorizedKey(sshKey)), "\n")
+	if comment != "" {
+		line += " " + comment
+	}
+	_, err = fmt.Fprintln(w, line)
+	return err
+}
+
+// SPKIPin returns the base64-encoded SHA-256 hash of the DER-encoded SubjectPublicKeyInfo of pub, the pin
+// used by HPKP's pin-sha256, and with a sha256/ prefix by OkHttp and Envoy
+func SPKIPin(pub crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(der)
+	return base64.StdEncoding.EncodeToString(sum[:]), nil
+}
+
+// ParsePublicKeyPEM parses the first PEM-encoded public key in b, either PKIX or PKCS#1 RSA
+func ParsePublicKeyPEM(b []byte) (crypto.PublicKey, error) {
+	der, _ := pem.Decode(b)
+	if der == nil {
+		return nil, errors.New("no valid PEM")
+	}
+	switch der.Type {
+	case "PUBLIC KEY":
+		return x509.ParsePKIXPublicKey(der.Bytes)
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(der.Bytes)
+	}
+	return nil, errors.New("does not contain public key")
+}
+
+// parsePrivateKeyBlock parses a PEM private key block, decrypting it with the passphrase from password
+// if it is encrypted
+func parsePrivateKeyBlock(block *pem.Block, password PasswordFunc) (crypto.PrivateKey, error) {
+	//nolint:staticcheck // legacy encrypted PEM is insecure, but still found in the wild
+	legacy := x509.IsEncryptedPEMBlock(block)
+	if block.Type != "ENCRYPTED PRIVATE KEY" && !legacy {
+		return ParsePrivateKey(block.Bytes)
+	}
+	if password == nil {
+		return nil, errors.New("private key is encrypted, but no passphrase was given")
+	}
+	passphrase, err := password("Private key passphrase: ")
+	if err != nil {
+		return nil, err
+	}
+	var der []byte
+	if legacy {
+		//nolint:staticcheck // see above
+		if der, err = x509.DecryptPEMBlock(block, []byte(passphrase)); err == x509.IncorrectPasswordError {
+			err = ErrIncorrectPassphrase
+		}
+	} else {
+		der, err = DecryptPKCS8(block.Bytes, []byte(passphrase))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt private key: %v", err)
+	}
+	key, err := ParsePrivateKey(der)
+	if err != nil {
+		// decrypting with the wrong passphrase occasionally gives valid padding
+		return nil, fmt.Errorf("failed to decrypt private key: %v", ErrIncorrectPassphrase)
+	}
+	return key, nil
+}
+
+// KeyMatches reports whether pub is the public key of the private key priv
+func KeyMatches(priv crypto.PrivateKey, pub crypto.PublicKey) bool {
+	signer, ok := priv.(crypto.Signer)
+	if !ok {
+		return false
+	}
+	key, ok := signer.Public().(interface{ Equal(crypto.PublicKey) bool })
+	return ok && key.Equal(pub)
+}
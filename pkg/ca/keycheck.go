@@ -0,0 +1,74 @@
+package ca
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"fmt"
+	"math/big"
+)
+
+// CheckKey checks that a private key is internally consistent: that the values of an RSA key agree, that
+// the public point of an ECDSA key is on its curve and is that of its private scalar, and that the public
+// key of an Ed25519 key is that of its seed. It returns the result of each check, as CheckMatch does.
+func CheckKey(key crypto.PrivateKey) []MatchCheck {
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		checks := CheckPublicKey(&k.PublicKey)
+		check := MatchCheck{Name: "RSA private key is consistent", OK: true}
+		if err := k.Validate(); err != nil {
+			check.OK, check.Detail = false, err.Error()
+		}
+		return append(checks, check)
+	case *ecdsa.PrivateKey:
+		checks := CheckPublicKey(&k.PublicKey)
+		check := MatchCheck{Name: "ECDSA private scalar gives the public point", OK: true}
+		n := k.Curve.Params().N
+		if k.D.Sign() <= 0 || k.D.Cmp(n) >= 0 {
+			check.OK, check.Detail = false, "private scalar is not between 1 and the order of the curve"
+		} else if x, y := k.Curve.ScalarBaseMult(k.D.Bytes()); x.Cmp(k.X) != 0 || y.Cmp(k.Y) != 0 {
+			check.OK, check.Detail = false, "public point is not that of the private scalar"
+		}
+		return append(checks, check)
+	case ed25519.PrivateKey:
+		check := MatchCheck{Name: "Ed25519 public key is that of the seed", OK: true}
+		if len(k) != ed25519.PrivateKeySize {
+			check.OK, check.Detail = false, fmt.Sprintf("private key is %d bytes, not %d", len(k), ed25519.PrivateKeySize)
+		} else if !ed25519.NewKeyFromSeed(k.Seed()).Equal(k) {
+			check.OK, check.Detail = false, "public key is not that of the seed"
+		}
+		return []MatchCheck{check}
+	}
+	return []MatchCheck{{Name: "private key is supported", Detail: fmt.Sprintf("unsupported private key type %T", key)}}
+}
+
+// CheckPublicKey checks that a public key is valid: that an RSA modulus and exponent are odd and greater
+// than one, and that an ECDSA point is on its curve
+func CheckPublicKey(pub crypto.PublicKey) []MatchCheck {
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		check := MatchCheck{Name: "RSA public key is valid", OK: true}
+		one := big.NewInt(1)
+		switch {
+		case k.N == nil || k.N.Cmp(one) <= 0 || k.N.Bit(0) == 0:
+			check.OK, check.Detail = false, "modulus is not odd and greater than one"
+		case k.E <= 1 || k.E%2 == 0:
+			check.OK, check.Detail = false, fmt.Sprintf("public exponent %d is not odd and greater than one", k.E)
+		}
+		return []MatchCheck{check}
+	case *ecdsa.PublicKey:
+		check := MatchCheck{Name: fmt.Sprintf("ECDSA public point is on curve %s", k.Curve.Params().Name), OK: true}
+		if k.X == nil || k.Y == nil || !k.Curve.IsOnCurve(k.X, k.Y) {
+			check.OK, check.Detail = false, "public point is not on the curve"
+		}
+		return []MatchCheck{check}
+	case ed25519.PublicKey:
+		check := MatchCheck{Name: "Ed25519 public key is valid", OK: true}
+		if len(k) != ed25519.PublicKeySize {
+			check.OK, check.Detail = false, fmt.Sprintf("public key is %d bytes, not %d", len(k), ed25519.PublicKeySize)
+		}
+		return []MatchCheck{check}
+	}
+	return []MatchCheck{{Name: "public key is supported", Detail: fmt.Sprintf("unsupported public key type %T", pub)}}
+}
@@ -0,0 +1,108 @@
+package ca
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func TestCheckKey(t *testing.T) {
+	rsaKey, err := GenerateKey(KeyOptions{Type: RSA, Size: 2048})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := GenerateKey(KeyOptions{Type: ECDSA})
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherECKey, err := GenerateKey(KeyOptions{Type: ECDSA})
+	if err != nil {
+		t.Fatal(err)
+	}
+	edKey, err := GenerateKey(KeyOptions{Type: Ed25519})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaPriv, ec, otherEC, ed := rsaKey.(*rsa.PrivateKey), ecKey.(*ecdsa.PrivateKey), otherECKey.(*ecdsa.PrivateKey), edKey.(ed25519.PrivateKey)
+
+	brokenRSA := &rsa.PrivateKey{PublicKey: rsaPriv.PublicKey, D: new(big.Int).Add(rsaPriv.D, big.NewInt(2)), Primes: rsaPriv.Primes}
+	offCurve := &ecdsa.PrivateKey{PublicKey: ecdsa.PublicKey{Curve: elliptic.P256(), X: ec.X, Y: new(big.Int).Add(ec.Y, big.NewInt(1))}, D: ec.D}
+	otherPoint := &ecdsa.PrivateKey{PublicKey: otherEC.PublicKey, D: ec.D}
+	zeroScalar := &ecdsa.PrivateKey{PublicKey: ec.PublicKey, D: new(big.Int)}
+	otherEd := append(ed25519.PrivateKey{}, ed...)
+	copy(otherEd[ed25519.SeedSize:], edKey.(ed25519.PrivateKey)[:ed25519.SeedSize])
+
+	tests := []struct {
+		name string
+		key  interface{}
+		// failed are the details expected of the failed checks, by substring
+		failed []string
+	}{
+		{"RSA", rsaPriv, nil},
+		{"ECDSA", ec, nil},
+		{"Ed25519", ed, nil},
+		{"RSA with another private exponent", brokenRSA, []string{"crypto/rsa"}},
+		{"ECDSA point off the curve", offCurve, []string{"not on the curve", "not that of the private scalar"}},
+		{"ECDSA point of another scalar", otherPoint, []string{"not that of the private scalar"}},
+		{"ECDSA zero scalar", zeroScalar, []string{"not between 1 and the order"}},
+		{"Ed25519 public key of another seed", otherEd, []string{"not that of the seed"}},
+		{"Ed25519 truncated", ed[:40], []string{"40 bytes"}},
+		{"unsupported", "key", []string{"unsupported private key type string"}},
+	}
+	for _, tt := range tests {
+		checkResults(t, tt.name, CheckKey(tt.key), tt.failed)
+	}
+}
+
+func TestCheckPublicKey(t *testing.T) {
+	ecKey, err := GenerateKey(KeyOptions{Type: ECDSA})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ec := ecKey.(*ecdsa.PrivateKey)
+
+	tests := []struct {
+		name   string
+		key    interface{}
+		failed []string
+	}{
+		{"ECDSA", &ec.PublicKey, nil},
+		{"ECDSA point off the curve", &ecdsa.PublicKey{Curve: elliptic.P256(), X: ec.X, Y: new(big.Int).Add(ec.Y, big.NewInt(1))}, []string{"not on the curve"}},
+		{"ECDSA without a point", &ecdsa.PublicKey{Curve: elliptic.P256()}, []string{"not on the curve"}},
+		{"RSA", &rsa.PublicKey{N: big.NewInt(3233), E: 65537}, nil},
+		{"RSA even modulus", &rsa.PublicKey{N: big.NewInt(3234), E: 65537}, []string{"modulus"}},
+		{"RSA even exponent", &rsa.PublicKey{N: big.NewInt(3233), E: 65536}, []string{"exponent 65536"}},
+		{"Ed25519 truncated", ed25519.PublicKey(make([]byte, 31)), []string{"31 bytes"}},
+		{"unsupported", "key", []string{"unsupported public key type string"}},
+	}
+	for _, tt := range tests {
+		checkResults(t, tt.name, CheckPublicKey(tt.key), tt.failed)
+	}
+}
+
+// checkResults checks that the checks that failed are those whose details contain failed, in order
+func checkResults(t *testing.T, name string, checks []MatchCheck, failed []string) {
+	t.Helper()
+	var details []string
+	for _, c := range checks {
+		if !c.OK {
+			details = append(details, c.Detail)
+		}
+	}
+	if len(details) != len(failed) {
+		t.Errorf("%s: failed checks %q, expected %q", name, details, failed)
+		return
+	}
+	for i, d := range details {
+		if !strings.Contains(d, failed[i]) {
+			t.Errorf("%s: failed check %q, expected %q", name, d, failed[i])
+		}
+	}
+	if (MatchError(checks) != nil) != (len(failed) > 0) {
+		t.Errorf("%s: MatchError gave %v", name, MatchError(checks))
+	}
+}
@@ -0,0 +1,32 @@
+package ca
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// lockTimeout is how long to wait for another process to release a lock before giving up
+const lockTimeout = 30 * time.Second
+
+// lockFile takes an exclusive lock on path by creating path.lock, waiting for another process
+// holding it to release it. The returned function releases the lock.
+func lockFile(path string) (func(), error) {
+	lock := path + ".lock"
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		f, err := os.OpenFile(lock, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err == nil {
+			fmt.Fprintf(f, "%d\n", os.Getpid())
+			f.Close()
+			return func() { os.Remove(lock) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, fmt.Errorf("failed to lock %s: %v", path, err)
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timed out waiting for lock %s; if no other process is using the CA, remove it", lock)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
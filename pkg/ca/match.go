@@ -0,0 +1,97 @@
+package ca
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"fmt"
+	"strings"
+)
+
+// MatchOptions are the objects to check are consistent with each other. Cert is required; the others
+// are checked if set.
+type MatchOptions struct {
+	Key  crypto.PrivateKey
+	Cert *x509.Certificate
+	CSR  *x509.CertificateRequest
+	// Chain are the issuers of Cert, each followed by its own issuer
+	Chain []*x509.Certificate
+}
+
+// MatchCheck is the result of one consistency check
+type MatchCheck struct {
+	// Name describes what was checked
+	Name string
+	OK   bool
+	// Detail explains why the check failed
+	Detail string
+}
+
+// CheckMatch checks that the key is the private key of the certificate and the CSR, that the CSR is
+// for the certificate's public key, and that each certificate in the chain is signed by the next,
+// returning the result of each check
+func CheckMatch(opts MatchOptions) []MatchCheck {
+	var checks []MatchCheck
+	if opts.Key != nil {
+		check := MatchCheck{Name: fmt.Sprintf("private key matches certificate %s", opts.Cert.Subject), OK: KeyMatches(opts.Key, opts.Cert.PublicKey)}
+		if !check.OK {
+			check.Detail = fmt.Sprintf("private key has public key %s, certificate has %s", privateKeyFingerprint(opts.Key), DescribePublicKey(opts.Cert.PublicKey).Fingerprint)
+		}
+		checks = append(checks, check)
+	}
+	if opts.CSR != nil {
+		check := MatchCheck{Name: fmt.Sprintf("CSR %s is signed by its key", opts.CSR.Subject), OK: true}
+		if err := opts.CSR.CheckSignature(); err != nil {
+			check.OK, check.Detail = false, err.Error()
+		}
+		checks = append(checks, check)
+		check = MatchCheck{Name: fmt.Sprintf("CSR %s has the public key of certificate %s", opts.CSR.Subject, opts.Cert.Subject), OK: publicKeysEqual(opts.CSR.PublicKey, opts.Cert.PublicKey)}
+		if !check.OK {
+			check.Detail = fmt.Sprintf("CSR has public key %s, certificate has %s", DescribePublicKey(opts.CSR.PublicKey).Fingerprint, DescribePublicKey(opts.Cert.PublicKey).Fingerprint)
+		}
+		checks = append(checks, check)
+		if opts.Key != nil {
+			check = MatchCheck{Name: fmt.Sprintf("private key matches CSR %s", opts.CSR.Subject), OK: KeyMatches(opts.Key, opts.CSR.PublicKey)}
+			if !check.OK {
+				check.Detail = fmt.Sprintf("private key has public key %s, CSR has %s", privateKeyFingerprint(opts.Key), DescribePublicKey(opts.CSR.PublicKey).Fingerprint)
+			}
+			checks = append(checks, check)
+		}
+	}
+	certs := append([]*x509.Certificate{opts.Cert}, opts.Chain...)
+	for i := 0; i+1 < len(certs); i++ {
+		child, parent := certs[i], certs[i+1]
+		check := MatchCheck{Name: fmt.Sprintf("certificate %s is signed by %s", child.Subject, parent.Subject), OK: true}
+		if !bytes.Equal(child.RawIssuer, parent.RawSubject) {
+			check.OK, check.Detail = false, fmt.Sprintf("certificate is issued by %s, not %s", child.Issuer, parent.Subject)
+		} else if err := child.CheckSignatureFrom(parent); err != nil {
+			check.OK, check.Detail = false, err.Error()
+		}
+		checks = append(checks, check)
+	}
+	return checks
+}
+
+// MatchError returns an error describing the failed checks, or nil if all passed
+func MatchError(checks []MatchCheck) error {
+	var failed []string
+	for _, c := range checks {
+		if !c.OK {
+			failed = append(failed, fmt.Sprintf("%s: %s", c.Name, c.Detail))
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d of %d checks failed: %s", len(failed), len(checks), strings.Join(failed, "; "))
+}
+
+func publicKeysEqual(a, b crypto.PublicKey) bool {
+	key, ok := a.(interface{ Equal(crypto.PublicKey) bool })
+	return ok && key.Equal(b)
+}
+
+// privateKeyFingerprint returns the fingerprint of the public key of priv
+func privateKeyFingerprint(priv crypto.PrivateKey) string {
+	return DescribePrivateKey(priv).PublicKey.Fingerprint
+}
@@ -0,0 +1,74 @@
+package ca
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"strings"
+	"testing"
+)
+
+func TestCheckMatch(t *testing.T) {
+	store := newTestStore(t)
+	// otherCA has the same name as the CA of store, but another key
+	otherCA := newTestStore(t).CA.Certificate
+	key, err := GenerateKey(KeyOptions{Type: ECDSA})
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := GenerateKey(KeyOptions{Type: ECDSA})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := store.Sign(CertificateOptions{Subject: pkix.Name{CommonName: "server"}, Days: 1}.Template(), key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	csr, err := CreateCSR(CSROptions{Subject: pkix.Name{CommonName: "server"}}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherCSR, err := CreateCSR(CSROptions{Subject: pkix.Name{CommonName: "server"}}, otherKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		opts MatchOptions
+		// failed are the names of the checks expected to fail, by prefix
+		failed []string
+		checks int
+	}{
+		{"all match", MatchOptions{Key: key, Cert: cert, CSR: csr, Chain: []*x509.Certificate{store.CA.Certificate}}, nil, 5},
+		{"certificate only", MatchOptions{Cert: cert}, nil, 0},
+		{"mismatched key", MatchOptions{Key: otherKey, Cert: cert}, []string{"private key matches certificate"}, 1},
+		{"CSR for another key", MatchOptions{Key: key, Cert: cert, CSR: otherCSR}, []string{"CSR CN=server has the public key", "private key matches CSR"}, 4},
+		{"chain of another issuer", MatchOptions{Cert: cert, Chain: []*x509.Certificate{cert}}, []string{"certificate CN=server is signed by CN=server"}, 1},
+		{"chain with the same name but another key", MatchOptions{Cert: cert, Chain: []*x509.Certificate{otherCA}}, []string{"certificate CN=server is signed by CN=test CA"}, 1},
+	}
+	for _, tt := range tests {
+		checks := CheckMatch(tt.opts)
+		if len(checks) != tt.checks {
+			t.Errorf("%s: %d checks, expected %d", tt.name, len(checks), tt.checks)
+		}
+		var failed []MatchCheck
+		for _, c := range checks {
+			if !c.OK {
+				failed = append(failed, c)
+			}
+		}
+		if len(failed) != len(tt.failed) {
+			t.Errorf("%s: failed checks %+v, expected %v", tt.name, failed, tt.failed)
+			continue
+		}
+		for i, c := range failed {
+			if !strings.HasPrefix(c.Name, tt.failed[i]) || c.Detail == "" {
+				t.Errorf("%s: failed check %+v, expected %s", tt.name, c, tt.failed[i])
+			}
+		}
+		err := MatchError(checks)
+		if (err != nil) != (len(tt.failed) > 0) {
+			t.Errorf("%s: MatchError gave %v", tt.name, err)
+		}
+	}
+}
@@ -0,0 +1,302 @@
+package ca
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+
+	"go.mozilla.org/pkcs7"
+	"golang.org/x/crypto/ssh"
+	pkcs12 "software.sslmate.com/src/go-pkcs12"
+)
+
+// ObjectKind is the kind of a cryptographic object read from a file
+type ObjectKind string
+
+const (
+	KindCertificate    ObjectKind = "certificate"
+	KindCSR            ObjectKind = "certificate request"
+	KindPrivateKey     ObjectKind = "private key"
+	KindPublicKey      ObjectKind = "public key"
+	KindCRL            ObjectKind = "crl"
+	KindPKCS7          ObjectKind = "pkcs7"
+	KindPKCS12         ObjectKind = "pkcs12"
+	KindSSHPublicKey   ObjectKind = "ssh public key"
+	KindSSHCertificate ObjectKind = "ssh certificate"
+	KindSSHPrivateKey  ObjectKind = "ssh private key"
+	KindUnknown        ObjectKind = "unknown"
+)
+
+// Object is a cryptographic object read from a file. The values set depend on its Kind, unless
+// Err is set:
+//
+//   - KindCertificate: Certificate
+//   - KindCSR: CSR
+//   - KindPrivateKey and KindSSHPrivateKey: PrivateKey
+//   - KindPublicKey: PublicKey
+//   - KindCRL: CRL
+//   - KindPKCS7: Certificates
+//   - KindPKCS12: Certificates, leaf first, and PrivateKey if it has one
+//   - KindSSHPublicKey: SSHPublicKey, and SSHComment if it has one
+//   - KindSSHCertificate: SSHCertificate, and SSHComment if it has one
+type Object struct {
+	Kind ObjectKind
+	// PEMType is the type of the PEM block the object was read from, or empty if it was not PEM
+	PEMType        string
+	Certificate    *x509.Certificate
+	CSR            *x509.CertificateRequest
+	PrivateKey     crypto.PrivateKey
+	PublicKey      crypto.PublicKey
+	CRL            *CRL
+	Certificates   []*x509.Certificate
+	SSHPublicKey   ssh.PublicKey
+	SSHCertificate *ssh.Certificate
+	SSHComment     string
+	// Err is why the object could not be parsed
+	Err error
+}
+
+// Public returns the public key of the object: that of a certificate, CSR, private or public key, or
+// OpenSSH public key or certificate. It returns nil for other objects.
+func (o Object) Public() crypto.PublicKey {
+	switch {
+	case o.Err != nil:
+		return nil
+	case o.Certificate != nil:
+		return o.Certificate.PublicKey
+	case o.CSR != nil:
+		return o.CSR.PublicKey
+	case o.PublicKey != nil:
+		return o.PublicKey
+	case o.SSHCertificate != nil:
+		return sshCryptoPublicKey(o.SSHCertificate.Key)
+	case o.SSHPublicKey != nil:
+		return sshCryptoPublicKey(o.SSHPublicKey)
+	}
+	if signer, ok := o.PrivateKey.(crypto.Signer); ok {
+		return signer.Public()
+	}
+	return nil
+}
+
+// sshCryptoPublicKey returns the crypto public key of an OpenSSH public key, or nil if it has none
+func sshCryptoPublicKey(pub ssh.PublicKey) crypto.PublicKey {
+	if k, ok := pub.(ssh.CryptoPublicKey); ok {
+		return k.CryptoPublicKey()
+	}
+	return nil
+}
+
+// PasswordFunc returns the password to decrypt an object, e.g. by prompting for it
+type PasswordFunc func(prompt string) (string, error)
+
+// ReadObjects reads every object in b, which is one of:
+//
+//   - a sequence of PEM blocks
+//   - OpenSSH public keys or certificates, one per line, as in authorized_keys
+//   - a single DER-encoded certificate, CSR, private or public key, CRL, PKCS#7 bundle or PKCS#12 file
+//
+// PEM blocks that cannot be parsed are returned with Err set. password is used for encrypted private
+// keys, and PKCS#12 files that are not encrypted with an empty password, and may be nil.
+func ReadObjects(b []byte, password PasswordFunc) ([]Object, error) {
+	block, rest := pem.Decode(b)
+	if block == nil {
+		if bytes.Contains(b, []byte("-----BEGIN")) {
+			return nil, errors.New("invalid PEM")
+		}
+		if objects, ok := parseAuthorizedKeys(b); ok {
+			return objects, nil
+		}
+		obj := parseDER(b, password)
+		if obj.Kind == KindUnknown {
+			return nil, errors.New("neither PEM, OpenSSH nor a DER-encoded certificate, CSR, key, CRL, PKCS#7 or PKCS#12")
+		}
+		return []Object{obj}, nil
+	}
+	var objects []Object
+	for ; block != nil; block, rest = pem.Decode(rest) {
+		objects = append(objects, parsePEMBlock(block, password))
+	}
+	return objects, nil
+}
+
+func parsePEMBlock(block *pem.Block, password PasswordFunc) Object {
+	obj := Object{PEMType: block.Type}
+	var err error
+	switch {
+	case block.Type == "CERTIFICATE":
+		obj.Kind = KindCertificate
+		obj.Certificate, err = x509.ParseCertificate(block.Bytes)
+	case block.Type == "CERTIFICATE REQUEST" || block.Type == "NEW CERTIFICATE REQUEST":
+		obj.Kind = KindCSR
+		obj.CSR, err = x509.ParseCertificateRequest(block.Bytes)
+	case block.Type == "OPENSSH PRIVATE KEY":
+		obj.Kind = KindSSHPrivateKey
+		obj.PrivateKey, err = parseSSHPrivateKey(pem.EncodeToMemory(block))
+	case block.Type == "PRIVATE KEY" || strings.HasSuffix(block.Type, " PRIVATE KEY"):
+		obj.Kind = KindPrivateKey
+		obj.PrivateKey, err = parsePrivateKeyBlock(block, password)
+	case block.Type == "PUBLIC KEY":
+		obj.Kind = KindPublicKey
+		obj.PublicKey, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case block.Type == "RSA PUBLIC KEY":
+		obj.Kind = KindPublicKey
+		obj.PublicKey, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	case block.Type == "X509 CRL":
+		obj.Kind = KindCRL
+		obj.CRL, err = ParseCRL(block.Bytes)
+	case block.Type == "PKCS7" || block.Type == "PKCS #7 SIGNED DATA" || block.Type == "CMS":
+		obj.Kind = KindPKCS7
+		obj.Certificates, err = ParsePKCS7(block.Bytes)
+	default:
+		obj.Kind, err = KindUnknown, fmt.Errorf("unsupported PEM type %s", block.Type)
+	}
+	obj.Err = err
+	return obj
+}
+
+// parseDER detects the kind of a DER-encoded object
+func parseDER(der []byte, password PasswordFunc) Object {
+	if cert, err := x509.ParseCertificate(der); err == nil {
+		return Object{Kind: KindCertificate, Certificate: cert}
+	}
+	if csr, err := x509.ParseCertificateRequest(der); err == nil {
+		return Object{Kind: KindCSR, CSR: csr}
+	}
+	if key, err := ParsePrivateKey(der); err == nil {
+		return Object{Kind: KindPrivateKey, PrivateKey: key}
+	}
+	if isEncryptedPKCS8(der) {
+		obj := Object{Kind: KindPrivateKey}
+		obj.PrivateKey, obj.Err = parsePrivateKeyBlock(&pem.Block{Type: "ENCRYPTED PRIVATE KEY", Bytes: der}, password)
+		return obj
+	}
+	if pub, err := x509.ParsePKIXPublicKey(der); err == nil {
+		return Object{Kind: KindPublicKey, PublicKey: pub}
+	}
+	if pub, err := x509.ParsePKCS1PublicKey(der); err == nil {
+		return Object{Kind: KindPublicKey, PublicKey: pub}
+	}
+	if crl, err := ParseCRL(der); err == nil {
+		return Object{Kind: KindCRL, CRL: crl}
+	}
+	if certs, err := ParsePKCS7(der); err == nil {
+		return Object{Kind: KindPKCS7, Certificates: certs}
+	}
+	if IsPKCS12(der) {
+		obj := Object{Kind: KindPKCS12}
+		obj.PrivateKey, obj.Certificates, obj.Err = ParsePKCS12(der, password)
+		return obj
+	}
+	return Object{Kind: KindUnknown, Err: errors.New("unrecognized DER")}
+}
+
+// ParsePKCS7 returns the certificates in a DER-encoded PKCS#7 signed data bundle, e.g. a .p7b file
+func ParsePKCS7(der []byte) ([]*x509.Certificate, error) {
+	p7, err := pkcs7.Parse(der)
+	if err != nil {
+		return nil, err
+	}
+	return p7.Certificates, nil
+}
+
+// EncodePKCS7 returns a DER-encoded PKCS#7 signed data bundle holding only the certificates, as in a .p7b
+// file. Duplicate certificates are included once.
+func EncodePKCS7(certs []*x509.Certificate) ([]byte, error) {
+	if len(certs) == 0 {
+		return nil, errors.New("no certificates to bundle")
+	}
+	var (
+		der  []byte
+		seen = map[string]bool{}
+	)
+	for _, cert := range certs {
+		if !seen[string(cert.Raw)] {
+			seen[string(cert.Raw)] = true
+			der = append(der, cert.Raw...)
+		}
+	}
+	return pkcs7.DegenerateCertificate(der)
+}
+
+// IsPKCS12 reports whether der looks like a PKCS#12 file, without decrypting it
+func IsPKCS12(der []byte) bool {
+	var pfx struct {
+		Version  int
+		AuthSafe struct {
+			ContentType asn1.ObjectIdentifier
+			Content     asn1.RawValue `asn1:"tag:0,explicit,optional"`
+		}
+		MacData asn1.RawValue `asn1:"optional"`
+	}
+	rest, err := asn1.Unmarshal(der, &pfx)
+	return err == nil && len(rest) == 0 && pfx.Version == 3
+}
+
+// ParsePKCS12 decodes a PKCS#12 file, returning its private key, if any, and its certificates, leaf
+// first. It tries an empty password, then asks password, if not nil.
+func ParsePKCS12(der []byte, password PasswordFunc) (crypto.PrivateKey, []*x509.Certificate, error) {
+	key, certs, err := decodePKCS12(der, "")
+	if err == pkcs12.ErrIncorrectPassword && password != nil {
+		var p string
+		if p, err = password("PKCS#12 password: "); err != nil {
+			return nil, nil, err
+		}
+		key, certs, err = decodePKCS12(der, p)
+	}
+	return key, certs, err
+}
+
+func decodePKCS12(der []byte, password string) (crypto.PrivateKey, []*x509.Certificate, error) {
+	key, cert, chain, err := pkcs12.DecodeChain(der, password)
+	if err == nil {
+		return key, append([]*x509.Certificate{cert}, chain...), nil
+	}
+	if err == pkcs12.ErrIncorrectPassword {
+		return nil, nil, err
+	}
+	// without a private key, it may be a trust store
+	certs, trustErr := pkcs12.DecodeTrustStore(der, password)
+	if trustErr != nil {
+		return nil, nil, err
+	}
+	return nil, certs, nil
+}
+
+// parseSSHPrivateKey parses an OpenSSH private key, which must not be encrypted
+func parseSSHPrivateKey(b []byte) (crypto.PrivateKey, error) {
+	key, err := ssh.ParseRawPrivateKey(b)
+	if err != nil {
+		return nil, err
+	}
+	// ssh returns a pointer for ed25519, unlike x509
+	if k, ok := key.(*ed25519.PrivateKey); ok {
+		return *k, nil
+	}
+	return key, nil
+}
+
+// parseAuthorizedKeys parses OpenSSH public keys and certificates, one per line, returning false if b
+// is not in that format
+func parseAuthorizedKeys(b []byte) ([]Object, bool) {
+	var objects []Object
+	for rest := b; len(bytes.TrimSpace(rest)) > 0; {
+		pub, comment, _, next, err := ssh.ParseAuthorizedKey(rest)
+		if err != nil {
+			return nil, false
+		}
+		obj := Object{Kind: KindSSHPublicKey, SSHPublicKey: pub, SSHComment: comment}
+		if cert, ok := pub.(*ssh.Certificate); ok {
+			obj.Kind, obj.SSHPublicKey, obj.SSHCertificate = KindSSHCertificate, nil, cert
+		}
+		objects = append(objects, obj)
+		rest = next
+	}
+	return objects, len(objects) > 0
+}
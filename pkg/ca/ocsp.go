@@ -0,0 +1,157 @@
+package ca
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// maxOCSPRequestSize limits the body of OCSP POST requests
+const maxOCSPRequestSize = 10 * 1024
+
+// OCSPResponder answers RFC 6960 OCSP requests about the certificates in a CA's index. It is an
+// http.Handler supporting both GET and POST requests.
+type OCSPResponder struct {
+	// Issuer is the CA certificate whose certificates the responder answers for
+	Issuer *x509.Certificate
+	Index  Index
+	// Validity is how long each response is valid, i.e. its nextUpdate
+	Validity time.Duration
+
+	signerCert *x509.Certificate
+	signerKey  crypto.Signer
+}
+
+// NewOCSPResponder creates an OCSP responder for the certificates issued by issuer and recorded in index.
+// Responses are signed by signerKey; signerCert is either the issuer itself, or a delegated responder
+// certificate issued by it with the OCSPSigning extended key usage.
+func NewOCSPResponder(issuer *x509.Certificate, index Index, signerCert *x509.Certificate, signerKey crypto.Signer) (*OCSPResponder, error) {
+	if !bytes.Equal(signerCert.Raw, issuer.Raw) {
+		if err := signerCert.CheckSignatureFrom(issuer); err != nil {
+			return nil, fmt.Errorf("OCSP responder certificate not issued by CA: %v", err)
+		}
+		var hasEKU bool
+		for _, u := range signerCert.ExtKeyUsage {
+			if u == x509.ExtKeyUsageOCSPSigning {
+				hasEKU = true
+			}
+		}
+		if !hasEKU {
+			return nil, errors.New("OCSP responder certificate does not have the OCSPSigning extended key usage")
+		}
+	}
+	return &OCSPResponder{
+		Issuer:     issuer,
+		Index:      index,
+		Validity:   time.Hour * 24,
+		signerCert: signerCert,
+		signerKey:  signerKey,
+	}, nil
+}
+
+// Respond returns the DER-encoded OCSP response for a DER-encoded OCSP request
+func (r *OCSPResponder) Respond(request []byte) []byte {
+	req, err := ocsp.ParseRequest(request)
+	if err != nil {
+		return ocsp.MalformedRequestErrorResponse
+	}
+	if ok, err := r.matchesIssuer(req); err != nil || !ok {
+		return ocsp.UnauthorizedErrorResponse
+	}
+	entry, err := r.Index.Lookup(req.SerialNumber)
+	if err != nil {
+		return ocsp.InternalErrorErrorResponse
+	}
+	now := time.Now().UTC().Truncate(time.Minute)
+	template := ocsp.Response{
+		Status:       ocsp.Unknown,
+		SerialNumber: req.SerialNumber,
+		ThisUpdate:   now,
+		NextUpdate:   now.Add(r.Validity),
+		IssuerHash:   req.HashAlgorithm,
+	}
+	if entry != nil {
+		template.Status = ocsp.Good
+		if entry.Revoked() {
+			template.Status = ocsp.Revoked
+			template.RevokedAt = *entry.RevokedAt
+			template.RevocationReason = int(entry.RevocationReason)
+		}
+	}
+	if !bytes.Equal(r.signerCert.Raw, r.Issuer.Raw) {
+		template.Certificate = r.signerCert
+	}
+	resp, err := ocsp.CreateResponse(r.Issuer, r.signerCert, template, r.signerKey)
+	if err != nil {
+		return ocsp.InternalErrorErrorResponse
+	}
+	return resp
+}
+
+// ServeHTTP answers OCSP requests sent as the body of a POST, or base64-encoded in the path of a GET
+func (r *OCSPResponder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	var (
+		request []byte
+		err     error
+	)
+	switch req.Method {
+	case http.MethodPost:
+		request, err = io.ReadAll(io.LimitReader(req.Body, maxOCSPRequestSize))
+	case http.MethodGet:
+		request, err = decodeOCSPGet(req.URL)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	response := ocsp.MalformedRequestErrorResponse
+	if err == nil {
+		response = r.Respond(request)
+	}
+	w.Header().Set("Content-Type", "application/ocsp-response")
+	_, _ = w.Write(response)
+}
+
+// decodeOCSPGet extracts the request from the path of an RFC 6960 appendix A.1 GET request. The
+// whole path is the request, since clients do not always escape the '/' in base64; to serve under
+// a prefix, use http.StripPrefix.
+func decodeOCSPGet(u *url.URL) ([]byte, error) {
+	encoded, err := url.PathUnescape(strings.TrimPrefix(u.EscapedPath(), "/"))
+	if err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(encoded)
+}
+
+// matchesIssuer checks that the request asks about a certificate issued by our issuer
+func (r *OCSPResponder) matchesIssuer(req *ocsp.Request) (bool, error) {
+	if !req.HashAlgorithm.Available() {
+		return false, fmt.Errorf("unsupported hash algorithm %v", req.HashAlgorithm)
+	}
+	var spki struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(r.Issuer.RawSubjectPublicKeyInfo, &spki); err != nil {
+		return false, err
+	}
+	h := req.HashAlgorithm.New()
+	h.Write(spki.PublicKey.RightAlign())
+	keyHash := h.Sum(nil)
+	h.Reset()
+	h.Write(r.Issuer.RawSubject)
+	nameHash := h.Sum(nil)
+	return bytes.Equal(keyHash, req.IssuerKeyHash) && bytes.Equal(nameHash, req.IssuerNameHash), nil
+}
@@ -0,0 +1,211 @@
+package ca
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// signTestCert issues a certificate from the store for a fresh key
+func signTestCert(t *testing.T, store *Store, opts CertificateOptions) *x509.Certificate {
+	t.Helper()
+	key, err := GenerateKey(KeyOptions{Type: ECDSA})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.Days == 0 {
+		opts.Days = 1
+	}
+	cert, err := store.Sign(opts.Template(), key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+// queryOCSP asks the responder at base about cert, using GET or POST
+func queryOCSP(t *testing.T, base, method string, cert, issuer *x509.Certificate) []byte {
+	t.Helper()
+	request, err := ocsp.CreateRequest(cert, issuer, &ocsp.RequestOptions{Hash: crypto.SHA256})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var resp *http.Response
+	switch method {
+	case http.MethodGet:
+		resp, err = http.Get(base + "/" + url.PathEscape(base64.StdEncoding.EncodeToString(request)))
+	case http.MethodPost:
+		resp, err = http.Post(base, "application/ocsp-request", bytes.NewReader(request))
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "application/ocsp-response" {
+		t.Errorf("content type %s", ct)
+	}
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestOCSPResponder(t *testing.T) {
+	store := newTestStore(t)
+	issuer := store.CA.Certificate
+	good := signTestCert(t, store, CertificateOptions{Subject: pkix.Name{CommonName: "good"}})
+	revoked := signTestCert(t, store, CertificateOptions{Subject: pkix.Name{CommonName: "revoked"}})
+	revokedAt := time.Now().Add(-time.Hour)
+	if _, err := store.Index().Revoke(revoked.SerialNumber, ReasonKeyCompromise, revokedAt); err != nil {
+		t.Fatal(err)
+	}
+	// signed by the CA, but never recorded in its index
+	unknownTemplate := CertificateOptions{Subject: pkix.Name{CommonName: "unknown"}, SerialNumber: big.NewInt(1000), Days: 1}.Template()
+	unknown, err := store.CA.Sign(unknownTemplate, store.CA.Key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	responderKey, err := GenerateKey(KeyOptions{Type: ECDSA})
+	if err != nil {
+		t.Fatal(err)
+	}
+	responderCert, err := store.Sign(CertificateOptions{
+		Subject:     pkix.Name{CommonName: "OCSP responder"},
+		Days:        1,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageOCSPSigning},
+	}.Template(), responderKey.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signers := []struct {
+		name string
+		cert *x509.Certificate
+		key  crypto.Signer
+	}{
+		{"issuer", issuer, store.CA.Key},
+		{"delegated", responderCert, responderKey},
+	}
+	for _, signer := range signers {
+		responder, err := NewOCSPResponder(issuer, store.Index(), signer.cert, signer.key)
+		if err != nil {
+			t.Fatalf("%s: %v", signer.name, err)
+		}
+		srv := httptest.NewServer(responder)
+		for _, method := range []string{http.MethodGet, http.MethodPost} {
+			tests := []struct {
+				name   string
+				cert   *x509.Certificate
+				status int
+			}{
+				{"good", good, ocsp.Good},
+				{"ca", issuer, ocsp.Good},
+				{"revoked", revoked, ocsp.Revoked},
+				{"unknown", unknown, ocsp.Unknown},
+			}
+			for _, tt := range tests {
+				der := queryOCSP(t, srv.URL, method, tt.cert, issuer)
+				resp, err := ocsp.ParseResponseForCert(der, tt.cert, issuer)
+				if err != nil {
+					t.Errorf("%s %s %s: %v", signer.name, method, tt.name, err)
+					continue
+				}
+				if resp.Status != tt.status {
+					t.Errorf("%s %s %s: status %d, expected %d", signer.name, method, tt.name, resp.Status, tt.status)
+				}
+				if resp.SerialNumber.Cmp(tt.cert.SerialNumber) != 0 {
+					t.Errorf("%s %s %s: serial %v", signer.name, method, tt.name, resp.SerialNumber)
+				}
+				if tt.status == ocsp.Revoked {
+					if resp.RevocationReason != ocsp.KeyCompromise {
+						t.Errorf("%s %s revoked: reason %d", signer.name, method, resp.RevocationReason)
+					}
+					if !resp.RevokedAt.Equal(revokedAt.UTC().Truncate(time.Second)) {
+						t.Errorf("%s %s revoked: revoked at %v, expected %v", signer.name, method, resp.RevokedAt, revokedAt)
+					}
+				}
+				if signer.name == "delegated" && (resp.Certificate == nil || !resp.Certificate.Equal(responderCert)) {
+					t.Errorf("%s %s %s: response does not include the responder certificate", signer.name, method, tt.name)
+				}
+			}
+		}
+
+		// a request about a certificate from another CA
+		other := newTestStore(t)
+		otherCert := signTestCert(t, other, CertificateOptions{Subject: pkix.Name{CommonName: "other"}})
+		der := queryOCSP(t, srv.URL, http.MethodPost, otherCert, other.CA.Certificate)
+		if !bytes.Equal(der, ocsp.UnauthorizedErrorResponse) {
+			t.Errorf("%s: request for another CA's certificate was not refused as unauthorized", signer.name)
+		}
+		srv.Close()
+	}
+}
+
+func TestOCSPResponderMalformed(t *testing.T) {
+	store := newTestStore(t)
+	responder, err := NewOCSPResponder(store.CA.Certificate, store.Index(), store.CA.Certificate, store.CA.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(responder)
+	defer srv.Close()
+
+	resp, err := http.Post(srv.URL, "application/ocsp-request", bytes.NewReader([]byte("not a request")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !bytes.Equal(b, ocsp.MalformedRequestErrorResponse) {
+		t.Error("malformed request not answered with malformedRequest")
+	}
+
+	req, _ := http.NewRequest(http.MethodPut, srv.URL, nil)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("PUT answered with %d", resp.StatusCode)
+	}
+}
+
+func TestNewOCSPResponderDelegation(t *testing.T) {
+	store := newTestStore(t)
+	issuer := store.CA.Certificate
+	key, err := GenerateKey(KeyOptions{Type: ECDSA})
+	if err != nil {
+		t.Fatal(err)
+	}
+	withoutEKU, err := store.Sign(CertificateOptions{Subject: pkix.Name{CommonName: "no EKU"}, Days: 1, ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}}.Template(), key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewOCSPResponder(issuer, store.Index(), withoutEKU, key); err == nil {
+		t.Error("responder certificate without the OCSPSigning EKU was accepted")
+	}
+
+	// a certificate with the EKU, but from another CA
+	other := newTestStore(t)
+	foreign, err := other.Sign(CertificateOptions{Subject: pkix.Name{CommonName: "foreign"}, Days: 1, ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageOCSPSigning}}.Template(), key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewOCSPResponder(issuer, store.Index(), foreign, key); err == nil {
+		t.Error("responder certificate from another CA was accepted")
+	}
+}
@@ -0,0 +1,265 @@
+package ca
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"hash"
+
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/scrypt"
+)
+
+// KDF is the key derivation function with which a passphrase is turned into a key encryption key
+type KDF string
+
+const (
+	// KDFPBKDF2 is PBKDF2 with HMAC-SHA256, as written by OpenSSL by default
+	KDFPBKDF2 KDF = "pbkdf2"
+	// KDFScrypt is scrypt, more resistant to brute force with dedicated hardware, with the parameters
+	// OpenSSL uses
+	KDFScrypt KDF = "scrypt"
+)
+
+// ParseKDF converts a key derivation function name into a KDF
+func ParseKDF(name string) (KDF, error) {
+	switch k := KDF(name); k {
+	case KDFPBKDF2, KDFScrypt:
+		return k, nil
+	default:
+		return "", fmt.Errorf("unknown key derivation function %s, must be one of: pbkdf2, scrypt", name)
+	}
+}
+
+// KeyEncryption is how to encrypt a private key with a passphrase
+type KeyEncryption struct {
+	Passphrase []byte
+	// KDF derives the encryption key from the passphrase; if empty, KDFPBKDF2
+	KDF KDF
+}
+
+// ErrIncorrectPassphrase is returned when decrypting a private key with the wrong passphrase
+var ErrIncorrectPassphrase = errors.New("incorrect passphrase")
+
+// key derivation parameters for encryption
+const (
+	pbkdf2Iterations = 100000
+	scryptN          = 1 << 14
+	scryptR          = 8
+	scryptP          = 1
+	pbesSaltSize     = 16
+)
+
+// limits on the key derivation parameters of keys being decrypted, so that a crafted key file cannot
+// make decryption take hours or exhaust memory. Real-world files use far less: OpenSSL writes 2048
+// PBKDF2 iterations, or scrypt with N=2^14, r=8, p=1.
+const (
+	maxPBKDF2Iterations = 10000000
+	maxScryptN          = 1 << 20
+	maxScryptRP         = 1 << 10
+	// maxScryptMemory bounds the 128*N*r bytes scrypt needs
+	maxScryptMemory = 1 << 30
+)
+
+var (
+	oidPBES2           = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidScrypt          = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11591, 4, 11}
+	oidHMACWithSHA1    = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidHMACWithSHA256  = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidHMACWithSHA384  = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 10}
+	oidHMACWithSHA512  = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 11}
+	oidAES128CBC       = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC       = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC       = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+	oidDESEDE3CBC      = asn1.ObjectIdentifier{1, 2, 840, 113549, 3, 7}
+	asn1NULL           = asn1.RawValue{Tag: asn1.TagNull}
+	pbkdf2PRFs         = map[string]func() hash.Hash{oidHMACWithSHA1.String(): sha1.New, oidHMACWithSHA256.String(): sha256.New, oidHMACWithSHA384.String(): sha512.New384, oidHMACWithSHA512.String(): sha512.New}
+	pbes2CipherKeySize = map[string]int{oidAES128CBC.String(): 16, oidAES192CBC.String(): 24, oidAES256CBC.String(): 32, oidDESEDE3CBC.String(): 24}
+)
+
+// encryptedPrivateKeyInfo is the RFC 5958 EncryptedPrivateKeyInfo
+type encryptedPrivateKeyInfo struct {
+	Algorithm     pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+// pbes2Params are the RFC 8018 PBES2 parameters
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+// pbkdf2Params are the RFC 8018 PBKDF2 parameters
+type pbkdf2Params struct {
+	Salt           []byte
+	IterationCount int
+	KeyLength      int                      `asn1:"optional"`
+	PRF            pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+// scryptParams are the RFC 7914 scrypt parameters
+type scryptParams struct {
+	Salt                     []byte
+	CostParameter            int
+	BlockSize                int
+	ParallelizationParameter int
+	KeyLength                int `asn1:"optional"`
+}
+
+// EncryptPKCS8 encrypts a DER-encoded PKCS#8 private key with PBES2 and AES-256-CBC, returning a
+// DER-encoded EncryptedPrivateKeyInfo
+func EncryptPKCS8(der []byte, enc KeyEncryption) ([]byte, error) {
+	salt := make([]byte, pbesSaltSize)
+	iv := make([]byte, aes.BlockSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(iv); err != nil {
+		return nil, err
+	}
+	var (
+		kdf pkix.AlgorithmIdentifier
+		key []byte
+		err error
+	)
+	switch enc.KDF {
+	case KDFPBKDF2, "":
+		key = pbkdf2.Key(enc.Passphrase, salt, pbkdf2Iterations, 32, sha256.New)
+		params, err := asn1.Marshal(pbkdf2Params{Salt: salt, IterationCount: pbkdf2Iterations, PRF: pkix.AlgorithmIdentifier{Algorithm: oidHMACWithSHA256, Parameters: asn1NULL}})
+		if err != nil {
+			return nil, err
+		}
+		kdf = pkix.AlgorithmIdentifier{Algorithm: oidPBKDF2, Parameters: asn1.RawValue{FullBytes: params}}
+	case KDFScrypt:
+		if key, err = scrypt.Key(enc.Passphrase, salt, scryptN, scryptR, scryptP, 32); err != nil {
+			return nil, err
+		}
+		params, err := asn1.Marshal(scryptParams{Salt: salt, CostParameter: scryptN, BlockSize: scryptR, ParallelizationParameter: scryptP})
+		if err != nil {
+			return nil, err
+		}
+		kdf = pkix.AlgorithmIdentifier{Algorithm: oidScrypt, Parameters: asn1.RawValue{FullBytes: params}}
+	default:
+		return nil, fmt.Errorf("unknown key derivation function %s", enc.KDF)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	// PKCS#7 padding
+	padding := aes.BlockSize - len(der)%aes.BlockSize
+	encrypted := append(append([]byte{}, der...), bytes.Repeat([]byte{byte(padding)}, padding)...)
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(encrypted, encrypted)
+
+	ivParam, err := asn1.Marshal(iv)
+	if err != nil {
+		return nil, err
+	}
+	params, err := asn1.Marshal(pbes2Params{
+		KeyDerivationFunc: kdf,
+		EncryptionScheme:  pkix.AlgorithmIdentifier{Algorithm: oidAES256CBC, Parameters: asn1.RawValue{FullBytes: ivParam}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(encryptedPrivateKeyInfo{
+		Algorithm:     pkix.AlgorithmIdentifier{Algorithm: oidPBES2, Parameters: asn1.RawValue{FullBytes: params}},
+		EncryptedData: encrypted,
+	})
+}
+
+// DecryptPKCS8 decrypts a DER-encoded EncryptedPrivateKeyInfo, returning the DER-encoded PKCS#8 private
+// key. It supports PBES2 with PBKDF2 or scrypt, and AES-CBC or 3DES-CBC.
+func DecryptPKCS8(der, passphrase []byte) ([]byte, error) {
+	var info encryptedPrivateKeyInfo
+	if _, err := asn1.Unmarshal(der, &info); err != nil {
+		return nil, fmt.Errorf("invalid encrypted private key: %v", err)
+	}
+	if !info.Algorithm.Algorithm.Equal(oidPBES2) {
+		return nil, fmt.Errorf("unsupported private key encryption %s, only PBES2 is supported", info.Algorithm.Algorithm)
+	}
+	var params pbes2Params
+	if _, err := asn1.Unmarshal(info.Algorithm.Parameters.FullBytes, &params); err != nil {
+		return nil, fmt.Errorf("invalid PBES2 parameters: %v", err)
+	}
+	scheme := params.EncryptionScheme.Algorithm
+	keySize, ok := pbes2CipherKeySize[scheme.String()]
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key cipher %s", scheme)
+	}
+	var iv []byte
+	if _, err := asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil {
+		return nil, fmt.Errorf("invalid cipher IV: %v", err)
+	}
+	key, err := deriveKey(params.KeyDerivationFunc, passphrase, keySize)
+	if err != nil {
+		return nil, err
+	}
+	var block cipher.Block
+	if scheme.Equal(oidDESEDE3CBC) {
+		block, err = des.NewTripleDESCipher(key)
+	} else {
+		block, err = aes.NewCipher(key)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(iv) != block.BlockSize() || len(info.EncryptedData) == 0 || len(info.EncryptedData)%block.BlockSize() != 0 {
+		return nil, errors.New("invalid encrypted private key length")
+	}
+	decrypted := make([]byte, len(info.EncryptedData))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(decrypted, info.EncryptedData)
+	// a wrong passphrase almost always gives invalid padding
+	padding := int(decrypted[len(decrypted)-1])
+	if padding == 0 || padding > block.BlockSize() || !bytes.Equal(decrypted[len(decrypted)-padding:], bytes.Repeat([]byte{byte(padding)}, padding)) {
+		return nil, ErrIncorrectPassphrase
+	}
+	return decrypted[:len(decrypted)-padding], nil
+}
+
+// deriveKey derives a key of size bytes from the passphrase with the PBES2 key derivation function kdf
+func deriveKey(kdf pkix.AlgorithmIdentifier, passphrase []byte, size int) ([]byte, error) {
+	switch {
+	case kdf.Algorithm.Equal(oidPBKDF2):
+		var params pbkdf2Params
+		if _, err := asn1.Unmarshal(kdf.Parameters.FullBytes, &params); err != nil {
+			return nil, fmt.Errorf("invalid PBKDF2 parameters: %v", err)
+		}
+		prf := sha1.New
+		if len(params.PRF.Algorithm) > 0 {
+			var ok bool
+			if prf, ok = pbkdf2PRFs[params.PRF.Algorithm.String()]; !ok {
+				return nil, fmt.Errorf("unsupported PBKDF2 PRF %s", params.PRF.Algorithm)
+			}
+		}
+		if params.IterationCount < 1 || params.IterationCount > maxPBKDF2Iterations {
+			return nil, fmt.Errorf("unsupported PBKDF2 iteration count %d, must be from 1 to %d", params.IterationCount, maxPBKDF2Iterations)
+		}
+		return pbkdf2.Key(passphrase, params.Salt, params.IterationCount, size, prf), nil
+	case kdf.Algorithm.Equal(oidScrypt):
+		var params scryptParams
+		if _, err := asn1.Unmarshal(kdf.Parameters.FullBytes, &params); err != nil {
+			return nil, fmt.Errorf("invalid scrypt parameters: %v", err)
+		}
+		n, r, p := params.CostParameter, params.BlockSize, params.ParallelizationParameter
+		if n < 2 || n > maxScryptN {
+			return nil, fmt.Errorf("unsupported scrypt cost parameter %d, must be at most %d", n, maxScryptN)
+		}
+		// r and p are checked on their own first, so r*p cannot overflow
+		if r < 1 || p < 1 || r > maxScryptRP || p > maxScryptRP || r*p > maxScryptRP || 128*n*r > maxScryptMemory {
+			return nil, fmt.Errorf("unsupported scrypt parameters r=%d, p=%d, r*p must be at most %d and 128*N*r at most %d", r, p, maxScryptRP, maxScryptMemory)
+		}
+		return scrypt.Key(passphrase, params.Salt, params.CostParameter, params.BlockSize, params.ParallelizationParameter, size)
+	}
+	return nil, fmt.Errorf("unsupported key derivation function %s", kdf.Algorithm)
+}
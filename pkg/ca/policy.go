@@ -0,0 +1,324 @@
+package ca
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Policy is a set of rules a CSR must meet to be signed automatically
+type Policy struct {
+	// DNSSuffixes are the domains DNS SANs must be in; a suffix matches the domain itself and its
+	// subdomains, or only its subdomains if it starts with '.'. Empty allows any.
+	DNSSuffixes []string
+	// IPRanges are the networks IP SANs must be in; empty allows any
+	IPRanges []*net.IPNet
+	// EmailDomains are the domains email SANs must be in, matched like DNSSuffixes. Unlike DNS and
+	// IP SANs, empty allows none.
+	EmailDomains []string
+	// UPNDomains are the domains UPN SANs must be in, matched like DNSSuffixes; empty allows none
+	UPNDomains []string
+	// URIPrefixes are the prefixes URI SANs must start with, e.g. spiffe://example.com/; empty allows none
+	URIPrefixes []string
+	// Subject are the attributes the subject must have, each value matching the pattern
+	Subject []SubjectRule
+	// MinRSASize is the minimum RSA key size in bits
+	MinRSASize int
+	// Curves are the allowed ECDSA curves, e.g. P-256; empty allows any
+	Curves []string
+	// KeyTypes are the allowed key types; empty allows any
+	KeyTypes []KeyType
+	// SignatureAlgorithms are the allowed CSR signature algorithms, e.g. SHA256-RSA; empty allows any
+	SignatureAlgorithms []string
+	// MaxDays is the longest validity allowed, 0 for no limit
+	MaxDays int
+	// AllowCA allows signing CA certificates, and CSRs requesting them
+	AllowCA bool
+}
+
+// SubjectRule requires a subject attribute
+type SubjectRule struct {
+	// Attribute is the attribute keyword or OID, e.g. CN or 2.5.4.3
+	Attribute string
+	oid       asn1.ObjectIdentifier
+	// Pattern must match each value of the attribute, if set
+	Pattern *regexp.Regexp
+}
+
+// PolicyViolation is a rule a CSR does not meet
+type PolicyViolation struct {
+	// Rule is the name of the rule as in the policy file, e.g. san.dnsSuffixes
+	Rule    string
+	Message string
+}
+
+func (v PolicyViolation) String() string {
+	return fmt.Sprintf("%s: %s", v.Rule, v.Message)
+}
+
+// policyConfig is a policy as written in a policy file
+type policyConfig struct {
+	SAN struct {
+		DNSSuffixes  []string `yaml:"dnsSuffixes"`
+		IPRanges     []string `yaml:"ipRanges"`
+		EmailDomains []string `yaml:"emailDomains"`
+		UPNDomains   []string `yaml:"upnDomains"`
+		URIPrefixes  []string `yaml:"uriPrefixes"`
+	} `yaml:"san"`
+	Subject struct {
+		Required map[string]string `yaml:"required"`
+	} `yaml:"subject"`
+	Key struct {
+		MinRSASize          int      `yaml:"minRSASize"`
+		Curves              []string `yaml:"curves"`
+		Types               []string `yaml:"types"`
+		SignatureAlgorithms []string `yaml:"signatureAlgorithms"`
+	} `yaml:"key"`
+	MaxDays int  `yaml:"maxDays"`
+	AllowCA bool `yaml:"allowCA"`
+}
+
+// ParsePolicy reads a policy from a YAML file. The format is:
+//
+//	san:
+//	  dnsSuffixes: [example.com, .svc.cluster.local]
+//	  ipRanges: [10.0.0.0/8]
+//	  emailDomains: [example.com]
+//	  upnDomains: [corp.example.com]
+//	  uriPrefixes: [spiffe://example.com/]
+//	subject:
+//	  required:
+//	    CN: '^[a-z0-9.-]+\.example\.com$'
+//	    O: '^Example Inc$'
+//	    C: ''
+//	key:
+//	  minRSASize: 2048
+//	  curves: [P-256, P-384]
+//	  types: [rsa, ecdsa]
+//	  signatureAlgorithms: [SHA256-RSA, ECDSA-SHA256]
+//	maxDays: 397
+//	allowCA: false
+func ParsePolicy(b []byte) (*Policy, error) {
+	var pc policyConfig
+	if err := yaml.Unmarshal(b, &pc); err != nil {
+		return nil, fmt.Errorf("invalid policy: %v", err)
+	}
+	p := &Policy{
+		DNSSuffixes:         pc.SAN.DNSSuffixes,
+		EmailDomains:        pc.SAN.EmailDomains,
+		UPNDomains:          pc.SAN.UPNDomains,
+		URIPrefixes:         pc.SAN.URIPrefixes,
+		MinRSASize:          pc.Key.MinRSASize,
+		Curves:              pc.Key.Curves,
+		SignatureAlgorithms: pc.Key.SignatureAlgorithms,
+		MaxDays:             pc.MaxDays,
+		AllowCA:             pc.AllowCA,
+	}
+	for _, r := range pc.SAN.IPRanges {
+		_, ipNet, err := net.ParseCIDR(r)
+		if err != nil {
+			return nil, fmt.Errorf("invalid policy san.ipRanges %s: %v", r, err)
+		}
+		p.IPRanges = append(p.IPRanges, ipNet)
+	}
+	for _, t := range pc.Key.Types {
+		kt, err := ParseKeyType(t)
+		if err != nil {
+			return nil, fmt.Errorf("invalid policy key.types: %v", err)
+		}
+		p.KeyTypes = append(p.KeyTypes, kt)
+	}
+	for attr, pattern := range pc.Subject.Required {
+		oid, err := parseAttributeType(attr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid policy subject.required: %v", err)
+		}
+		rule := SubjectRule{Attribute: attr, oid: oid}
+		if pattern != "" {
+			if rule.Pattern, err = regexp.Compile(pattern); err != nil {
+				return nil, fmt.Errorf("invalid policy subject.required %s: %v", attr, err)
+			}
+		}
+		p.Subject = append(p.Subject, rule)
+	}
+	sort.Slice(p.Subject, func(i, j int) bool { return p.Subject[i].Attribute < p.Subject[j].Attribute })
+	return p, nil
+}
+
+// Check returns each rule that the CSR, to be signed with opts, does not meet; none if it meets all
+func (p *Policy) Check(csr *x509.CertificateRequest, opts CertificateOptions) []PolicyViolation {
+	var violations []PolicyViolation
+	violate := func(rule, format string, args ...interface{}) {
+		violations = append(violations, PolicyViolation{Rule: rule, Message: fmt.Sprintf(format, args...)})
+	}
+
+	// subject alternative names
+	if len(p.DNSSuffixes) > 0 {
+		for _, name := range opts.DNSNames {
+			if !matchesDNSSuffix(name, p.DNSSuffixes) {
+				violate("san.dnsSuffixes", "DNS name %s is not in any of %s", name, strings.Join(p.DNSSuffixes, ", "))
+			}
+		}
+	}
+	if len(p.IPRanges) > 0 {
+		for _, ip := range opts.IPAddresses {
+			if !inIPRanges(ip, p.IPRanges) {
+				violate("san.ipRanges", "IP address %s is not in any allowed range", ip)
+			}
+		}
+	}
+	// other SAN types are only allowed by a rule for them
+	for _, email := range opts.EmailAddresses {
+		switch {
+		case len(p.EmailDomains) == 0:
+			violate("san.emailDomains", "email address %s is not allowed, as the policy allows no email SANs", email)
+		case !matchesDNSSuffix(email[strings.LastIndex(email, "@")+1:], p.EmailDomains):
+			violate("san.emailDomains", "email address %s is not in any of %s", email, strings.Join(p.EmailDomains, ", "))
+		}
+	}
+	for _, upn := range opts.UPNs {
+		switch {
+		case len(p.UPNDomains) == 0:
+			violate("san.upnDomains", "UPN %s is not allowed, as the policy allows no UPN SANs", upn)
+		case !matchesDNSSuffix(upn[strings.LastIndex(upn, "@")+1:], p.UPNDomains):
+			violate("san.upnDomains", "UPN %s is not in any of %s", upn, strings.Join(p.UPNDomains, ", "))
+		}
+	}
+	for _, u := range opts.URIs {
+		switch {
+		case len(p.URIPrefixes) == 0:
+			violate("san.uriPrefixes", "URI %s is not allowed, as the policy allows no URI SANs", u)
+		case !hasAnyPrefix(u.String(), p.URIPrefixes):
+			violate("san.uriPrefixes", "URI %s does not start with any of %s", u, strings.Join(p.URIPrefixes, ", "))
+		}
+	}
+
+	// subject
+	var rdns pkix.RDNSequence
+	if _, err := asn1.Unmarshal(csr.RawSubject, &rdns); err != nil {
+		violate("subject", "invalid subject: %v", err)
+	}
+	for _, rule := range p.Subject {
+		var found bool
+		for _, rdn := range rdns {
+			for _, atv := range rdn {
+				if !atv.Type.Equal(rule.oid) {
+					continue
+				}
+				found = true
+				value := fmt.Sprint(atv.Value)
+				if rule.Pattern != nil && !rule.Pattern.MatchString(value) {
+					violate("subject.required."+rule.Attribute, "%q does not match %s", value, rule.Pattern)
+				}
+			}
+		}
+		if !found {
+			violate("subject.required."+rule.Attribute, "missing from the subject")
+		}
+	}
+
+	// key and signature
+	switch pub := csr.PublicKey.(type) {
+	case *rsa.PublicKey:
+		if size := pub.N.BitLen(); size < p.MinRSASize {
+			violate("key.minRSASize", "RSA key size %d is less than %d", size, p.MinRSASize)
+		}
+		p.checkKeyType(RSA, violate)
+	case *ecdsa.PublicKey:
+		curve := pub.Curve.Params().Name
+		if len(p.Curves) > 0 && !containsFold(p.Curves, curve) {
+			violate("key.curves", "curve %s is not one of %s", curve, strings.Join(p.Curves, ", "))
+		}
+		p.checkKeyType(ECDSA, violate)
+	case ed25519.PublicKey:
+		p.checkKeyType(Ed25519, violate)
+	default:
+		violate("key.types", "unsupported key type %T", pub)
+	}
+	if alg := csr.SignatureAlgorithm.String(); len(p.SignatureAlgorithms) > 0 && !containsFold(p.SignatureAlgorithms, alg) {
+		violate("key.signatureAlgorithms", "signature algorithm %s is not one of %s", alg, strings.Join(p.SignatureAlgorithms, ", "))
+	}
+
+	// validity and CA
+	if p.MaxDays > 0 && opts.Days > p.MaxDays {
+		violate("maxDays", "validity of %d days is more than %d", opts.Days, p.MaxDays)
+	}
+	if !p.AllowCA {
+		requested, err := ParseRequestedExtensions(csr)
+		switch {
+		case err != nil:
+			violate("allowCA", "invalid requested extensions: %v", err)
+		case requested.IsCA:
+			violate("allowCA", "CSR requests a CA certificate")
+		}
+		if opts.IsCA {
+			violate("allowCA", "certificate would be a CA")
+		}
+	}
+	return violations
+}
+
+func (p *Policy) checkKeyType(kt KeyType, violate func(rule, format string, args ...interface{})) {
+	if len(p.KeyTypes) == 0 {
+		return
+	}
+	for _, allowed := range p.KeyTypes {
+		if allowed == kt {
+			return
+		}
+	}
+	violate("key.types", "key type %s is not allowed", kt)
+}
+
+// matchesDNSSuffix reports whether name is in one of the domains of suffixes
+func matchesDNSSuffix(name string, suffixes []string) bool {
+	name = strings.ToLower(name)
+	for _, suffix := range suffixes {
+		suffix = strings.ToLower(suffix)
+		if strings.HasPrefix(suffix, ".") {
+			if strings.HasSuffix(name, suffix) {
+				return true
+			}
+		} else if name == suffix || strings.HasSuffix(name, "."+suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func inIPRanges(ip net.IP, ranges []*net.IPNet) bool {
+	for _, r := range ranges {
+		if r.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,70 @@
+package ca
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"strings"
+	"testing"
+)
+
+func TestPolicySANs(t *testing.T) {
+	key, err := GenerateKey(KeyOptions{Type: ECDSA})
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{Subject: pkix.Name{CommonName: "test"}}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	open, err := ParsePolicy([]byte("maxDays: 90\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	strict, err := ParsePolicy([]byte(`
+san:
+  dnsSuffixes: [example.com]
+  ipRanges: [10.0.0.0/8]
+  emailDomains: [example.com]
+  upnDomains: [.corp.example.com]
+  uriPrefixes: [spiffe://example.com/]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		policy *Policy
+		sans   []string
+		rules  []string
+	}{
+		// DNS and IP SANs are unrestricted without their rules, other types are refused
+		{open, []string{"DNS:anything.test", "IP:192.0.2.1"}, nil},
+		{open, []string{"email:me@example.com"}, []string{"san.emailDomains"}},
+		{open, []string{"UPN:me@example.com"}, []string{"san.upnDomains"}},
+		{open, []string{"URI:spiffe://example.com/svc"}, []string{"san.uriPrefixes"}},
+		{strict, []string{"DNS:www.example.com", "IP:10.1.2.3", "email:me@mail.example.com", "UPN:me@eu.corp.example.com", "URI:spiffe://example.com/svc"}, nil},
+		{strict, []string{"DNS:example.org", "IP:192.0.2.1"}, []string{"san.dnsSuffixes", "san.ipRanges"}},
+		{strict, []string{"email:me@example.com.evil.test", "email:me@notexample.com"}, []string{"san.emailDomains", "san.emailDomains"}},
+		// a leading '.' allows only subdomains
+		{strict, []string{"UPN:me@corp.example.com"}, []string{"san.upnDomains"}},
+		{strict, []string{"URI:spiffe://example.com.evil.test/svc", "URI:https://example.com/"}, []string{"san.uriPrefixes", "san.uriPrefixes"}},
+	}
+	for _, tt := range tests {
+		sans, err := ParseSANs(tt.sans)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var rules []string
+		for _, v := range tt.policy.Check(csr, CertificateOptions{SANs: *sans, Days: 30}) {
+			rules = append(rules, v.Rule)
+		}
+		if strings.Join(rules, " ") != strings.Join(tt.rules, " ") {
+			t.Errorf("%v: violated %v, expected %v", tt.sans, rules, tt.rules)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package ca
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Profile is a kind of certificate, determining its key usage, extended key usage,
+// basic constraints and default validity
+type Profile struct {
+	// KeyUsage is used for every key type
+	KeyUsage x509.KeyUsage
+	// RSAKeyUsage is added for RSA keys only, e.g. KeyEncipherment, which is meaningless for
+	// ECDSA and Ed25519 keys
+	RSAKeyUsage x509.KeyUsage
+	ExtKeyUsage []x509.ExtKeyUsage
+	IsCA        bool
+	// MaxPathLen and MaxPathLenZero are as in CertificateOptions, used only for CA profiles
+	MaxPathLen     int
+	MaxPathLenZero bool
+	// Days is the default validity
+	Days int
+}
+
+var builtinProfiles = map[string]Profile{
+	"server": {
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		RSAKeyUsage: x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		Days:        365,
+	},
+	"client": {
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		Days:        365,
+	},
+	"peer": {
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		RSAKeyUsage: x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		Days:        365,
+	},
+	"code-signing": {
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+		Days:        365,
+	},
+	"email": {
+		KeyUsage:    x509.KeyUsageDigitalSignature | x509.KeyUsageContentCommitment,
+		RSAKeyUsage: x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageEmailProtection},
+		Days:        365,
+	},
+	"ocsp-signing": {
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageOCSPSigning},
+		Days:        90,
+	},
+	"timestamping": {
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+		Days:        365,
+	},
+	"intermediate-ca": {
+		KeyUsage:       x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		IsCA:           true,
+		MaxPathLen:     0,
+		MaxPathLenZero: true,
+		Days:           1825,
+	},
+}
+
+// RootCAProfile is the profile of the self-signed certificate of a new CA. It is not one of the
+// built-in profiles, which are for certificates a CA signs.
+var RootCAProfile = Profile{
+	KeyUsage:    x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	RSAKeyUsage: x509.KeyUsageKeyEncipherment,
+	IsCA:        true,
+	Days:        365,
+}
+
+// BuiltinProfiles returns the built-in profiles by name: server, client, peer, code-signing, email,
+// ocsp-signing, timestamping and intermediate-ca
+func BuiltinProfiles() map[string]Profile {
+	profiles := make(map[string]Profile, len(builtinProfiles))
+	for name, p := range builtinProfiles {
+		profiles[name] = p
+	}
+	return profiles
+}
+
+// ProfileNames returns the sorted names of the profiles
+func ProfileNames(profiles map[string]Profile) []string {
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// profileConfig is a profile as written in a profiles config file
+type profileConfig struct {
+	KeyUsage    []string `yaml:"keyUsage"`
+	RSAKeyUsage []string `yaml:"rsaKeyUsage"`
+	ExtKeyUsage []string `yaml:"extKeyUsage"`
+	IsCA        bool     `yaml:"isCA"`
+	// MaxPathLen is unlimited if not set
+	MaxPathLen *int `yaml:"maxPathLen"`
+	Days       int  `yaml:"days"`
+}
+
+// ParseProfiles reads profiles from a YAML config file, and returns them along with the built-in
+// profiles; a profile in the file with the same name as a built-in one replaces it. The format is:
+//
+//	profiles:
+//	  web:
+//	    keyUsage: [DigitalSignature]
+//	    rsaKeyUsage: [KeyEncipherment]
+//	    extKeyUsage: [ServerAuth]
+//	    days: 90
+//	  issuing-ca:
+//	    keyUsage: [DigitalSignature, CertSign, CRLSign]
+//	    isCA: true
+//	    maxPathLen: 0
+//	    days: 1825
+func ParseProfiles(b []byte) (map[string]Profile, error) {
+	var config struct {
+		Profiles map[string]profileConfig `yaml:"profiles"`
+	}
+	if err := yaml.Unmarshal(b, &config); err != nil {
+		return nil, fmt.Errorf("invalid profiles config: %v", err)
+	}
+	profiles := BuiltinProfiles()
+	for name, pc := range config.Profiles {
+		p, err := pc.profile()
+		if err != nil {
+			return nil, fmt.Errorf("invalid profile %s: %v", name, err)
+		}
+		profiles[name] = p
+	}
+	return profiles, nil
+}
+
+func (pc profileConfig) profile() (Profile, error) {
+	var (
+		p   = Profile{IsCA: pc.IsCA, Days: pc.Days, MaxPathLen: -1}
+		err error
+	)
+	if p.KeyUsage, err = ParseKeyUsage(pc.KeyUsage); err != nil {
+		return p, err
+	}
+	if p.RSAKeyUsage, err = ParseKeyUsage(pc.RSAKeyUsage); err != nil {
+		return p, err
+	}
+	if p.ExtKeyUsage, err = ParseExtKeyUsage(pc.ExtKeyUsage); err != nil {
+		return p, err
+	}
+	if pc.MaxPathLen != nil {
+		if *pc.MaxPathLen < 0 {
+			return p, fmt.Errorf("maxPathLen must not be negative")
+		}
+		p.MaxPathLen, p.MaxPathLenZero = *pc.MaxPathLen, *pc.MaxPathLen == 0
+	}
+	if p.Days <= 0 {
+		p.Days = 365
+	}
+	return p, nil
+}
+
+// KeyUsageFor returns the key usage of the profile for a certificate of the public key pub
+func (p Profile) KeyUsageFor(pub crypto.PublicKey) x509.KeyUsage {
+	if _, ok := pub.(*rsa.PublicKey); ok {
+		return p.KeyUsage | p.RSAKeyUsage
+	}
+	return p.KeyUsage
+}
+
+// Apply sets the key usage, extended key usage and basic constraints of the profile in opts, for a
+// certificate of the public key pub. The profile's validity is used if opts has none.
+func (p Profile) Apply(opts *CertificateOptions, pub crypto.PublicKey) {
+	opts.KeyUsage = p.KeyUsageFor(pub)
+	opts.ExtKeyUsage = p.ExtKeyUsage
+	opts.IsCA = p.IsCA
+	if p.IsCA {
+		opts.MaxPathLen, opts.MaxPathLenZero = p.MaxPathLen, p.MaxPathLenZero
+	}
+	if opts.Days == 0 {
+		opts.Days = p.Days
+	}
+}
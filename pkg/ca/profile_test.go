@@ -0,0 +1,22 @@
+package ca
+
+import (
+	"crypto/x509"
+	"testing"
+)
+
+func TestRootCAProfileKeyUsage(t *testing.T) {
+	for _, opts := range []KeyOptions{{Type: RSA, Size: 2048}, {Type: ECDSA}, {Type: Ed25519}} {
+		key, err := GenerateKey(opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		usage := RootCAProfile.KeyUsageFor(key.Public())
+		if usage&(x509.KeyUsageCertSign|x509.KeyUsageCRLSign) != x509.KeyUsageCertSign|x509.KeyUsageCRLSign {
+			t.Errorf("%v: CA key usage %v lacks CertSign or CRLSign", opts.Type, KeyUsageStrings(usage))
+		}
+		if hasKE := usage&x509.KeyUsageKeyEncipherment != 0; hasKE != (opts.Type == RSA) {
+			t.Errorf("%v: CA key usage %v", opts.Type, KeyUsageStrings(usage))
+		}
+	}
+}
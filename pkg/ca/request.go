@@ -0,0 +1,186 @@
+package ca
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"fmt"
+	"strings"
+)
+
+var (
+	oidExtensionKeyUsage         = asn1.ObjectIdentifier{2, 5, 29, 15}
+	oidExtensionExtKeyUsage      = asn1.ObjectIdentifier{2, 5, 29, 37}
+	oidExtensionBasicConstraints = asn1.ObjectIdentifier{2, 5, 29, 19}
+)
+
+// RequestedExtensions are the key usage, extended key usage and basic constraints extensions
+// requested in a CSR
+type RequestedExtensions struct {
+	// KeyUsage is 0 if not requested
+	KeyUsage x509.KeyUsage
+	// ExtKeyUsage and UnknownExtKeyUsage are both empty if not requested
+	ExtKeyUsage        []x509.ExtKeyUsage
+	UnknownExtKeyUsage []asn1.ObjectIdentifier
+	// BasicConstraints is whether basic constraints were requested at all
+	BasicConstraints bool
+	IsCA             bool
+	// MaxPathLen is -1 if the request has no path length
+	MaxPathLen int
+}
+
+// ParseRequestedExtensions returns the extensions requested in csr
+func ParseRequestedExtensions(csr *x509.CertificateRequest) (RequestedExtensions, error) {
+	req := RequestedExtensions{MaxPathLen: -1}
+	for _, ext := range csr.Extensions {
+		switch {
+		case ext.Id.Equal(oidExtensionKeyUsage):
+			var bits asn1.BitString
+			if _, err := asn1.Unmarshal(ext.Value, &bits); err != nil {
+				return req, fmt.Errorf("invalid requested key usage: %v", err)
+			}
+			for i := 0; i < 9; i++ {
+				if bits.At(i) != 0 {
+					req.KeyUsage |= 1 << uint(i)
+				}
+			}
+		case ext.Id.Equal(oidExtensionExtKeyUsage):
+			var oids []asn1.ObjectIdentifier
+			if _, err := asn1.Unmarshal(ext.Value, &oids); err != nil {
+				return req, fmt.Errorf("invalid requested extended key usage: %v", err)
+			}
+			for _, oid := range oids {
+				if u, ok := extKeyUsageFromOID(oid); ok {
+					req.ExtKeyUsage = append(req.ExtKeyUsage, u)
+				} else {
+					req.UnknownExtKeyUsage = append(req.UnknownExtKeyUsage, oid)
+				}
+			}
+		case ext.Id.Equal(oidExtensionBasicConstraints):
+			var constraints struct {
+				IsCA       bool `asn1:"optional"`
+				MaxPathLen int  `asn1:"optional,default:-1"`
+			}
+			if _, err := asn1.Unmarshal(ext.Value, &constraints); err != nil {
+				return req, fmt.Errorf("invalid requested basic constraints: %v", err)
+			}
+			req.BasicConstraints, req.IsCA, req.MaxPathLen = true, constraints.IsCA, constraints.MaxPathLen
+		}
+	}
+	return req, nil
+}
+
+// ExtensionPolicy is how the extensions requested in a CSR are treated when signing it
+type ExtensionPolicy string
+
+const (
+	// ExtensionsIgnore uses the profile, ignoring the requested extensions
+	ExtensionsIgnore ExtensionPolicy = "ignore"
+	// ExtensionsCopy uses each requested extension in place of that of the profile
+	ExtensionsCopy ExtensionPolicy = "copy"
+	// ExtensionsFilter uses those of the requested usages and constraints that the profile allows,
+	// failing if the profile allows none of the requested key usages or extended key usages
+	ExtensionsFilter ExtensionPolicy = "filter"
+	// ExtensionsReject uses the profile, failing if the request asks for anything it does not allow
+	ExtensionsReject ExtensionPolicy = "reject"
+)
+
+// ParseExtensionPolicy returns the extension policy with the given name
+func ParseExtensionPolicy(name string) (ExtensionPolicy, error) {
+	switch p := ExtensionPolicy(strings.ToLower(name)); p {
+	case ExtensionsIgnore, ExtensionsCopy, ExtensionsFilter, ExtensionsReject:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown extension policy %s, must be one of: ignore, copy, filter, reject", name)
+}
+
+// Apply applies the requested extensions to opts, whose usages and constraints are already set,
+// usually by a Profile
+func (p ExtensionPolicy) Apply(opts *CertificateOptions, req RequestedExtensions) error {
+	switch p {
+	case ExtensionsCopy:
+		if req.KeyUsage != 0 {
+			opts.KeyUsage = req.KeyUsage
+		}
+		if len(req.ExtKeyUsage) > 0 || len(req.UnknownExtKeyUsage) > 0 {
+			opts.ExtKeyUsage, opts.UnknownExtKeyUsage = req.ExtKeyUsage, req.UnknownExtKeyUsage
+		}
+		if req.BasicConstraints {
+			opts.IsCA = req.IsCA
+			opts.MaxPathLen, opts.MaxPathLenZero = req.MaxPathLen, req.MaxPathLen == 0
+		}
+	case ExtensionsFilter:
+		// a usage the profile leaves unrestricted may be narrowed to what is requested, but a
+		// restricted one must never become empty, which would mean any usage at all
+		if req.KeyUsage != 0 {
+			switch {
+			case opts.KeyUsage == 0:
+				opts.KeyUsage = req.KeyUsage
+			case opts.KeyUsage&req.KeyUsage == 0:
+				return fmt.Errorf("CSR requests key usage %s, none of which the profile allows", strings.Join(KeyUsageStrings(req.KeyUsage), ", "))
+			default:
+				opts.KeyUsage &= req.KeyUsage
+			}
+		}
+		if len(req.ExtKeyUsage) > 0 || len(req.UnknownExtKeyUsage) > 0 {
+			if len(opts.ExtKeyUsage) == 0 && len(opts.UnknownExtKeyUsage) == 0 {
+				opts.ExtKeyUsage, opts.UnknownExtKeyUsage = req.ExtKeyUsage, req.UnknownExtKeyUsage
+			} else {
+				var allowed []x509.ExtKeyUsage
+				for _, u := range req.ExtKeyUsage {
+					if allowsExtKeyUsage(opts.ExtKeyUsage, u) {
+						allowed = append(allowed, u)
+					}
+				}
+				if len(allowed) == 0 {
+					return fmt.Errorf("CSR requests extended key usage %s, none of which the profile allows", strings.Join(ExtKeyUsageStrings(req.ExtKeyUsage, req.UnknownExtKeyUsage), ", "))
+				}
+				opts.ExtKeyUsage, opts.UnknownExtKeyUsage = allowed, nil
+			}
+		}
+		if req.BasicConstraints {
+			opts.IsCA = opts.IsCA && req.IsCA
+			if !opts.IsCA {
+				opts.MaxPathLen, opts.MaxPathLenZero = 0, false
+			} else if req.MaxPathLen >= 0 && (!hasPathLen(opts.MaxPathLen, opts.MaxPathLenZero) || req.MaxPathLen < opts.MaxPathLen) {
+				opts.MaxPathLen, opts.MaxPathLenZero = req.MaxPathLen, req.MaxPathLen == 0
+			}
+		}
+	case ExtensionsReject:
+		var denied []string
+		for _, u := range KeyUsageNames {
+			if req.KeyUsage&u.Usage != 0 && opts.KeyUsage&u.Usage == 0 {
+				denied = append(denied, "key usage "+u.Name)
+			}
+		}
+		for _, u := range req.ExtKeyUsage {
+			if !allowsExtKeyUsage(opts.ExtKeyUsage, u) {
+				denied = append(denied, "extended key usage "+ExtKeyUsageNames[u])
+			}
+		}
+		for _, oid := range req.UnknownExtKeyUsage {
+			denied = append(denied, "extended key usage "+oid.String())
+		}
+		if req.IsCA && !opts.IsCA {
+			denied = append(denied, "CA basic constraints")
+		}
+		if len(denied) > 0 {
+			return fmt.Errorf("CSR requests extensions not allowed by the profile: %s", strings.Join(denied, ", "))
+		}
+	}
+	return nil
+}
+
+// allowsExtKeyUsage reports whether usages include u, or any usage
+func allowsExtKeyUsage(usages []x509.ExtKeyUsage, u x509.ExtKeyUsage) bool {
+	for _, allowed := range usages {
+		if allowed == u || allowed == x509.ExtKeyUsageAny {
+			return true
+		}
+	}
+	return false
+}
+
+// hasPathLen reports whether MaxPathLen and MaxPathLenZero limit the path length
+func hasPathLen(maxPathLen int, zero bool) bool {
+	return maxPathLen > 0 || (maxPathLen == 0 && zero)
+}
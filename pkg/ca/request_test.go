@@ -0,0 +1,108 @@
+package ca
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// requestWithExtensions creates a CSR asking for the key usage bits and extended key usage OIDs
+func requestWithExtensions(t *testing.T, usage asn1.BitString, ekus []asn1.ObjectIdentifier) *x509.CertificateRequest {
+	t.Helper()
+	key, err := GenerateKey(KeyOptions{Type: ECDSA})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var extensions []pkix.Extension
+	if usage.BitLength > 0 {
+		extensions = append(extensions, pkix.Extension{Id: oidExtensionKeyUsage, Critical: true, Value: mustMarshal(usage)})
+	}
+	if len(ekus) > 0 {
+		extensions = append(extensions, pkix.Extension{Id: oidExtensionExtKeyUsage, Value: mustMarshal(ekus)})
+	}
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{Subject: pkix.Name{CommonName: "test"}, ExtraExtensions: extensions}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return csr
+}
+
+func TestExtensionsFilter(t *testing.T) {
+	var (
+		// key usage bits are numbered from the most significant bit of the first byte
+		keyAgreement            = asn1.BitString{Bytes: []byte{0x08}, BitLength: 5}
+		digitalSignatureAndKeyE = asn1.BitString{Bytes: []byte{0xa0}, BitLength: 3}
+		oidServerAuth           = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 1}
+		oidClientAuth           = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 2}
+		oidCustom               = asn1.ObjectIdentifier{1, 2, 3, 4}
+	)
+	server := builtinProfiles["server"]
+	tests := []struct {
+		name        string
+		profile     Profile
+		usage       asn1.BitString
+		ekus        []asn1.ObjectIdentifier
+		keyUsage    x509.KeyUsage
+		extKeyUsage []x509.ExtKeyUsage
+		unknown     []asn1.ObjectIdentifier
+		err         string
+	}{
+		{"nothing requested", server, asn1.BitString{}, nil, x509.KeyUsageDigitalSignature, []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}, nil, ""},
+		{"narrowed", builtinProfiles["peer"], digitalSignatureAndKeyE, []asn1.ObjectIdentifier{oidClientAuth, oidCustom},
+			x509.KeyUsageDigitalSignature, []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}, nil, ""},
+		{"key usage outside the profile", server, keyAgreement, nil, 0, nil, nil, "key usage KeyAgreement, none of which"},
+		{"only unknown extended key usage", server, asn1.BitString{}, []asn1.ObjectIdentifier{oidCustom}, 0, nil, nil, "extended key usage 1.2.3.4, none of which"},
+		{"extended key usage outside the profile", server, asn1.BitString{}, []asn1.ObjectIdentifier{oidClientAuth}, 0, nil, nil, "extended key usage ClientAuth, none of which"},
+		{"both outside the profile", server, keyAgreement, []asn1.ObjectIdentifier{oidCustom}, 0, nil, nil, "none of which the profile allows"},
+		{"unrestricted profile", Profile{}, keyAgreement, []asn1.ObjectIdentifier{oidServerAuth, oidCustom},
+			x509.KeyUsageKeyAgreement, []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}, []asn1.ObjectIdentifier{oidCustom}, ""},
+	}
+	for _, tt := range tests {
+		csr := requestWithExtensions(t, tt.usage, tt.ekus)
+		req, err := ParseRequestedExtensions(csr)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		var opts CertificateOptions
+		tt.profile.Apply(&opts, csr.PublicKey)
+		err = ExtensionsFilter.Apply(&opts, req)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: error %v, expected %q; key usage %v, extended key usage %v", tt.name, err, tt.err, KeyUsageStrings(opts.KeyUsage), opts.ExtKeyUsage)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+			continue
+		}
+		if opts.KeyUsage != tt.keyUsage {
+			t.Errorf("%s: key usage %v, expected %v", tt.name, KeyUsageStrings(opts.KeyUsage), KeyUsageStrings(tt.keyUsage))
+		}
+		if !reflect.DeepEqual(opts.ExtKeyUsage, tt.extKeyUsage) || !reflect.DeepEqual(opts.UnknownExtKeyUsage, tt.unknown) {
+			t.Errorf("%s: extended key usage %v %v, expected %v %v", tt.name, opts.ExtKeyUsage, opts.UnknownExtKeyUsage, tt.extKeyUsage, tt.unknown)
+		}
+	}
+}
+
+func TestExtensionsReject(t *testing.T) {
+	csr := requestWithExtensions(t, asn1.BitString{Bytes: []byte{0x08}, BitLength: 5}, []asn1.ObjectIdentifier{{1, 2, 3, 4}})
+	req, err := ParseRequestedExtensions(csr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var opts CertificateOptions
+	builtinProfiles["server"].Apply(&opts, csr.PublicKey)
+	err = ExtensionsReject.Apply(&opts, req)
+	if err == nil || !strings.Contains(err.Error(), "key usage KeyAgreement, extended key usage 1.2.3.4") {
+		t.Errorf("error %v", err)
+	}
+}
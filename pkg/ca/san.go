@@ -0,0 +1,337 @@
+package ca
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+var (
+	oidExtensionSubjectAltName = asn1.ObjectIdentifier{2, 5, 29, 17}
+	// oidUPN is the Microsoft User Principal Name otherName
+	oidUPN = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 20, 2, 3}
+)
+
+// GeneralName tags, RFC 5280 4.2.1.6
+const (
+	tagOtherName  = 0
+	tagRFC822Name = 1
+	tagDNSName    = 2
+	tagURI        = 6
+	tagIPAddress  = 7
+)
+
+// SANs are the subject alternative names of a certificate or certificate request
+type SANs struct {
+	DNSNames       []string
+	IPAddresses    []net.IP
+	EmailAddresses []string
+	URIs           []*url.URL
+	// UPNs are Microsoft User Principal Names, encoded as otherName
+	UPNs []string
+}
+
+// ParseSANs parses subject alternative names, each typed as one of DNS:<name>, IP:<address>,
+// email:<address>, URI:<uri> or UPN:<user@domain>. Untyped names are IP addresses if they parse as
+// one, and DNS names otherwise. Internationalized domain names are converted to punycode, and
+// malformed DNS names are rejected.
+func ParseSANs(names []string) (*SANs, error) {
+	var sans SANs
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if err := sans.add(name); err != nil {
+			return nil, err
+		}
+	}
+	return &sans, nil
+}
+
+func (s *SANs) add(name string) error {
+	typ, value := "", name
+	if i := strings.Index(name, ":"); i > 0 {
+		switch t := strings.ToLower(name[:i]); t {
+		case "dns", "ip", "email", "uri", "upn":
+			typ, value = t, name[i+1:]
+		}
+	}
+	if typ == "" {
+		typ = "dns"
+		if net.ParseIP(name) != nil {
+			typ = "ip"
+		}
+	}
+	switch typ {
+	case "dns":
+		dns, err := NormalizeHostname(value)
+		if err != nil {
+			return err
+		}
+		s.DNSNames = append(s.DNSNames, dns)
+	case "ip":
+		ip := net.ParseIP(value)
+		if ip == nil {
+			return fmt.Errorf("invalid IP address SAN: %s", value)
+		}
+		s.IPAddresses = append(s.IPAddresses, ip)
+	case "email":
+		email, err := normalizeEmail(value)
+		if err != nil {
+			return err
+		}
+		s.EmailAddresses = append(s.EmailAddresses, email)
+	case "uri":
+		u, err := url.Parse(value)
+		if err != nil {
+			return fmt.Errorf("invalid URI SAN %s: %v", value, err)
+		}
+		if u.Scheme == "" || (u.Host == "" && u.Opaque == "") {
+			return fmt.Errorf("invalid URI SAN %s: must be absolute", value)
+		}
+		s.URIs = append(s.URIs, u)
+	case "upn":
+		if strings.Count(value, "@") != 1 || strings.HasPrefix(value, "@") || strings.HasSuffix(value, "@") {
+			return fmt.Errorf("invalid UPN SAN %s: must be user@domain", value)
+		}
+		s.UPNs = append(s.UPNs, value)
+	}
+	return nil
+}
+
+// Strings returns each of the names typed as they are parsed by ParseSANs, e.g. DNS:www.foo.com
+func (s SANs) Strings() []string {
+	var ret []string
+	for _, name := range s.DNSNames {
+		ret = append(ret, "DNS:"+name)
+	}
+	for _, ip := range s.IPAddresses {
+		ret = append(ret, "IP:"+ip.String())
+	}
+	for _, email := range s.EmailAddresses {
+		ret = append(ret, "email:"+email)
+	}
+	for _, u := range s.URIs {
+		ret = append(ret, "URI:"+u.String())
+	}
+	for _, upn := range s.UPNs {
+		ret = append(ret, "UPN:"+upn)
+	}
+	return ret
+}
+
+// Merge adds the names in other that are not already in s
+func (s *SANs) Merge(other SANs) {
+	have := map[string]bool{}
+	for _, name := range s.Strings() {
+		have[name] = true
+	}
+	for _, name := range other.DNSNames {
+		if !have["DNS:"+name] {
+			s.DNSNames = append(s.DNSNames, name)
+		}
+	}
+	for _, ip := range other.IPAddresses {
+		if !have["IP:"+ip.String()] {
+			s.IPAddresses = append(s.IPAddresses, ip)
+		}
+	}
+	for _, email := range other.EmailAddresses {
+		if !have["email:"+email] {
+			s.EmailAddresses = append(s.EmailAddresses, email)
+		}
+	}
+	for _, u := range other.URIs {
+		if !have["URI:"+u.String()] {
+			s.URIs = append(s.URIs, u)
+		}
+	}
+	for _, upn := range other.UPNs {
+		if !have["UPN:"+upn] {
+			s.UPNs = append(s.UPNs, upn)
+		}
+	}
+}
+
+// NormalizeHostname converts an internationalized hostname to punycode and checks that it is a
+// valid DNS name. A leading '*.' wildcard label is allowed.
+func NormalizeHostname(name string) (string, error) {
+	host := name
+	wildcard := strings.HasPrefix(host, "*.")
+	if wildcard {
+		host = host[2:]
+	}
+	ascii, err := idna.Lookup.ToASCII(host)
+	if err != nil {
+		return "", fmt.Errorf("invalid DNS name %s: %v", name, err)
+	}
+	if len(ascii) > 253 {
+		return "", fmt.Errorf("invalid DNS name %s: longer than 253 characters", name)
+	}
+	for _, label := range strings.Split(ascii, ".") {
+		if err := checkLabel(label); err != nil {
+			return "", fmt.Errorf("invalid DNS name %s: %v", name, err)
+		}
+	}
+	if wildcard {
+		ascii = "*." + ascii
+	}
+	return ascii, nil
+}
+
+func checkLabel(label string) error {
+	if len(label) == 0 || len(label) > 63 {
+		return fmt.Errorf("label %q must be 1 to 63 characters", label)
+	}
+	if label[0] == '-' || label[len(label)-1] == '-' {
+		return fmt.Errorf("label %q must not start or end with '-'", label)
+	}
+	for _, c := range label {
+		if !(('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9') || c == '-') {
+			return fmt.Errorf("label %q contains invalid character %q", label, c)
+		}
+	}
+	return nil
+}
+
+// normalizeEmail checks an email address, converting an internationalized domain to punycode
+func normalizeEmail(email string) (string, error) {
+	at := strings.LastIndex(email, "@")
+	if at <= 0 {
+		return "", fmt.Errorf("invalid email SAN %s: must be user@domain", email)
+	}
+	local := email[:at]
+	for _, c := range local {
+		if c > 127 || c <= ' ' {
+			return "", fmt.Errorf("invalid email SAN %s: local part must be ASCII", email)
+		}
+	}
+	domain, err := NormalizeHostname(email[at+1:])
+	if err != nil {
+		return "", fmt.Errorf("invalid email SAN %s: %v", email, err)
+	}
+	return local + "@" + domain, nil
+}
+
+// apply sets the SANs on a certificate or request template's fields. Since x509 cannot encode
+// otherNames, if there are any UPNs the whole extension is built here and added to extensions instead.
+func (s SANs) apply(dns *[]string, ips *[]net.IP, emails *[]string, uris *[]*url.URL, extensions *[]pkix.Extension, subjectEmpty bool) {
+	if len(s.UPNs) == 0 {
+		*dns, *ips, *emails, *uris = s.DNSNames, s.IPAddresses, s.EmailAddresses, s.URIs
+		return
+	}
+	// RFC 5280 4.2.1.6: the extension is critical when the subject is empty
+	*extensions = append(*extensions, pkix.Extension{Id: oidExtensionSubjectAltName, Critical: subjectEmpty, Value: s.marshal()})
+}
+
+// marshal DER-encodes the SANs as GeneralNames
+func (s SANs) marshal() []byte {
+	var names []asn1.RawValue
+	for _, name := range s.DNSNames {
+		names = append(names, asn1.RawValue{Tag: tagDNSName, Class: asn1.ClassContextSpecific, Bytes: []byte(name)})
+	}
+	for _, email := range s.EmailAddresses {
+		names = append(names, asn1.RawValue{Tag: tagRFC822Name, Class: asn1.ClassContextSpecific, Bytes: []byte(email)})
+	}
+	for _, u := range s.URIs {
+		names = append(names, asn1.RawValue{Tag: tagURI, Class: asn1.ClassContextSpecific, Bytes: []byte(u.String())})
+	}
+	for _, ip := range s.IPAddresses {
+		b := ip.To4()
+		if b == nil {
+			b = ip
+		}
+		names = append(names, asn1.RawValue{Tag: tagIPAddress, Class: asn1.ClassContextSpecific, Bytes: b})
+	}
+	for _, upn := range s.UPNs {
+		// otherName is [0] { type-id, [0] EXPLICIT UTF8String }
+		value := mustMarshal(asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true,
+			Bytes: mustMarshal(asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagUTF8String, Bytes: []byte(upn)})})
+		names = append(names, asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: tagOtherName, IsCompound: true,
+			Bytes: append(mustMarshal(oidUPN), value...)})
+	}
+	return mustMarshal(names)
+}
+
+// mustMarshal marshals values that cannot fail to encode
+func mustMarshal(v interface{}) []byte {
+	b, err := asn1.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// isEmptySubject reports whether a certificate or request will have an empty subject
+func isEmptySubject(name pkix.Name, raw []byte) bool {
+	if len(raw) > 0 {
+		var rdns pkix.RDNSequence
+		_, err := asn1.Unmarshal(raw, &rdns)
+		return err == nil && len(rdns) == 0
+	}
+	return len(name.ToRDNSequence()) == 0
+}
+
+// UPNsFromExtensions returns the UPN otherNames in the subject alternative names extension, which
+// x509 does not parse
+func UPNsFromExtensions(extensions []pkix.Extension) ([]string, error) {
+	var upns []string
+	for _, ext := range extensions {
+		if !ext.Id.Equal(oidExtensionSubjectAltName) {
+			continue
+		}
+		var names []asn1.RawValue
+		if _, err := asn1.Unmarshal(ext.Value, &names); err != nil {
+			return nil, fmt.Errorf("invalid subject alternative names: %v", err)
+		}
+		for _, name := range names {
+			if name.Class != asn1.ClassContextSpecific || name.Tag != tagOtherName {
+				continue
+			}
+			var typeID asn1.ObjectIdentifier
+			rest, err := asn1.Unmarshal(name.Bytes, &typeID)
+			if err != nil {
+				return nil, fmt.Errorf("invalid otherName: %v", err)
+			}
+			if !typeID.Equal(oidUPN) {
+				continue
+			}
+			var value asn1.RawValue
+			if _, err := asn1.Unmarshal(rest, &value); err != nil || value.Class != asn1.ClassContextSpecific || value.Tag != 0 {
+				return nil, errors.New("invalid UPN otherName")
+			}
+			var upn string
+			if _, err := asn1.Unmarshal(value.Bytes, &upn); err != nil {
+				return nil, errors.New("invalid UPN otherName")
+			}
+			upns = append(upns, upn)
+		}
+	}
+	return upns, nil
+}
+
+// SANsFromCertificate returns all of the subject alternative names of a certificate
+func SANsFromCertificate(cert *x509.Certificate) (*SANs, error) {
+	upns, err := UPNsFromExtensions(cert.Extensions)
+	if err != nil {
+		return nil, err
+	}
+	return &SANs{DNSNames: cert.DNSNames, IPAddresses: cert.IPAddresses, EmailAddresses: cert.EmailAddresses, URIs: cert.URIs, UPNs: upns}, nil
+}
+
+// SANsFromCSR returns all of the subject alternative names requested in a certificate request
+func SANsFromCSR(csr *x509.CertificateRequest) (*SANs, error) {
+	upns, err := UPNsFromExtensions(csr.Extensions)
+	if err != nil {
+		return nil, err
+	}
+	return &SANs{DNSNames: csr.DNSNames, IPAddresses: csr.IPAddresses, EmailAddresses: csr.EmailAddresses, URIs: csr.URIs, UPNs: upns}, nil
+}
@@ -0,0 +1,112 @@
+package ca
+
+import (
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestParseSANs(t *testing.T) {
+	tests := []struct {
+		names    []string
+		expected string
+		err      string
+	}{
+		{[]string{"www.example.com", "10.0.0.1", "::1"}, "DNS:www.example.com IP:10.0.0.1 IP:::1", ""},
+		{[]string{"DNS:a.example", "ip:192.168.1.1", "EMAIL:me@example.com", "URI:spiffe://example.com/svc", "UPN:me@example.com"},
+			"DNS:a.example IP:192.168.1.1 email:me@example.com URI:spiffe://example.com/svc UPN:me@example.com", ""},
+		{[]string{" ", "", "DNS:*.example.com"}, "DNS:*.example.com", ""},
+		// IDNA
+		{[]string{"café.example"}, "DNS:xn--caf-dma.example", ""},
+		{[]string{"DNS:*.bücher.de"}, "DNS:*.xn--bcher-kva.de", ""},
+		{[]string{"DNS:WWW.Example.COM"}, "DNS:www.example.com", ""},
+		{[]string{"email:user@bücher.de"}, "email:user@xn--bcher-kva.de", ""},
+		{[]string{"DNS:-bad.example"}, "", "invalid DNS name -bad.example"},
+		{[]string{"DNS:a..example"}, "", "invalid DNS name"},
+		{[]string{"DNS:" + strings.Repeat("a", 64) + ".example"}, "", "must be 1 to 63 characters"},
+		{[]string{"DNS:under_score.example"}, "", "invalid DNS name"},
+		{[]string{"IP:1.2.3"}, "", "invalid IP address SAN"},
+		{[]string{"email:nobody"}, "", "must be user@domain"},
+		{[]string{"email:ü@example.com"}, "", "local part must be ASCII"},
+		{[]string{"URI:relative/path"}, "", "must be absolute"},
+		{[]string{"UPN:nodomain"}, "", "must be user@domain"},
+		{[]string{"UPN:@example.com"}, "", "must be user@domain"},
+		{[]string{"UPN:a@b@c"}, "", "must be user@domain"},
+	}
+	for _, tt := range tests {
+		sans, err := ParseSANs(tt.names)
+		switch {
+		case tt.err != "":
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%v: error %v, expected %q", tt.names, err, tt.err)
+			}
+		case err != nil:
+			t.Errorf("%v: unexpected error %v", tt.names, err)
+		case strings.Join(sans.Strings(), " ") != tt.expected:
+			t.Errorf("%v: parsed as %v, expected %s", tt.names, sans.Strings(), tt.expected)
+		}
+	}
+}
+
+func TestNormalizeHostname(t *testing.T) {
+	tests := map[string]string{
+		"example.com":    "example.com",
+		"Example.COM":    "example.com",
+		"münchen.de":     "xn--mnchen-3ya.de",
+		"xn--caf-dma.fr": "xn--caf-dma.fr",
+		"*.日本.jp":        "*.xn--wgv71a.jp",
+		"a.b.c.d.e":      "a.b.c.d.e",
+	}
+	for name, expected := range tests {
+		ascii, err := NormalizeHostname(name)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+		} else if ascii != expected {
+			t.Errorf("%s: normalized to %s, expected %s", name, ascii, expected)
+		}
+	}
+	for _, name := range []string{"", "a.*.example", "foo bar.com", strings.Repeat("a.", 127) + "com"} {
+		if ascii, err := NormalizeHostname(name); err == nil {
+			t.Errorf("%q: accepted as %s", name, ascii)
+		}
+	}
+}
+
+// the subjectAltName extension values produced by openssl req -addext
+// "subjectAltName=otherName:1.3.6.1.4.1.311.20.2.3;UTF8:user@example.com[,DNS:xn--caf-dma.example]"
+const (
+	opensslUPNSAN       = "3022a020060a2b060104018237140203a0120c1075736572406578616d706c652e636f6d"
+	opensslUPNAndDNSSAN = "3037a020060a2b060104018237140203a0120c1075736572406578616d706c652e636f6d" +
+		"8213786e2d2d6361662d646d612e6578616d706c65"
+)
+
+func TestUPNEncoding(t *testing.T) {
+	sans, err := ParseSANs([]string{"UPN:user@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if encoded := hex.EncodeToString(sans.marshal()); encoded != opensslUPNSAN {
+		t.Errorf("UPN encoded as %s, expected %s", encoded, opensslUPNSAN)
+	}
+
+	for _, vector := range []string{opensslUPNSAN, opensslUPNAndDNSSAN} {
+		value, _ := hex.DecodeString(vector)
+		upns, err := UPNsFromExtensions([]pkix.Extension{{Id: oidExtensionSubjectAltName, Value: value}})
+		if err != nil {
+			t.Errorf("%s: %v", vector, err)
+		} else if len(upns) != 1 || upns[0] != "user@example.com" {
+			t.Errorf("%s: UPNs %v", vector, upns)
+		}
+	}
+
+	// otherNames of other types are skipped, and a UPN that is not a UTF8String is rejected
+	other, _ := hex.DecodeString("3010a00e06032a0304a0070c0576616c7565")
+	if upns, err := UPNsFromExtensions([]pkix.Extension{{Id: oidExtensionSubjectAltName, Value: other}}); err != nil || len(upns) != 0 {
+		t.Errorf("otherName of another type: %v %v", upns, err)
+	}
+	bad, _ := hex.DecodeString("3018a016060a2b060104018237140203a008020601020304050a")
+	if _, err := UPNsFromExtensions([]pkix.Extension{{Id: oidExtensionSubjectAltName, Value: bad}}); err == nil {
+		t.Error("UPN encoded as an INTEGER was accepted")
+	}
+}
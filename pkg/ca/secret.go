@@ -0,0 +1,108 @@
+package ca
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// SecretSourcePrompt is the secret source that prompts for the secret, which ReadSecret leaves to the
+// caller
+const SecretSourcePrompt = "prompt"
+
+// secretFiles are the files opened for fd: sources. They are kept so that they are not garbage
+// collected, which would close the descriptors, as another secret may be read from the same one.
+var secretFiles = struct {
+	sync.Mutex
+	files map[int]*os.File
+}{files: map[int]*os.File{}}
+
+// ReadSecret reads a password or passphrase from source, in the format of OpenSSL's -passin and
+// -passout:
+//
+//   - pass:<secret>, the secret itself
+//   - env:<variable>, the value of an environment variable
+//   - file:<path>, the first line of a file
+//   - fd:<number>, the next line read from a file descriptor
+//   - stdin, the next line read from stdin
+//
+// Lines are read from fd: and stdin without reading ahead, so several secrets may be read from the
+// same one, a line each.
+//
+// Secrets should not be given with pass: in production, as they are visible in the shell history and
+// process list.
+func ReadSecret(source string) (string, error) {
+	kind, value := source, ""
+	if i := strings.Index(source, ":"); i >= 0 {
+		kind, value = source[:i], source[i+1:]
+	}
+	switch kind {
+	case "pass":
+		return value, nil
+	case "env":
+		secret, ok := os.LookupEnv(value)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", value)
+		}
+		return secret, nil
+	case "file":
+		f, err := os.Open(value)
+		if err != nil {
+			return "", fmt.Errorf("failed to open secret file: %v", err)
+		}
+		defer f.Close()
+		return readSecretLine(f)
+	case "fd":
+		fd, err := strconv.Atoi(value)
+		if err != nil || fd < 0 {
+			return "", fmt.Errorf("invalid file descriptor %s", value)
+		}
+		return readSecretLine(secretFile(fd))
+	case "stdin":
+		return readSecretLine(os.Stdin)
+	case SecretSourcePrompt:
+		return "", errors.New("the prompt secret source must be read by the caller")
+	}
+	return "", fmt.Errorf("invalid secret source %q, must be one of pass:<secret>, env:<variable>, file:<path>, fd:<number>, stdin or prompt", source)
+}
+
+// secretFile returns the file of descriptor fd, which is never closed, as the caller owns it
+func secretFile(fd int) *os.File {
+	secretFiles.Lock()
+	defer secretFiles.Unlock()
+	f, ok := secretFiles.files[fd]
+	if !ok {
+		f = os.NewFile(uintptr(fd), "fd:"+strconv.Itoa(fd))
+		secretFiles.files[fd] = f
+	}
+	return f
+}
+
+// readSecretLine reads the next line of r, without its line ending. It reads a byte at a time, so as
+// not to consume anything after the line.
+func readSecretLine(r io.Reader) (string, error) {
+	var (
+		line []byte
+		b    = make([]byte, 1)
+	)
+	for {
+		n, err := r.Read(b)
+		if n == 1 {
+			if b[0] == '\n' {
+				break
+			}
+			line = append(line, b[0])
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to read secret: %v", err)
+		}
+	}
+	return strings.TrimRight(string(line), "\r"), nil
+}
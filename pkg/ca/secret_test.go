@@ -0,0 +1,81 @@
+package ca
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestReadSecret(t *testing.T) {
+	t.Setenv("CA_TEST_SECRET", "from env")
+	file := filepath.Join(t.TempDir(), "secret.txt")
+	if err := ioutil.WriteFile(file, []byte("from file\r\nsecond line\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	empty := filepath.Join(t.TempDir(), "empty.txt")
+	if err := ioutil.WriteFile(empty, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		source string
+		secret string
+		err    bool
+	}{
+		{source: "pass:secret", secret: "secret"},
+		{source: "pass:with:colon", secret: "with:colon"},
+		{source: "pass:", secret: ""},
+		{source: "env:CA_TEST_SECRET", secret: "from env"},
+		{source: "env:CA_TEST_UNSET", err: true},
+		{source: "file:" + file, secret: "from file"},
+		{source: "file:" + empty, secret: ""},
+		{source: "file:" + filepath.Join(t.TempDir(), "missing"), err: true},
+		{source: "fd:x", err: true},
+		{source: "fd:-1", err: true},
+		{source: "prompt", err: true},
+		{source: "secret", err: true},
+		{source: "other:secret", err: true},
+	}
+	for _, tt := range tests {
+		secret, err := ReadSecret(tt.source)
+		if tt.err {
+			if err == nil {
+				t.Errorf("%s: expected an error, got %q", tt.source, secret)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.source, err)
+			continue
+		}
+		if secret != tt.secret {
+			t.Errorf("%s: got %q, expected %q", tt.source, secret, tt.secret)
+		}
+	}
+}
+
+func TestReadSecretFD(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if _, err := w.WriteString("first\nsecond\r\nlast"); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	// each secret read from the same descriptor is its next line, as with -passin and -passout
+	source := "fd:" + strconv.Itoa(int(r.Fd()))
+	for _, expected := range []string{"first", "second", "last", ""} {
+		secret, err := ReadSecret(source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if secret != expected {
+			t.Errorf("got %q, expected %q", secret, expected)
+		}
+	}
+}
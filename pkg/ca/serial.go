@@ -0,0 +1,24 @@
+package ca
+
+import (
+	"crypto/rand"
+	"math/big"
+)
+
+// serialBits is the size of random serial numbers; RFC 5280 allows at most 20 octets, and the CA/Browser Forum
+// requires at least 64 bits of randomness
+const serialBits = 128
+
+// RandomSerial returns a random, positive certificate serial number
+func RandomSerial() (*big.Int, error) {
+	limit := new(big.Int).Lsh(big.NewInt(1), serialBits)
+	for {
+		serial, err := rand.Int(rand.Reader, limit)
+		if err != nil {
+			return nil, err
+		}
+		if serial.Sign() > 0 {
+			return serial, nil
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package ca
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+	"strings"
+)
+
+// signatureAlgorithms are the signature algorithms certificates and CSRs can be signed with, by the name of
+// their x509 constant
+var signatureAlgorithms = []struct {
+	name string
+	alg  x509.SignatureAlgorithm
+}{
+	{"SHA256WithRSA", x509.SHA256WithRSA},
+	{"SHA384WithRSA", x509.SHA384WithRSA},
+	{"SHA512WithRSA", x509.SHA512WithRSA},
+	{"SHA256WithRSAPSS", x509.SHA256WithRSAPSS},
+	{"SHA384WithRSAPSS", x509.SHA384WithRSAPSS},
+	{"SHA512WithRSAPSS", x509.SHA512WithRSAPSS},
+	{"ECDSAWithSHA256", x509.ECDSAWithSHA256},
+	{"ECDSAWithSHA384", x509.ECDSAWithSHA384},
+	{"ECDSAWithSHA512", x509.ECDSAWithSHA512},
+	{"PureEd25519", x509.PureEd25519},
+}
+
+// SignatureAlgorithmNames returns the names of the supported signature algorithms
+func SignatureAlgorithmNames() []string {
+	var names []string
+	for _, s := range signatureAlgorithms {
+		names = append(names, s.name)
+	}
+	return names
+}
+
+// ParseSignatureAlgorithm converts a signature algorithm name into an x509.SignatureAlgorithm. The name is
+// either that of the x509 constant, e.g. SHA384WithRSA or ECDSAWithSHA512, or as it is printed, e.g.
+// SHA384-RSAPSS or Ed25519, in any case.
+func ParseSignatureAlgorithm(name string) (x509.SignatureAlgorithm, error) {
+	normalized := normalizeSignatureAlgorithm(name)
+	for _, s := range signatureAlgorithms {
+		if normalized == normalizeSignatureAlgorithm(s.name) || normalized == normalizeSignatureAlgorithm(s.alg.String()) {
+			return s.alg, nil
+		}
+	}
+	return x509.UnknownSignatureAlgorithm, fmt.Errorf("unknown signature algorithm %s, must be one of: %s", name, strings.Join(SignatureAlgorithmNames(), ", "))
+}
+
+func normalizeSignatureAlgorithm(name string) string {
+	name = strings.ToLower(name)
+	for _, s := range []string{"-", "_", "with"} {
+		name = strings.ReplaceAll(name, s, "")
+	}
+	return name
+}
+
+// CheckSignatureAlgorithm returns an error if a key pair with the public key pub cannot sign with alg.
+// The unknown algorithm, which leaves the choice to the key, is compatible with every key.
+func CheckSignatureAlgorithm(alg x509.SignatureAlgorithm, pub crypto.PublicKey) error {
+	var ok bool
+	switch alg {
+	case x509.UnknownSignatureAlgorithm:
+		return nil
+	case x509.SHA256WithRSA, x509.SHA384WithRSA, x509.SHA512WithRSA, x509.SHA256WithRSAPSS, x509.SHA384WithRSAPSS, x509.SHA512WithRSAPSS:
+		_, ok = pub.(*rsa.PublicKey)
+	case x509.ECDSAWithSHA256, x509.ECDSAWithSHA384, x509.ECDSAWithSHA512:
+		_, ok = pub.(*ecdsa.PublicKey)
+	case x509.PureEd25519:
+		_, ok = pub.(ed25519.PublicKey)
+	default:
+		return fmt.Errorf("unsupported signature algorithm %s", alg)
+	}
+	if !ok {
+		return fmt.Errorf("signature algorithm %s cannot be used with an %s key", alg, DescribePublicKey(pub).Algorithm)
+	}
+	return nil
+}
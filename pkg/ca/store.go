@@ -0,0 +1,235 @@
+package ca
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// files and directories inside a CA store
+const (
+	StoreKeyFile    = "ca.key"
+	StoreCertFile   = "ca.crt"
+	StoreConfigFile = "config.json"
+	StoreSerialFile = "serial"
+	StoreIndexFile  = "index.json"
+	StoreCertsDir   = "certs"
+)
+
+// SerialPolicy is how a CA store assigns serial numbers to the certificates it issues
+type SerialPolicy string
+
+const (
+	// SerialSequential assigns serial numbers from a counter, starting at 1
+	SerialSequential SerialPolicy = "sequential"
+	// SerialRandom assigns random 128-bit serial numbers
+	SerialRandom SerialPolicy = "random"
+)
+
+// ParseSerialPolicy converts a serial policy name into a SerialPolicy
+func ParseSerialPolicy(name string) (SerialPolicy, error) {
+	switch p := SerialPolicy(name); p {
+	case SerialSequential, SerialRandom:
+		return p, nil
+	default:
+		return "", fmt.Errorf("unknown serial policy: %s", name)
+	}
+}
+
+// StoreConfig is the configuration of a CA store, saved in its config file
+type StoreConfig struct {
+	SerialPolicy SerialPolicy `json:"serialPolicy"`
+}
+
+// Store is a CA kept in a directory, along with its configuration, serial number counter and
+// the index of every certificate it issued
+type Store struct {
+	Dir    string
+	Config StoreConfig
+	CA     *CA
+}
+
+// InitStore creates a new CA store in dir, whose CA is a self-signed certificate created
+// from template and key. dir must not already contain a CA store. If enc is not nil, the key
+// is saved encrypted with its passphrase.
+func InitStore(dir string, config StoreConfig, template *x509.Certificate, key crypto.Signer, enc *KeyEncryption) (*Store, error) {
+	if config.SerialPolicy == "" {
+		config.SerialPolicy = SerialSequential
+	}
+	if _, err := ParseSerialPolicy(string(config.SerialPolicy)); err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(filepath.Join(dir, StoreConfigFile)); err == nil {
+		return nil, fmt.Errorf("CA store already exists in %s", dir)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, StoreCertsDir), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create CA store directory %s: %v", dir, err)
+	}
+	s := &Store{Dir: dir, Config: config}
+	b, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := writeFileAtomic(s.path(StoreConfigFile), b, 0600); err != nil {
+		return nil, err
+	}
+	if err := s.writeSerial(big.NewInt(1)); err != nil {
+		return nil, err
+	}
+	if err := s.Index().write([]IndexEntry{}); err != nil {
+		return nil, err
+	}
+	if template.SerialNumber, err = s.NextSerial(); err != nil {
+		return nil, err
+	}
+	cert, err := SelfSign(template, key)
+	if err != nil {
+		return nil, err
+	}
+	var keyPEM, certPEM bytes.Buffer
+	if enc != nil {
+		err = WriteEncryptedPrivateKey(&keyPEM, key, *enc)
+	} else {
+		err = WritePrivateKey(&keyPEM, key)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := WriteCertificates(&certPEM, cert); err != nil {
+		return nil, err
+	}
+	if err := writeFileAtomic(s.path(StoreKeyFile), keyPEM.Bytes(), 0600); err != nil {
+		return nil, err
+	}
+	if err := writeFileAtomic(s.path(StoreCertFile), certPEM.Bytes(), 0644); err != nil {
+		return nil, err
+	}
+	// the CA certificate is the first in the index, so it can be looked up and revoked like any other
+	if err := s.Record(cert); err != nil {
+		return nil, err
+	}
+	s.CA = &CA{Certificate: cert, Key: key}
+	return s, nil
+}
+
+// OpenStore opens the existing CA store in dir. If its key is encrypted, the passphrase is asked of
+// password, which may be nil otherwise.
+func OpenStore(dir string, password PasswordFunc) (*Store, error) {
+	s := &Store{Dir: dir}
+	b, err := os.ReadFile(s.path(StoreConfigFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA store config: %v", err)
+	}
+	if err := json.Unmarshal(b, &s.Config); err != nil {
+		return nil, fmt.Errorf("invalid CA store config %s: %v", s.path(StoreConfigFile), err)
+	}
+	if _, err := ParseSerialPolicy(string(s.Config.SerialPolicy)); err != nil {
+		return nil, err
+	}
+	if s.CA, err = LoadCA(s.path(StoreCertFile), s.path(StoreKeyFile), password); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// NextSerial returns a new serial number according to the store's serial policy. For a
+// sequential policy, the counter is advanced under a lock, so the serial is never handed out
+// again, even to another process signing with the same store.
+func (s *Store) NextSerial() (*big.Int, error) {
+	if s.Config.SerialPolicy == SerialRandom {
+		return RandomSerial()
+	}
+	unlock, err := lockFile(s.path(StoreSerialFile))
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	b, err := os.ReadFile(s.path(StoreSerialFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read serial file: %v", err)
+	}
+	serial, ok := new(big.Int).SetString(strings.TrimSpace(string(b)), 16)
+	if !ok {
+		return nil, fmt.Errorf("invalid serial in %s", s.path(StoreSerialFile))
+	}
+	if err := s.writeSerial(new(big.Int).Add(serial, big.NewInt(1))); err != nil {
+		return nil, err
+	}
+	return serial, nil
+}
+
+// Index returns the index of every certificate issued by the store
+func (s *Store) Index() Index {
+	return Index{Path: s.path(StoreIndexFile)}
+}
+
+// Sign signs template with the store's CA, assigning it a unique serial number and
+// recording it in the index
+func (s *Store) Sign(template *x509.Certificate, pub crypto.PublicKey) (*x509.Certificate, error) {
+	serial, err := s.NextSerial()
+	if err != nil {
+		return nil, err
+	}
+	template.SerialNumber = serial
+	cert, err := s.CA.Sign(template, pub)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Record(cert); err != nil {
+		return nil, err
+	}
+	return cert, nil
+}
+
+// Record adds an issued certificate to the index, and saves a copy of it in the store. It fails
+// if the index already has a certificate with the same serial number.
+func (s *Store) Record(cert *x509.Certificate) error {
+	serial := SerialString(cert.SerialNumber)
+	if err := s.Index().Add(IndexEntry{
+		Serial:    serial,
+		Subject:   cert.Subject.String(),
+		NotBefore: cert.NotBefore,
+		NotAfter:  cert.NotAfter,
+		IssuedAt:  time.Now().UTC(),
+	}); err != nil {
+		return err
+	}
+	var certPEM bytes.Buffer
+	if err := WriteCertificates(&certPEM, cert); err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(s.Dir, StoreCertsDir, serial+".pem"), certPEM.Bytes(), 0644)
+}
+
+// SerialString formats a serial number the way the store records it, as upper-case hex
+func SerialString(serial *big.Int) string {
+	return strings.ToUpper(serial.Text(16))
+}
+
+func (s *Store) path(name string) string {
+	return filepath.Join(s.Dir, name)
+}
+
+func (s *Store) writeSerial(serial *big.Int) error {
+	return writeFileAtomic(s.path(StoreSerialFile), []byte(SerialString(serial)+"\n"), 0600)
+}
+
+// writeFileAtomic writes to a temporary file and renames it into place, so a failure
+// never leaves a partially-written file behind
+func writeFileAtomic(path string, b []byte, perm os.FileMode) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, perm); err != nil {
+		return fmt.Errorf("failed to write %s: %v", path, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write %s: %v", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package ca
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// newTestStore creates a CA store with an ECDSA key in a temporary directory
+func newTestStore(t *testing.T) *Store {
+	t.Helper()
+	key, err := GenerateKey(KeyOptions{Type: ECDSA})
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := CertificateOptions{Subject: pkix.Name{CommonName: "test CA"}, Days: 1, IsCA: true, KeyUsage: x509.KeyUsageCertSign | x509.KeyUsageCRLSign}.Template()
+	store, err := InitStore(t.TempDir(), StoreConfig{}, template, key, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func TestStoreConcurrentSign(t *testing.T) {
+	dir := newTestStore(t).Dir
+	key, err := GenerateKey(KeyOptions{Type: ECDSA})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const n = 20
+	serials := make(chan string, n)
+	errs := make(chan error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// each signer opens its own store, as separate processes would
+			store, err := OpenStore(dir, nil)
+			if err != nil {
+				errs <- err
+				return
+			}
+			leaf := CertificateOptions{Subject: pkix.Name{CommonName: fmt.Sprintf("leaf %d", i)}, Days: 1}.Template()
+			cert, err := store.Sign(leaf, key.Public())
+			if err != nil {
+				errs <- err
+				return
+			}
+			serials <- SerialString(cert.SerialNumber)
+		}(i)
+	}
+	wg.Wait()
+	close(serials)
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+	seen := map[string]bool{}
+	for s := range serials {
+		if seen[s] {
+			t.Errorf("serial %s issued twice", s)
+		}
+		seen[s] = true
+	}
+
+	store, err := OpenStore(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := store.Index().Entries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != n+1 {
+		t.Fatalf("index has %d entries, expected %d", len(entries), n+1)
+	}
+	if entries[0].Serial != "1" || entries[0].Subject != "CN=test CA" {
+		t.Errorf("first index entry is %s %s, expected the CA certificate", entries[0].Serial, entries[0].Subject)
+	}
+}
@@ -0,0 +1,481 @@
+package ca
+
+import (
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// StringEncoding is how the string values of a distinguished name are encoded
+type StringEncoding int
+
+const (
+	// EncodingDefault uses PrintableString when the value allows it, else UTF8String
+	EncodingDefault StringEncoding = iota
+	// EncodingUTF8 always uses UTF8String
+	EncodingUTF8
+	// EncodingPrintable always uses PrintableString, and rejects values it cannot represent
+	EncodingPrintable
+)
+
+// ParseStringEncoding converts an encoding name, one of default, utf8, printable, into a StringEncoding
+func ParseStringEncoding(name string) (StringEncoding, error) {
+	switch name {
+	case "", "default":
+		return EncodingDefault, nil
+	case "utf8":
+		return EncodingUTF8, nil
+	case "printable":
+		return EncodingPrintable, nil
+	default:
+		return 0, fmt.Errorf("unknown string encoding: %s", name)
+	}
+}
+
+var (
+	oidCommonName          = asn1.ObjectIdentifier{2, 5, 4, 3}
+	oidSurname             = asn1.ObjectIdentifier{2, 5, 4, 4}
+	oidSerialNumber        = asn1.ObjectIdentifier{2, 5, 4, 5}
+	oidCountry             = asn1.ObjectIdentifier{2, 5, 4, 6}
+	oidLocality            = asn1.ObjectIdentifier{2, 5, 4, 7}
+	oidProvince            = asn1.ObjectIdentifier{2, 5, 4, 8}
+	oidStreetAddress       = asn1.ObjectIdentifier{2, 5, 4, 9}
+	oidOrganization        = asn1.ObjectIdentifier{2, 5, 4, 10}
+	oidOrganizationalUnit  = asn1.ObjectIdentifier{2, 5, 4, 11}
+	oidTitle               = asn1.ObjectIdentifier{2, 5, 4, 12}
+	oidBusinessCategory    = asn1.ObjectIdentifier{2, 5, 4, 15}
+	oidPostalCode          = asn1.ObjectIdentifier{2, 5, 4, 17}
+	oidGivenName           = asn1.ObjectIdentifier{2, 5, 4, 42}
+	oidInitials            = asn1.ObjectIdentifier{2, 5, 4, 43}
+	oidGenerationQualifier = asn1.ObjectIdentifier{2, 5, 4, 44}
+	oidDNQualifier         = asn1.ObjectIdentifier{2, 5, 4, 46}
+	oidPseudonym           = asn1.ObjectIdentifier{2, 5, 4, 65}
+	oidUserID              = asn1.ObjectIdentifier{0, 9, 2342, 19200300, 100, 1, 1}
+	oidDomainComponent     = asn1.ObjectIdentifier{0, 9, 2342, 19200300, 100, 1, 25}
+	oidEmailAddress        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 1}
+)
+
+// attributeTypes are the attribute keywords understood in distinguished names, upper-case
+var attributeTypes = map[string]asn1.ObjectIdentifier{
+	"CN":                  oidCommonName,
+	"COMMONNAME":          oidCommonName,
+	"SN":                  oidSurname,
+	"SURNAME":             oidSurname,
+	"SERIALNUMBER":        oidSerialNumber,
+	"C":                   oidCountry,
+	"COUNTRYNAME":         oidCountry,
+	"L":                   oidLocality,
+	"LOCALITYNAME":        oidLocality,
+	"ST":                  oidProvince,
+	"STATEORPROVINCENAME": oidProvince,
+	"STREET":              oidStreetAddress,
+	"STREETADDRESS":       oidStreetAddress,
+	"O":                   oidOrganization,
+	"ORGANIZATIONNAME":    oidOrganization,
+	"OU":                  oidOrganizationalUnit,
+	"ORGANIZATIONALUNIT":  oidOrganizationalUnit,
+	"TITLE":               oidTitle,
+	"BUSINESSCATEGORY":    oidBusinessCategory,
+	"POSTALCODE":          oidPostalCode,
+	"GN":                  oidGivenName,
+	"GIVENNAME":           oidGivenName,
+	"INITIALS":            oidInitials,
+	"GENERATIONQUALIFIER": oidGenerationQualifier,
+	"DNQUALIFIER":         oidDNQualifier,
+	"PSEUDONYM":           oidPseudonym,
+	"UID":                 oidUserID,
+	"USERID":              oidUserID,
+	"DC":                  oidDomainComponent,
+	"DOMAINCOMPONENT":     oidDomainComponent,
+	"E":                   oidEmailAddress,
+	"EMAIL":               oidEmailAddress,
+	"EMAILADDRESS":        oidEmailAddress,
+}
+
+// ParseDN parses a distinguished name into its RDNs, most significant first. It accepts either
+// the RFC 4514 form, e.g. 'CN=server.myorg.com,O=My Org,ST=NY,C=US', whose most significant RDN is
+// last, or the OpenSSL form starting with '/', e.g. '/C=US/ST=NY/O=My Org/CN=server.myorg.com',
+// whose most significant RDN is first. Both support multi-valued RDNs joined with '+', repeated
+// attributes, escaping with '\' (including '\' followed by two hex digits), hex-encoded BER values
+// written '#...', and attribute types given by keyword or as dotted OIDs. Values are returned as
+// strings, or as asn1.RawValue when hex-encoded. Hex-encoded values of the attributes that pkix.Name
+// has a field for must be of a string type.
+func ParseDN(s string) (pkix.RDNSequence, error) {
+	p := dnParser{s: s, separators: ",;"}
+	rfc4514 := true
+	if strings.HasPrefix(s, "/") {
+		p = dnParser{s: s[1:], separators: "/"}
+		rfc4514 = false
+	}
+	rdns := make(pkix.RDNSequence, 0)
+	if strings.TrimSpace(p.s) == "" {
+		return rdns, nil
+	}
+	for {
+		rdn, err := p.parseRDN()
+		if err != nil {
+			return nil, err
+		}
+		rdns = append(rdns, rdn)
+		if p.done() {
+			break
+		}
+		// parseRDN only stops at the end or at a separator
+		p.pos++
+	}
+	if rfc4514 {
+		for i, j := 0, len(rdns)-1; i < j; i, j = i+1, j-1 {
+			rdns[i], rdns[j] = rdns[j], rdns[i]
+		}
+	}
+	return rdns, nil
+}
+
+// ParseSubject parses a distinguished name, in either of the forms accepted by ParseDN, into a
+// pkix.Name. Attributes that pkix.Name has no field for are kept in ExtraNames. pkix.Name cannot
+// represent the order or multi-valued RDNs of the original; use ParseDN and MarshalDN to keep them.
+func ParseSubject(subject string) (*pkix.Name, error) {
+	rdns, err := ParseDN(subject)
+	if err != nil {
+		return nil, err
+	}
+	name := RDNsToName(rdns)
+	return &name, nil
+}
+
+// RDNsToName converts RDNs into a pkix.Name, keeping attributes that pkix.Name has no field for
+// in ExtraNames. Hex-encoded string values are decoded, as pkix.Name only keeps strings.
+func RDNsToName(rdns pkix.RDNSequence) pkix.Name {
+	decoded := make(pkix.RDNSequence, 0, len(rdns))
+	for _, rdn := range rdns {
+		set := make(pkix.RelativeDistinguishedNameSET, 0, len(rdn))
+		for _, atv := range rdn {
+			if raw, ok := atv.Value.(asn1.RawValue); ok {
+				if value, ok := rawStringValue(raw); ok {
+					atv.Value = value
+				}
+			}
+			set = append(set, atv)
+		}
+		decoded = append(decoded, set)
+	}
+	var name pkix.Name
+	name.FillFromRDNSequence(&decoded)
+	for _, rdn := range rdns {
+		for _, atv := range rdn {
+			if !isNameField(atv.Type) {
+				name.ExtraNames = append(name.ExtraNames, atv)
+			}
+		}
+	}
+	return name
+}
+
+// rawStringValue returns a hex-encoded attribute value as a string, if it is of an ASN.1 string type
+func rawStringValue(raw asn1.RawValue) (string, bool) {
+	var value string
+	if raw.Class != asn1.ClassUniversal {
+		return "", false
+	}
+	if _, err := asn1.Unmarshal(raw.FullBytes, &value); err != nil {
+		return "", false
+	}
+	return value, true
+}
+
+// isNameField reports whether pkix.Name has a field for the attribute type
+func isNameField(t asn1.ObjectIdentifier) bool {
+	for _, oid := range []asn1.ObjectIdentifier{oidCommonName, oidSerialNumber, oidCountry, oidLocality, oidProvince,
+		oidStreetAddress, oidOrganization, oidOrganizationalUnit, oidPostalCode} {
+		if t.Equal(oid) {
+			return true
+		}
+	}
+	return false
+}
+
+// MarshalDN DER-encodes the RDNs, e.g. for use as x509.Certificate.RawSubject, encoding string values
+// with enc. Regardless of enc, countryName, serialNumber and dnQualifier are always PrintableString,
+// and emailAddress and domainComponent are always IA5String, as RFC 5280 requires.
+func MarshalDN(rdns pkix.RDNSequence, enc StringEncoding) ([]byte, error) {
+	encoded := make(pkix.RDNSequence, 0, len(rdns))
+	for _, rdn := range rdns {
+		set := make([]pkix.AttributeTypeAndValue, 0, len(rdn))
+		for _, atv := range rdn {
+			value, ok := atv.Value.(string)
+			if !ok {
+				set = append(set, atv)
+				continue
+			}
+			raw, err := encodeAttributeValue(atv.Type, value, enc)
+			if err != nil {
+				return nil, err
+			}
+			set = append(set, pkix.AttributeTypeAndValue{Type: atv.Type, Value: raw})
+		}
+		encoded = append(encoded, set)
+	}
+	return asn1.Marshal(encoded)
+}
+
+func encodeAttributeValue(t asn1.ObjectIdentifier, value string, enc StringEncoding) (asn1.RawValue, error) {
+	tag := asn1.TagUTF8String
+	switch {
+	case t.Equal(oidCountry) || t.Equal(oidSerialNumber) || t.Equal(oidDNQualifier):
+		tag = asn1.TagPrintableString
+	case t.Equal(oidEmailAddress) || t.Equal(oidDomainComponent):
+		tag = asn1.TagIA5String
+	case enc == EncodingPrintable:
+		tag = asn1.TagPrintableString
+	case enc == EncodingDefault && isPrintable(value):
+		tag = asn1.TagPrintableString
+	}
+	switch tag {
+	case asn1.TagPrintableString:
+		if !isPrintable(value) {
+			return asn1.RawValue{}, fmt.Errorf("value %q of %v cannot be encoded as PrintableString", value, t)
+		}
+	case asn1.TagIA5String:
+		for _, r := range value {
+			if r > 127 {
+				return asn1.RawValue{}, fmt.Errorf("value %q of %v cannot be encoded as IA5String", value, t)
+			}
+		}
+	}
+	return asn1.RawValue{Class: asn1.ClassUniversal, Tag: tag, Bytes: []byte(value)}, nil
+}
+
+// isPrintable reports whether s contains only the characters allowed in an ASN.1 PrintableString
+func isPrintable(s string) bool {
+	for _, r := range s {
+		switch {
+		case 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z', '0' <= r && r <= '9':
+		case strings.ContainsRune(" '()+,-./:=?", r):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// dnParser is a cursor over a distinguished name string
+type dnParser struct {
+	s          string
+	pos        int
+	separators string
+}
+
+func (p *dnParser) done() bool {
+	return p.pos >= len(p.s)
+}
+
+func (p *dnParser) peek() byte {
+	return p.s[p.pos]
+}
+
+func (p *dnParser) skipSpaces() {
+	for !p.done() && p.peek() == ' ' {
+		p.pos++
+	}
+}
+
+// atEnd reports whether the cursor is at the end of an attribute value
+func (p *dnParser) atEnd() bool {
+	return p.done() || p.peek() == '+' || strings.IndexByte(p.separators, p.peek()) >= 0
+}
+
+// parseRDN parses one RDN, which may have several attributes joined by '+'
+func (p *dnParser) parseRDN() (pkix.RelativeDistinguishedNameSET, error) {
+	var rdn pkix.RelativeDistinguishedNameSET
+	for {
+		atv, err := p.parseAttribute()
+		if err != nil {
+			return nil, err
+		}
+		rdn = append(rdn, atv)
+		if p.done() || p.peek() != '+' {
+			return rdn, nil
+		}
+		p.pos++
+	}
+}
+
+func (p *dnParser) parseAttribute() (pkix.AttributeTypeAndValue, error) {
+	var atv pkix.AttributeTypeAndValue
+	eq := strings.IndexByte(p.s[p.pos:], '=')
+	if eq < 0 {
+		return atv, fmt.Errorf("invalid RDN, missing '=': %s", p.s[p.pos:])
+	}
+	typeName := strings.TrimSpace(p.s[p.pos : p.pos+eq])
+	t, err := parseAttributeType(typeName)
+	if err != nil {
+		return atv, err
+	}
+	atv.Type = t
+	p.pos += eq + 1
+	p.skipSpaces()
+
+	switch {
+	case !p.done() && p.peek() == '#':
+		var raw asn1.RawValue
+		if raw, err = p.parseHexValue(); err == nil && isNameField(t) {
+			// pkix.Name has a string field for the attribute, which could not hold any other type
+			if _, ok := rawStringValue(raw); !ok {
+				err = errors.New("hex value must be of a string type")
+			}
+		}
+		atv.Value = raw
+	case !p.done() && p.peek() == '"':
+		atv.Value, err = p.parseQuotedValue()
+	default:
+		atv.Value, err = p.parseStringValue()
+	}
+	if err != nil {
+		return atv, fmt.Errorf("invalid value for %s: %v", typeName, err)
+	}
+	return atv, nil
+}
+
+// parseAttributeType converts a keyword, dotted OID, or OID.-prefixed dotted OID into an OID
+func parseAttributeType(name string) (asn1.ObjectIdentifier, error) {
+	if oid, ok := attributeTypes[strings.ToUpper(name)]; ok {
+		return oid, nil
+	}
+	dotted := name
+	if len(dotted) > 4 && strings.EqualFold(dotted[:4], "OID.") {
+		dotted = dotted[4:]
+	}
+	if dotted == "" || !strings.Contains(dotted, ".") {
+		return nil, fmt.Errorf("unknown RDN attribute type: %s", name)
+	}
+	var oid asn1.ObjectIdentifier
+	for _, part := range strings.Split(dotted, ".") {
+		var n int
+		if part == "" || len(part) > 9 {
+			return nil, fmt.Errorf("invalid OID attribute type: %s", name)
+		}
+		for _, c := range part {
+			if c < '0' || c > '9' {
+				return nil, fmt.Errorf("unknown RDN attribute type: %s", name)
+			}
+			n = n*10 + int(c-'0')
+		}
+		oid = append(oid, n)
+	}
+	return oid, nil
+}
+
+// parseHexValue parses '#' followed by the hex of a BER-encoded value
+func (p *dnParser) parseHexValue() (asn1.RawValue, error) {
+	var raw asn1.RawValue
+	p.pos++
+	start := p.pos
+	for !p.atEnd() && p.peek() != ' ' {
+		p.pos++
+	}
+	b, err := hex.DecodeString(p.s[start:p.pos])
+	if err != nil {
+		return raw, err
+	}
+	p.skipSpaces()
+	if !p.atEnd() {
+		return raw, errors.New("unexpected characters after hex value")
+	}
+	rest, err := asn1.Unmarshal(b, &raw)
+	if err != nil {
+		return raw, err
+	}
+	if len(rest) > 0 {
+		return raw, errors.New("trailing data after hex value")
+	}
+	return raw, nil
+}
+
+// parseQuotedValue parses a value in double quotes, as allowed by RFC 2253 and earlier
+func (p *dnParser) parseQuotedValue() (string, error) {
+	p.pos++
+	var value []byte
+	for {
+		if p.done() {
+			return "", errors.New("missing closing quote")
+		}
+		c := p.peek()
+		switch c {
+		case '"':
+			p.pos++
+			p.skipSpaces()
+			if !p.atEnd() {
+				return "", errors.New("unexpected characters after quoted value")
+			}
+			return validUTF8(value)
+		case '\\':
+			b, err := p.parseEscape()
+			if err != nil {
+				return "", err
+			}
+			value = append(value, b)
+		default:
+			value = append(value, c)
+			p.pos++
+		}
+	}
+}
+
+// parseStringValue parses an unquoted value up to the next unescaped separator or '+', dropping
+// unescaped leading and trailing spaces
+func (p *dnParser) parseStringValue() (string, error) {
+	var (
+		value []byte
+		// keep is the length of value up to its last character that is not an unescaped space
+		keep int
+	)
+	for !p.atEnd() {
+		c := p.peek()
+		if c == '\\' {
+			b, err := p.parseEscape()
+			if err != nil {
+				return "", err
+			}
+			value = append(value, b)
+			keep = len(value)
+			continue
+		}
+		value = append(value, c)
+		if c != ' ' {
+			keep = len(value)
+		}
+		p.pos++
+	}
+	return validUTF8(value[:keep])
+}
+
+// parseEscape parses '\' followed by either a character or two hex digits
+func (p *dnParser) parseEscape() (byte, error) {
+	p.pos++
+	if p.done() {
+		return 0, errors.New("value ends with '\\'")
+	}
+	if p.pos+1 < len(p.s) && isHexDigit(p.s[p.pos]) && isHexDigit(p.s[p.pos+1]) {
+		b, _ := hex.DecodeString(p.s[p.pos : p.pos+2])
+		p.pos += 2
+		return b[0], nil
+	}
+	c := p.peek()
+	p.pos++
+	return c, nil
+}
+
+func isHexDigit(c byte) bool {
+	return ('0' <= c && c <= '9') || ('a' <= c && c <= 'f') || ('A' <= c && c <= 'F')
+}
+
+func validUTF8(b []byte) (string, error) {
+	if !utf8.Valid(b) {
+		return "", errors.New("not valid UTF-8")
+	}
+	return string(b), nil
+}
@@ -0,0 +1,179 @@
+package ca
+
+import (
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// formatRDNs renders RDNs most significant first, as 'oid=value' with '+' between the attributes of an
+// RDN and '/' between RDNs; hex-encoded values are shown as '#tag:value'
+func formatRDNs(rdns pkix.RDNSequence) string {
+	parts := make([]string, 0, len(rdns))
+	for _, rdn := range rdns {
+		atvs := make([]string, 0, len(rdn))
+		for _, atv := range rdn {
+			switch v := atv.Value.(type) {
+			case asn1.RawValue:
+				atvs = append(atvs, fmt.Sprintf("%v=#%d:%s", atv.Type, v.Tag, v.Bytes))
+			default:
+				atvs = append(atvs, fmt.Sprintf("%v=%v", atv.Type, v))
+			}
+		}
+		parts = append(parts, strings.Join(atvs, "+"))
+	}
+	return strings.Join(parts, "/")
+}
+
+func TestParseDN(t *testing.T) {
+	tests := []struct {
+		dn       string
+		expected string
+		err      string
+	}{
+		// RFC 4514 lists the most significant RDN last, OpenSSL first
+		{"CN=server,O=My Org,C=US", "2.5.4.6=US/2.5.4.10=My Org/2.5.4.3=server", ""},
+		{"/C=US/O=My Org/CN=server", "2.5.4.6=US/2.5.4.10=My Org/2.5.4.3=server", ""},
+		{"CN=server;O=My Org", "2.5.4.10=My Org/2.5.4.3=server", ""},
+		{" CN = server , O = My Org ", "2.5.4.10=My Org/2.5.4.3=server", ""},
+		{"", "", ""},
+		{"/", "", ""},
+		// multi-valued RDNs and repeated attributes
+		{"CN=server+UID=42,OU=a,OU=b", "2.5.4.11=b/2.5.4.11=a/2.5.4.3=server+0.9.2342.19200300.100.1.1=42", ""},
+		{"/OU=a+OU=b/CN=x", "2.5.4.11=a+2.5.4.11=b/2.5.4.3=x", ""},
+		// escapes
+		{`CN=a\,b\+c\;d`, "2.5.4.3=a,b+c;d", ""},
+		{`CN=\ padded\ `, "2.5.4.3= padded ", ""},
+		{`CN=caf\C3\A9`, "2.5.4.3=café", ""},
+		{`CN=back\\slash`, `2.5.4.3=back\slash`, ""},
+		{`/O=a\/b/CN=c`, "2.5.4.10=a/b/2.5.4.3=c", ""},
+		{`CN="quoted, value"`, "2.5.4.3=quoted, value", ""},
+		// hex-encoded BER values: UTF8String "hello"
+		{"CN=#0c0568656c6c6f", "2.5.4.3=#12:hello", ""},
+		{"CN=#0C0568656C6C6F,O=x", "2.5.4.10=x/2.5.4.3=#12:hello", ""},
+		{"1.2.3.4=#020105", "1.2.3.4=#2:\x05", ""},
+		// attribute types
+		{"1.2.3.4=custom,cn=lower", "2.5.4.3=lower/1.2.3.4=custom", ""},
+		{"OID.2.5.4.3=byoid", "2.5.4.3=byoid", ""},
+		{"emailAddress=a@b.com,DC=example", "0.9.2342.19200300.100.1.25=example/1.2.840.113549.1.9.1=a@b.com", ""},
+		// malformed
+		{`CN=trailing\`, "", "value ends with '\\'"},
+		{"CN=#0c056", "", "odd length hex string"},
+		{"CN=#0c0568656c6c6f00", "", "trailing data after hex value"},
+		{"CN=#zz", "", "invalid byte"},
+		{"CN=#020105", "", "must be of a string type"},
+		{"O=#0403616263", "", "must be of a string type"},
+		{"=value", "", "unknown RDN attribute type"},
+		{"CN=a,=b", "", "unknown RDN attribute type"},
+		{"XX=value", "", "unknown RDN attribute type: XX"},
+		{"1..2=value", "", "invalid OID attribute type"},
+		{"CN=a,O", "", "missing '='"},
+		{`CN="unterminated`, "", "missing closing quote"},
+		{`CN=\FF`, "", "not valid UTF-8"},
+	}
+	for _, tt := range tests {
+		rdns, err := ParseDN(tt.dn)
+		switch {
+		case tt.err != "":
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%q: error %v, expected %q", tt.dn, err, tt.err)
+			}
+		case err != nil:
+			t.Errorf("%q: unexpected error %v", tt.dn, err)
+		case formatRDNs(rdns) != tt.expected:
+			t.Errorf("%q: parsed as %s, expected %s", tt.dn, formatRDNs(rdns), tt.expected)
+		}
+	}
+}
+
+func TestRDNsToName(t *testing.T) {
+	tests := []struct {
+		dn    string
+		check func(pkix.Name) bool
+	}{
+		{"CN=server,O=My Org,OU=a,OU=b,C=US", func(n pkix.Name) bool {
+			return n.CommonName == "server" && fmt.Sprint(n.Organization, n.OrganizationalUnit, n.Country) == "[My Org] [b a] [US]"
+		}},
+		// hex-encoded strings are decoded: UTF8String "hello", PrintableString "Org" and IA5String "ou"
+		{"CN=#0c0568656c6c6f,O=#13034f7267,OU=#16026f75", func(n pkix.Name) bool {
+			return n.CommonName == "hello" && fmt.Sprint(n.Organization, n.OrganizationalUnit) == "[Org] [ou]"
+		}},
+		// attributes without a field are kept as they are
+		{"CN=x,1.2.3.4=#020105", func(n pkix.Name) bool {
+			return n.CommonName == "x" && len(n.ExtraNames) == 1 && n.ExtraNames[0].Type.String() == "1.2.3.4"
+		}},
+	}
+	for _, tt := range tests {
+		rdns, err := ParseDN(tt.dn)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.dn, err)
+		}
+		if name := RDNsToName(rdns); !tt.check(name) {
+			t.Errorf("%s: got %+v", tt.dn, name)
+		}
+	}
+}
+
+// rawRDNSET is an RDN whose values are kept encoded; the asn1 package decodes types named ...SET as a SET
+type rawRDNSET []struct {
+	Type  asn1.ObjectIdentifier
+	Value asn1.RawValue
+}
+
+func TestMarshalDN(t *testing.T) {
+	tests := []struct {
+		dn   string
+		enc  StringEncoding
+		tags []int
+		err  string
+	}{
+		{"/C=US/O=My Org/CN=server", EncodingDefault, []int{asn1.TagPrintableString, asn1.TagPrintableString, asn1.TagPrintableString}, ""},
+		{"/C=US/O=My Org/CN=server", EncodingUTF8, []int{asn1.TagPrintableString, asn1.TagUTF8String, asn1.TagUTF8String}, ""},
+		{"/O=café/CN=a_b", EncodingDefault, []int{asn1.TagUTF8String, asn1.TagUTF8String}, ""},
+		{"/DC=com/emailAddress=a@b.com", EncodingUTF8, []int{asn1.TagIA5String, asn1.TagIA5String}, ""},
+		{"/CN=#0c0568656c6c6f", EncodingPrintable, []int{asn1.TagUTF8String}, ""},
+		{"/CN=a_b", EncodingPrintable, nil, "cannot be encoded as PrintableString"},
+		{"/emailAddress=café@b.com", EncodingDefault, nil, "cannot be encoded as IA5String"},
+	}
+	for _, tt := range tests {
+		rdns, err := ParseDN(tt.dn)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.dn, err)
+		}
+		der, err := MarshalDN(rdns, tt.enc)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: error %v, expected %q", tt.dn, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", tt.dn, err)
+			continue
+		}
+		var decoded []rawRDNSET
+		if _, err := asn1.Unmarshal(der, &decoded); err != nil {
+			t.Fatalf("%s: %v", tt.dn, err)
+		}
+		var tags []int
+		for _, rdn := range decoded {
+			for _, atv := range rdn {
+				tags = append(tags, atv.Value.Tag)
+			}
+		}
+		if fmt.Sprint(tags) != fmt.Sprint(tt.tags) {
+			t.Errorf("%s: encoded with tags %v, expected %v", tt.dn, tags, tt.tags)
+		}
+
+		// the order is kept, and the values decode back to the same strings
+		var back pkix.RDNSequence
+		if _, err := asn1.Unmarshal(der, &back); err != nil {
+			t.Fatalf("%s: %v", tt.dn, err)
+		}
+		if formatRDNs(back) != formatRDNs(rdns) && !strings.Contains(tt.dn, "#") {
+			t.Errorf("%s: round trip gave %s, expected %s", tt.dn, formatRDNs(back), formatRDNs(rdns))
+		}
+	}
+}
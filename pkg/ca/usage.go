@@ -0,0 +1,130 @@
+package ca
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"fmt"
+	"strings"
+)
+
+// KeyUsageNames are the names of each key usage bit, in bit order
+var KeyUsageNames = []struct {
+	Usage x509.KeyUsage
+	Name  string
+}{
+	{x509.KeyUsageDigitalSignature, "DigitalSignature"},
+	{x509.KeyUsageContentCommitment, "ContentCommitment"},
+	{x509.KeyUsageKeyEncipherment, "KeyEncipherment"},
+	{x509.KeyUsageDataEncipherment, "DataEncipherment"},
+	{x509.KeyUsageKeyAgreement, "KeyAgreement"},
+	{x509.KeyUsageCertSign, "CertSign"},
+	{x509.KeyUsageCRLSign, "CRLSign"},
+	{x509.KeyUsageEncipherOnly, "EncipherOnly"},
+	{x509.KeyUsageDecipherOnly, "DecipherOnly"},
+}
+
+// ExtKeyUsageNames are the names of each extended key usage
+var ExtKeyUsageNames = map[x509.ExtKeyUsage]string{
+	x509.ExtKeyUsageAny:                            "Any",
+	x509.ExtKeyUsageServerAuth:                     "ServerAuth",
+	x509.ExtKeyUsageClientAuth:                     "ClientAuth",
+	x509.ExtKeyUsageCodeSigning:                    "CodeSigning",
+	x509.ExtKeyUsageEmailProtection:                "EmailProtection",
+	x509.ExtKeyUsageIPSECEndSystem:                 "IPSECEndSystem",
+	x509.ExtKeyUsageIPSECTunnel:                    "IPSECTunnel",
+	x509.ExtKeyUsageIPSECUser:                      "IPSECUser",
+	x509.ExtKeyUsageTimeStamping:                   "TimeStamping",
+	x509.ExtKeyUsageOCSPSigning:                    "OCSPSigning",
+	x509.ExtKeyUsageMicrosoftServerGatedCrypto:     "MicrosoftServerGatedCrypto",
+	x509.ExtKeyUsageNetscapeServerGatedCrypto:      "NetscapeServerGatedCrypto",
+	x509.ExtKeyUsageMicrosoftCommercialCodeSigning: "MicrosoftCommercialCodeSigning",
+	x509.ExtKeyUsageMicrosoftKernelCodeSigning:     "MicrosoftKernelCodeSigning",
+}
+
+// KeyUsageStrings returns the names of the key usage bits set in u
+func KeyUsageStrings(u x509.KeyUsage) []string {
+	names := make([]string, 0)
+	for _, ku := range KeyUsageNames {
+		if u&ku.Usage != 0 {
+			names = append(names, ku.Name)
+		}
+	}
+	return names
+}
+
+// ExtKeyUsageStrings returns the names of the extended key usages, followed by the object identifiers
+// of those x509 has no constant for
+func ExtKeyUsageStrings(usages []x509.ExtKeyUsage, unknown []asn1.ObjectIdentifier) []string {
+	names := make([]string, 0, len(usages)+len(unknown))
+	for _, u := range usages {
+		names = append(names, ExtKeyUsageNames[u])
+	}
+	for _, oid := range unknown {
+		names = append(names, oid.String())
+	}
+	return names
+}
+
+// extKeyUsageOIDs are the object identifiers of each extended key usage, RFC 5280 4.2.1.12
+var extKeyUsageOIDs = map[x509.ExtKeyUsage]asn1.ObjectIdentifier{
+	x509.ExtKeyUsageAny:                            {2, 5, 29, 37, 0},
+	x509.ExtKeyUsageServerAuth:                     {1, 3, 6, 1, 5, 5, 7, 3, 1},
+	x509.ExtKeyUsageClientAuth:                     {1, 3, 6, 1, 5, 5, 7, 3, 2},
+	x509.ExtKeyUsageCodeSigning:                    {1, 3, 6, 1, 5, 5, 7, 3, 3},
+	x509.ExtKeyUsageEmailProtection:                {1, 3, 6, 1, 5, 5, 7, 3, 4},
+	x509.ExtKeyUsageIPSECEndSystem:                 {1, 3, 6, 1, 5, 5, 7, 3, 5},
+	x509.ExtKeyUsageIPSECTunnel:                    {1, 3, 6, 1, 5, 5, 7, 3, 6},
+	x509.ExtKeyUsageIPSECUser:                      {1, 3, 6, 1, 5, 5, 7, 3, 7},
+	x509.ExtKeyUsageTimeStamping:                   {1, 3, 6, 1, 5, 5, 7, 3, 8},
+	x509.ExtKeyUsageOCSPSigning:                    {1, 3, 6, 1, 5, 5, 7, 3, 9},
+	x509.ExtKeyUsageMicrosoftServerGatedCrypto:     {1, 3, 6, 1, 4, 1, 311, 10, 3, 3},
+	x509.ExtKeyUsageNetscapeServerGatedCrypto:      {2, 16, 840, 1, 113730, 4, 1},
+	x509.ExtKeyUsageMicrosoftCommercialCodeSigning: {1, 3, 6, 1, 4, 1, 311, 2, 1, 22},
+	x509.ExtKeyUsageMicrosoftKernelCodeSigning:     {1, 3, 6, 1, 4, 1, 311, 61, 1, 1},
+}
+
+// extKeyUsageFromOID returns the extended key usage with the object identifier oid, if known
+func extKeyUsageFromOID(oid asn1.ObjectIdentifier) (x509.ExtKeyUsage, bool) {
+	for u, o := range extKeyUsageOIDs {
+		if o.Equal(oid) {
+			return u, true
+		}
+	}
+	return 0, false
+}
+
+// ParseKeyUsage converts key usage names, case-insensitive, into key usage bits
+func ParseKeyUsage(names []string) (x509.KeyUsage, error) {
+	var usage x509.KeyUsage
+	for _, name := range names {
+		var found bool
+		for _, u := range KeyUsageNames {
+			if strings.EqualFold(u.Name, name) {
+				usage |= u.Usage
+				found = true
+			}
+		}
+		if !found {
+			return 0, fmt.Errorf("unknown key usage: %s", name)
+		}
+	}
+	return usage, nil
+}
+
+// ParseExtKeyUsage converts extended key usage names, case-insensitive, into extended key usages
+func ParseExtKeyUsage(names []string) ([]x509.ExtKeyUsage, error) {
+	usages := make([]x509.ExtKeyUsage, 0, len(names))
+	for _, name := range names {
+		var found bool
+		for u, n := range ExtKeyUsageNames {
+			if strings.EqualFold(n, name) {
+				usages = append(usages, u)
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown extended key usage: %s", name)
+		}
+	}
+	return usages, nil
+}
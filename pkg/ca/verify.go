@@ -0,0 +1,209 @@
+package ca
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Purpose is what a certificate is verified to be used for
+type Purpose struct {
+	Name string
+	// ExtKeyUsage is the extended key usage the chain must allow
+	ExtKeyUsage x509.ExtKeyUsage
+	// KeyUsage are the key usages of which the leaf must have at least one, if it has key usage at all
+	KeyUsage x509.KeyUsage
+	// RSAKeyUsage are additional key usages allowed for RSA keys
+	RSAKeyUsage x509.KeyUsage
+}
+
+var purposes = map[string]Purpose{
+	"server":       {ExtKeyUsage: x509.ExtKeyUsageServerAuth, KeyUsage: x509.KeyUsageDigitalSignature | x509.KeyUsageKeyAgreement, RSAKeyUsage: x509.KeyUsageKeyEncipherment},
+	"client":       {ExtKeyUsage: x509.ExtKeyUsageClientAuth, KeyUsage: x509.KeyUsageDigitalSignature | x509.KeyUsageKeyAgreement},
+	"code-signing": {ExtKeyUsage: x509.ExtKeyUsageCodeSigning, KeyUsage: x509.KeyUsageDigitalSignature},
+	"email":        {ExtKeyUsage: x509.ExtKeyUsageEmailProtection, KeyUsage: x509.KeyUsageDigitalSignature | x509.KeyUsageContentCommitment | x509.KeyUsageKeyAgreement, RSAKeyUsage: x509.KeyUsageKeyEncipherment},
+	"ocsp-signing": {ExtKeyUsage: x509.ExtKeyUsageOCSPSigning, KeyUsage: x509.KeyUsageDigitalSignature},
+	"timestamping": {ExtKeyUsage: x509.ExtKeyUsageTimeStamping, KeyUsage: x509.KeyUsageDigitalSignature | x509.KeyUsageContentCommitment},
+	"any":          {ExtKeyUsage: x509.ExtKeyUsageAny},
+}
+
+// PurposeNames returns the names of the purposes, sorted
+func PurposeNames() []string {
+	names := make([]string, 0, len(purposes))
+	for name := range purposes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ParsePurpose returns the purpose with the given name
+func ParsePurpose(name string) (Purpose, error) {
+	p, ok := purposes[strings.ToLower(name)]
+	if !ok {
+		return Purpose{}, fmt.Errorf("unknown purpose %s, must be one of: %s", name, strings.Join(PurposeNames(), ", "))
+	}
+	p.Name = strings.ToLower(name)
+	return p, nil
+}
+
+// VerifyOptions describe how to verify a certificate
+type VerifyOptions struct {
+	// Roots are the trusted roots; if empty, the system roots are used
+	Roots         []*x509.Certificate
+	Intermediates []*x509.Certificate
+	// Host is the DNS name or IP address the certificate must be valid for, optional
+	Host    string
+	Purpose Purpose
+	// At is the time to verify at; if zero, now
+	At time.Time
+}
+
+// KeyUsageError is returned when a certificate's key usage does not allow its use in a chain
+type KeyUsageError struct {
+	Cert   *x509.Certificate
+	Detail string
+}
+
+func (e KeyUsageError) Error() string {
+	return fmt.Sprintf("x509: certificate %s has incompatible key usage: %s", e.Cert.Subject, e.Detail)
+}
+
+// Verify builds and validates the chains from cert to one of the roots, returning each valid chain,
+// leaf first. Beyond x509.Verify, it checks that each CA has key usage CertSign, and that the leaf's
+// key usage allows the purpose.
+func Verify(cert *x509.Certificate, opts VerifyOptions) ([][]*x509.Certificate, error) {
+	verifyOpts := x509.VerifyOptions{
+		DNSName:       opts.Host,
+		Intermediates: x509.NewCertPool(),
+		CurrentTime:   opts.At,
+		KeyUsages:     []x509.ExtKeyUsage{opts.Purpose.ExtKeyUsage},
+	}
+	if len(opts.Roots) > 0 {
+		verifyOpts.Roots = x509.NewCertPool()
+		for _, root := range opts.Roots {
+			verifyOpts.Roots.AddCert(root)
+		}
+	}
+	for _, intermediate := range opts.Intermediates {
+		verifyOpts.Intermediates.AddCert(intermediate)
+	}
+	chains, err := cert.Verify(verifyOpts)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		valid    [][]*x509.Certificate
+		usageErr error
+	)
+	for _, chain := range chains {
+		if err := checkChainKeyUsage(chain, opts.Purpose); err != nil {
+			usageErr = err
+			continue
+		}
+		valid = append(valid, chain)
+	}
+	if len(valid) == 0 {
+		return nil, usageErr
+	}
+	return valid, nil
+}
+
+func checkChainKeyUsage(chain []*x509.Certificate, purpose Purpose) error {
+	for _, c := range chain[1:] {
+		if c.KeyUsage != 0 && c.KeyUsage&x509.KeyUsageCertSign == 0 {
+			return KeyUsageError{Cert: c, Detail: "a CA without CertSign cannot issue certificates"}
+		}
+	}
+	leaf := chain[0]
+	allowed := purpose.KeyUsage
+	if _, ok := leaf.PublicKey.(*rsa.PublicKey); ok {
+		allowed |= purpose.RSAKeyUsage
+	}
+	if leaf.KeyUsage != 0 && allowed != 0 && leaf.KeyUsage&allowed == 0 {
+		return KeyUsageError{Cert: leaf, Detail: fmt.Sprintf("%s does not allow purpose %s, which needs one of %s",
+			strings.Join(KeyUsageStrings(leaf.KeyUsage), ","), purpose.Name, strings.Join(KeyUsageStrings(allowed), ","))}
+	}
+	return nil
+}
+
+const timeLayout = "2006-01-02 15:04:05 MST"
+
+// ExplainVerifyError describes why verification failed, from the error returned by Verify
+func ExplainVerifyError(err error, opts VerifyOptions) string {
+	var (
+		invalid  x509.CertificateInvalidError
+		unknown  x509.UnknownAuthorityError
+		hostname x509.HostnameError
+		usage    KeyUsageError
+		sysRoots x509.SystemRootsError
+		verifyAt = opts.At
+	)
+	if verifyAt.IsZero() {
+		verifyAt = time.Now()
+	}
+	switch {
+	case errors.As(err, &hostname):
+		sans, _ := SANsFromCertificate(hostname.Certificate)
+		names := "no DNS or IP SANs"
+		if sans != nil && len(sans.DNSNames)+len(sans.IPAddresses) > 0 {
+			names = strings.Join(append(append([]string{}, sans.DNSNames...), ipStrings(sans)...), ", ")
+		}
+		return fmt.Sprintf("hostname mismatch: certificate %s is valid for %s, not %s", hostname.Certificate.Subject, names, hostname.Host)
+	case errors.As(err, &unknown):
+		if unknown.Cert == nil {
+			return "unknown authority: " + unknown.Error()
+		}
+		if bytes.Equal(unknown.Cert.RawSubject, unknown.Cert.RawIssuer) {
+			return fmt.Sprintf("unknown authority: root %s is not trusted", unknown.Cert.Subject)
+		}
+		return fmt.Sprintf("unknown authority: certificate %s is issued by %s, which is not a trusted root, nor a given intermediate that chains to one", unknown.Cert.Subject, unknown.Cert.Issuer)
+	case errors.As(err, &usage):
+		return "incompatible key usage: " + usage.Error()
+	case errors.As(err, &sysRoots):
+		return "no trusted roots: " + sysRoots.Error()
+	case errors.As(err, &invalid):
+		c := invalid.Cert
+		switch invalid.Reason {
+		case x509.Expired:
+			return fmt.Sprintf("expired or not yet valid: certificate %s is valid from %s until %s, but verified at %s", c.Subject, c.NotBefore.Format(timeLayout), c.NotAfter.Format(timeLayout), verifyAt.UTC().Format(timeLayout))
+		case x509.IncompatibleUsage, x509.CANotAuthorizedForExtKeyUsage:
+			return fmt.Sprintf("extended key usage mismatch: no chain allows purpose %s; certificate %s allows %s", opts.Purpose.Name, c.Subject, extKeyUsageList(c))
+		case x509.CANotAuthorizedForThisName, x509.NameConstraintsWithoutSANs, x509.UnconstrainedName, x509.TooManyConstraints:
+			return fmt.Sprintf("name constraints: certificate %s violates the name constraints of its issuers: %s", c.Subject, invalid.Error())
+		case x509.NotAuthorizedToSign:
+			return fmt.Sprintf("not a CA: certificate %s issued another certificate, but is not a CA with key usage CertSign", c.Subject)
+		case x509.TooManyIntermediates:
+			return fmt.Sprintf("path length: certificate %s has path length %d, but is followed by more intermediate CAs", c.Subject, c.MaxPathLen)
+		}
+		return invalid.Error()
+	}
+	return err.Error()
+}
+
+func extKeyUsageList(c *x509.Certificate) string {
+	if len(c.ExtKeyUsage) == 0 && len(c.UnknownExtKeyUsage) == 0 {
+		return "no extended key usages"
+	}
+	var names []string
+	for _, u := range c.ExtKeyUsage {
+		names = append(names, ExtKeyUsageNames[u])
+	}
+	for _, oid := range c.UnknownExtKeyUsage {
+		names = append(names, oid.String())
+	}
+	return strings.Join(names, ",")
+}
+
+func ipStrings(sans *SANs) []string {
+	var ips []string
+	for _, ip := range sans.IPAddresses {
+		ips = append(ips, ip.String())
+	}
+	return ips
+}
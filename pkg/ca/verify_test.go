@@ -0,0 +1,111 @@
+package ca
+
+import (
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// issueTestCert signs a certificate for opts with issuer and its key, or self-signs it if issuer is nil,
+// without the path length checks of CA.Sign
+func issueTestCert(t *testing.T, opts CertificateOptions, issuer *x509.Certificate, issuerKey crypto.Signer) (*x509.Certificate, crypto.Signer) {
+	t.Helper()
+	key, err := GenerateKey(KeyOptions{Type: ECDSA})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.Days == 0 {
+		opts.Days = 1
+	}
+	template := opts.Template()
+	if err := ensureSerial(template); err != nil {
+		t.Fatal(err)
+	}
+	if issuer == nil {
+		issuer, issuerKey = template, key
+	}
+	cert, err := SignCertificate(template, issuer, key.Public(), issuerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+func TestExplainVerifyError(t *testing.T) {
+	store := newTestStore(t)
+	root, rootKey := store.CA.Certificate, store.CA.Key
+	roots := []*x509.Certificate{root}
+	server, err := ParsePurpose("server")
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverOpts := CertificateOptions{Subject: pkix.Name{CommonName: "server"}, SANs: SANs{DNSNames: []string{"www.example.com"}}, ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}}
+
+	leaf, _ := issueTestCert(t, serverOpts, root, rootKey)
+	client, _ := issueTestCert(t, CertificateOptions{Subject: pkix.Name{CommonName: "client"}, ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}, root, rootKey)
+	signOnly, _ := issueTestCert(t, CertificateOptions{Subject: pkix.Name{CommonName: "server"}, SANs: serverOpts.SANs, KeyUsage: x509.KeyUsageCertSign}, root, rootKey)
+	otherRoot := newTestStore(t).CA.Certificate
+
+	// x509 no longer builds chains through a CA without CertSign, nor through a leaf, so those errors
+	// are made directly
+	noCertSign, _ := issueTestCert(t, CertificateOptions{Subject: pkix.Name{CommonName: "no CertSign CA"}, IsCA: true, KeyUsage: x509.KeyUsageDigitalSignature}, root, rootKey)
+	noCertSignErr := checkChainKeyUsage([]*x509.Certificate{leaf, noCertSign, root}, server)
+	notCA, _ := issueTestCert(t, CertificateOptions{Subject: pkix.Name{CommonName: "not a CA"}}, root, rootKey)
+
+	// an intermediate CA permitted only example.org
+	constrained, constrainedKey := issueTestCert(t, CertificateOptions{Subject: pkix.Name{CommonName: "constrained CA"}, IsCA: true, KeyUsage: x509.KeyUsageCertSign,
+		NameConstraints: &NameConstraints{PermittedDNSDomains: []string{"example.org"}}}, root, rootKey)
+	constrainedLeaf, _ := issueTestCert(t, serverOpts, constrained, constrainedKey)
+
+	// an intermediate CA with path length 0, followed by another intermediate CA
+	pathZero, pathZeroKey := issueTestCert(t, CertificateOptions{Subject: pkix.Name{CommonName: "path length 0 CA"}, IsCA: true, KeyUsage: x509.KeyUsageCertSign, MaxPathLenZero: true}, root, rootKey)
+	belowPathZero, belowPathZeroKey := issueTestCert(t, CertificateOptions{Subject: pkix.Name{CommonName: "second CA"}, IsCA: true, KeyUsage: x509.KeyUsageCertSign}, pathZero, pathZeroKey)
+	tooDeepLeaf, _ := issueTestCert(t, serverOpts, belowPathZero, belowPathZeroKey)
+
+	tests := []struct {
+		name string
+		cert *x509.Certificate
+		opts VerifyOptions
+		// err is the error to explain; if nil, that of verifying cert
+		err    error
+		prefix string
+	}{
+		{name: "hostname", cert: leaf, opts: VerifyOptions{Roots: roots, Host: "other.example.com", Purpose: server}, prefix: "hostname mismatch: certificate CN=server is valid for www.example.com, not other.example.com"},
+		{name: "untrusted root", cert: root, opts: VerifyOptions{Roots: []*x509.Certificate{otherRoot}, Purpose: server}, prefix: "unknown authority: root CN=test CA is not trusted"},
+		{name: "unknown issuer", cert: leaf, opts: VerifyOptions{Roots: []*x509.Certificate{otherRoot}, Purpose: server}, prefix: "unknown authority: certificate CN=server is issued by CN=test CA"},
+		{name: "missing intermediate", cert: constrainedLeaf, opts: VerifyOptions{Roots: roots, Purpose: server}, prefix: "unknown authority: certificate CN=server is issued by CN=constrained CA"},
+		{name: "unknown authority without certificate", err: x509.UnknownAuthorityError{}, prefix: "unknown authority: "},
+		{name: "leaf key usage", cert: signOnly, opts: VerifyOptions{Roots: roots, Purpose: server}, prefix: "incompatible key usage: x509: certificate CN=server has incompatible key usage: CertSign does not allow purpose server"},
+		{name: "CA key usage", err: noCertSignErr, prefix: "incompatible key usage: x509: certificate CN=no CertSign CA has incompatible key usage"},
+		{name: "system roots", err: x509.SystemRootsError{}, prefix: "no trusted roots: "},
+		{name: "expired", cert: leaf, opts: VerifyOptions{Roots: roots, Purpose: server, At: time.Now().Add(48 * time.Hour)}, prefix: "expired or not yet valid: certificate CN=server is valid from "},
+		{name: "not yet valid", cert: leaf, opts: VerifyOptions{Roots: roots, Purpose: server, At: time.Now().Add(-time.Hour)}, prefix: "expired or not yet valid: "},
+		{name: "extended key usage", cert: client, opts: VerifyOptions{Roots: roots, Purpose: server}, prefix: "extended key usage mismatch: no chain allows purpose server; certificate CN=client allows ClientAuth"},
+		{name: "name constraints", cert: constrainedLeaf, opts: VerifyOptions{Roots: roots, Intermediates: []*x509.Certificate{constrained}, Purpose: server}, prefix: "name constraints: certificate CN=server violates the name constraints of its issuers"},
+		{name: "not a CA", err: x509.CertificateInvalidError{Cert: notCA, Reason: x509.NotAuthorizedToSign}, prefix: "not a CA: certificate CN=not a CA issued another certificate"},
+		{name: "path length", cert: tooDeepLeaf, opts: VerifyOptions{Roots: roots, Intermediates: []*x509.Certificate{pathZero, belowPathZero}, Purpose: server}, prefix: "path length: certificate CN=path length 0 CA has path length 0"},
+		{name: "other reason", err: x509.CertificateInvalidError{Cert: leaf, Reason: x509.NameMismatch}, prefix: "x509: issuer name does not match subject from issuing certificate"},
+		{name: "other error", err: errors.New("failed"), prefix: "failed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.err
+			if err == nil {
+				if _, err = Verify(tt.cert, tt.opts); err == nil {
+					t.Fatal("verified")
+				}
+			}
+			if explained := ExplainVerifyError(err, tt.opts); !strings.HasPrefix(explained, tt.prefix) {
+				t.Errorf("explained %v as %q, expected %q", err, explained, tt.prefix)
+			}
+		})
+	}
+
+	if chains, err := Verify(leaf, VerifyOptions{Roots: roots, Host: "www.example.com", Purpose: server}); err != nil || len(chains) != 1 || len(chains[0]) != 2 {
+		t.Errorf("valid certificate gave chains %v, error %v", chains, err)
+	}
+}